@@ -0,0 +1,25 @@
+package imagor
+
+import (
+	"net/http"
+	"strings"
+)
+
+// autoFormatArgs returns format(auto) filter args of the AutoFormats candidates accepted by the request,
+// e.g. auto,avif,webp,jpeg
+func (app *Imagor) autoFormatArgs(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	args := []string{"auto"}
+	for _, format := range app.AutoFormats {
+		switch format {
+		case "jpeg", "jpg", "png", "gif":
+			// universally supported
+		default:
+			if !strings.Contains(accept, "image/"+format) {
+				continue
+			}
+		}
+		args = append(args, format)
+	}
+	return strings.Join(args, ",")
+}
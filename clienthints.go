@@ -0,0 +1,116 @@
+package imagor
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cshum/imagor/imagorpath"
+)
+
+// clientHints request headers advertised by Accept-CH, responses vary on when client hints enabled
+var clientHints = []string{"Sec-CH-DPR", "Sec-CH-Width", "Sec-CH-Viewport-Width", "Save-Data"}
+
+// clientHintsBreakpoints widths that client hint widths are rounded up to, bounding variants of results
+var clientHintsBreakpoints = []int{320, 480, 640, 750, 828, 1080, 1200, 1440, 1920, 2048, 2560, 3840}
+
+// applyClientHints applies the dpr(n) filter value and client hints to params,
+// returns true if params changed.
+//
+// Explicit dimensions are scaled by the device pixel ratio, capped by MaxDPR.
+// Without explicit dimensions, width is resolved from Sec-CH-Width within Sec-CH-Viewport-Width scaled by MaxDPR,
+// or Sec-CH-Viewport-Width scaled by the device pixel ratio, rounded up to breakpoints without upscaling.
+// Quality is lowered to SaveDataQuality on Save-Data
+func (app *Imagor) applyClientHints(r *http.Request, p imagorpath.Params, dpr float64) (imagorpath.Params, bool) {
+	var changed bool
+	if dpr == 0 && app.ClientHints {
+		dpr = parseDPR(r.Header.Get("Sec-CH-DPR"))
+	}
+	if app.MaxDPR > 0 && dpr > app.MaxDPR {
+		dpr = app.MaxDPR
+	}
+	if p.Width != 0 || p.Height != 0 {
+		if dpr > 0 && dpr != 1 {
+			p.Width = scaleDimension(p.Width, dpr)
+			p.Height = scaleDimension(p.Height, dpr)
+			changed = true
+		}
+	} else if app.ClientHints {
+		if p.Width = app.clientHintsWidth(r, dpr); p.Width > 0 {
+			p.Filters = append(p.Filters, imagorpath.Filter{Name: "no_upscale"})
+			changed = true
+		}
+	}
+	if app.ClientHints && app.SaveDataQuality > 0 &&
+		strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on") {
+		var hasQuality bool
+		for i, f := range p.Filters {
+			if f.Name != "quality" {
+				continue
+			}
+			hasQuality = true
+			if q, err := strconv.Atoi(f.Args); err != nil || q > app.SaveDataQuality {
+				p.Filters[i].Args = strconv.Itoa(app.SaveDataQuality)
+				changed = true
+			}
+		}
+		if !hasQuality {
+			p.Filters = append(p.Filters, imagorpath.Filter{
+				Name: "quality",
+				Args: strconv.Itoa(app.SaveDataQuality),
+			})
+			changed = true
+		}
+	}
+	return p, changed
+}
+
+// clientHintsWidth returns width of client hints rounded up to breakpoints, 0 if not hinted
+func (app *Imagor) clientHintsWidth(r *http.Request, dpr float64) int {
+	maxWidth := clientHintsBreakpoints[len(clientHintsBreakpoints)-1]
+	vw, _ := strconv.Atoi(r.Header.Get("Sec-CH-Viewport-Width"))
+	vw = min(vw, maxWidth)
+	w, _ := strconv.Atoi(r.Header.Get("Sec-CH-Width"))
+	if w > 0 {
+		// Sec-CH-Width is in physical pixels, within viewport at MaxDPR
+		if vw > 0 && app.MaxDPR > 0 {
+			w = min(w, scaleDimension(vw, app.MaxDPR))
+		}
+	} else if vw > 0 {
+		w = vw
+		if dpr > 0 {
+			w = scaleDimension(vw, dpr)
+		}
+	}
+	if w <= 0 {
+		return 0
+	}
+	for _, breakpoint := range clientHintsBreakpoints {
+		if w <= breakpoint {
+			return breakpoint
+		}
+	}
+	return maxWidth
+}
+
+// setClientHintsHeaders sets Accept-CH and Vary response headers of client hints
+func setClientHintsHeaders(w http.ResponseWriter) {
+	w.Header().Set("Accept-CH", strings.Join(clientHints, ", "))
+	for _, h := range clientHints {
+		w.Header().Add("Vary", h)
+	}
+}
+
+// parseDPR parses device pixel ratio, returns 0 if invalid
+func parseDPR(s string) float64 {
+	dpr, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || dpr <= 0 || math.IsInf(dpr, 0) || math.IsNaN(dpr) {
+		return 0
+	}
+	return dpr
+}
+
+func scaleDimension(n int, dpr float64) int {
+	return int(math.Round(float64(n) * dpr))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/config/awsconfig"
+	"github.com/cshum/imagor/loader/fallbackloader"
+	"github.com/peterbourgon/ff/v3"
+	"go.uber.org/zap"
+)
+
+func main() {
+	var (
+		fs     = flag.NewFlagSet("imagor-migrate", flag.ExitOnError)
+		logger *zap.Logger
+
+		debug = fs.Bool("debug", false, "Debug mode")
+		_     = fs.String("config", ".env", "Retrieve configuration from the given file")
+
+		migrateKeys = fs.String("migrate-keys", "-",
+			"File of object keys to migrate, one per line. Read from stdin if -")
+		migrateBucket = fs.String("migrate-bucket", "",
+			"Bucket of the keys to migrate, routed by -s3-tenants. Default to S3 Loader bucket")
+		migrateConcurrency = fs.Int("migrate-concurrency", 10,
+			"Number of keys migrated simultaneously")
+		migrateDryRun = fs.Bool("migrate-dry-run", false,
+			"Check keys against S3 Loader and report pending keys without copying")
+		migrateCheckpoint = fs.String("migrate-checkpoint", "",
+			"File recording completed keys. Keys completed in previous runs are skipped for resuming")
+		migrateReport = fs.String("migrate-report", "-",
+			"File of JSON report of copied, missing and failed keys. Write to stdout if -")
+
+		app = imagor.New(awsconfig.WithAWS(fs, func() (*zap.Logger, bool) {
+			if err := ff.Parse(fs, os.Args[1:],
+				ff.WithEnvVars(),
+				ff.WithConfigFileFlag("config"),
+				ff.WithIgnoreUndefined(true),
+				ff.WithAllowMissingConfigFile(true),
+				ff.WithConfigFileParser(ff.EnvParser),
+			); err != nil {
+				panic(err)
+			}
+			if *debug {
+				logger = zap.Must(zap.NewDevelopment())
+			} else {
+				logger = zap.Must(zap.NewProduction())
+			}
+			return logger, *debug
+		}))
+	)
+
+	var fallback *fallbackloader.FallbackLoader
+	for _, loader := range app.Loaders {
+		if l, ok := loader.(*fallbackloader.FallbackLoader); ok {
+			fallback = l
+		}
+	}
+	if fallback == nil {
+		logger.Fatal("S3 Loader with -s3-loader-fallback-origins is required")
+	}
+	storage, ok := fallback.Loader.(imagor.Storage)
+	if !ok {
+		logger.Fatal("S3 Loader does not implement imagor.Storage")
+	}
+
+	completed := map[string]bool{}
+	var checkpoint *os.File
+	if *migrateCheckpoint != "" {
+		if err := readLines(*migrateCheckpoint, func(key string) {
+			completed[key] = true
+		}); err != nil && !os.IsNotExist(err) {
+			logger.Fatal("read checkpoint", zap.Error(err))
+		}
+		var err error
+		if checkpoint, err = os.OpenFile(*migrateCheckpoint, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			logger.Fatal("open checkpoint", zap.Error(err))
+		}
+		defer func() {
+			_ = checkpoint.Close()
+		}()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		if err := readLines(*migrateKeys, func(key string) {
+			if completed[key] {
+				return
+			}
+			select {
+			case keys <- key:
+			case <-ctx.Done():
+			}
+		}); err != nil {
+			logger.Error("read keys", zap.Error(err))
+		}
+	}()
+
+	migrator := &fallbackloader.Migrator{
+		Fallback:    fallback,
+		Storage:     storage,
+		Bucket:      *migrateBucket,
+		Concurrency: *migrateConcurrency,
+		DryRun:      *migrateDryRun,
+		Logger:      logger,
+	}
+	report := migrator.Migrate(ctx, keys, func(key string) {
+		if checkpoint != nil && !*migrateDryRun {
+			_, _ = fmt.Fprintln(checkpoint, key)
+		}
+	})
+	logger.Info("migrate",
+		zap.Bool("dry_run", report.DryRun),
+		zap.Int("existing", report.Existing),
+		zap.Int("pending", len(report.Pending)),
+		zap.Int("copied", len(report.Copied)),
+		zap.Int("missing", len(report.Missing)),
+		zap.Int("failed", len(report.Failed)))
+
+	if err := writeReport(*migrateReport, report); err != nil {
+		logger.Fatal("write report", zap.Error(err))
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// readLines reads non-empty trimmed lines of file, or stdin if -
+func readLines(name string, fn func(line string)) error {
+	var r io.Reader = os.Stdin
+	if name != "-" && name != "" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		r = file
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// writeReport writes JSON report to file, or stdout if -
+func writeReport(name string, report *fallbackloader.MigrateReport) error {
+	var w io.Writer = os.Stdout
+	if name != "-" && name != "" {
+		file, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		w = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
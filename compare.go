@@ -0,0 +1,82 @@
+package imagor
+
+import (
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cshum/imagor/imagorpath"
+)
+
+// compareSize fit-in dimension of compared images without dimensions specified
+const compareSize = 256
+
+// CompareResult perceptual hash comparison of images
+type CompareResult struct {
+	Algorithm string    `json:"algorithm"`
+	Hashes    [2]string `json:"hashes"`
+	Distance  int       `json:"distance"`
+}
+
+// handleCompareRequest handles GET /compare/{hash}/{image}/{image} requests,
+// responding Hamming distance of perceptual hashes of the images.
+// Images are image keys, optionally with imagor params e.g. fit-in/500x500/image.jpg
+func (app *Imagor) handleCompareRequest(w http.ResponseWriter, r *http.Request, images [2]string) {
+	algorithm := r.URL.Query().Get("algorithm")
+	if algorithm == "" {
+		algorithm = "phash"
+	}
+	if algorithm != "phash" && algorithm != "dhash" {
+		app.handleJSONError(w, r, ErrInvalid)
+		return
+	}
+	res := CompareResult{Algorithm: algorithm}
+	var values [2]uint64
+	for i, image := range images {
+		var err error
+		if values[i], err = app.perceptualHash(r, image, algorithm); err != nil {
+			app.handleJSONError(w, r, err)
+			return
+		}
+		res.Hashes[i] = fmt.Sprintf("%016x", values[i])
+	}
+	res.Distance = bits.OnesCount64(values[0] ^ values[1])
+	writeJSON(w, r, res)
+}
+
+// perceptualHash processes image path with perceptual hash filter of the algorithm
+func (app *Imagor) perceptualHash(r *http.Request, path, algorithm string) (uint64, error) {
+	p := imagorpath.Parse(path)
+	if p.Image == "" {
+		return 0, ErrInvalid
+	}
+	if p.Width == 0 && p.Height == 0 && !p.FitIn {
+		// hash is computed from a tiny thumbnail, shrink on load
+		p.FitIn = true
+		p.Width, p.Height = compareSize, compareSize
+	}
+	// request signature already verified, path regenerated for the hash
+	p.Meta = false
+	p.Path = ""
+	p.Hash = ""
+	p.Filters = append(p.Filters, imagorpath.Filter{Name: algorithm})
+	blob, err := checkBlob(app.Do(r, p))
+	if err != nil {
+		return 0, err
+	}
+	buf, err := blob.ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	text := strings.TrimSpace(string(buf))
+	if len(text) != 16 {
+		return 0, ErrPerceptualHashUnsupported
+	}
+	value, err := strconv.ParseUint(text, 16, 64)
+	if err != nil {
+		return 0, ErrPerceptualHashUnsupported
+	}
+	return value, nil
+}
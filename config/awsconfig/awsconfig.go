@@ -3,12 +3,15 @@ package awsconfig
 import (
 	"context"
 	"flag"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/loader/fallbackloader"
 	"github.com/cshum/imagor/storage/s3storage"
 	"go.uber.org/zap"
 )
@@ -82,6 +85,14 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"Upload ACL for S3 Storage")
 		s3StorageExpiration = fs.Duration("s3-storage-expiration", 0,
 			"S3 Storage expiration duration e.g. 24h. Default no expiration")
+		s3StorageCacheControl = fs.String("s3-storage-cache-control", "",
+			"Cache-Control header for S3 Storage objects")
+		s3StorageContentDisposition = fs.String("s3-storage-content-disposition", "",
+			"Content-Disposition header for S3 Storage objects")
+		s3StorageMetadata = fs.Bool("s3-storage-metadata", false,
+			"Set source key, params path and imagor version as user metadata of S3 Storage objects")
+		s3StorageTags = fs.String("s3-storage-tags", "",
+			"Object tags for S3 Storage, comma separated key=value with {bucket} for the request tenant bucket e.g. kind=original,bucket={bucket}")
 
 		s3ResultStorageBucket = fs.String("s3-result-storage-bucket", "",
 			"S3 Bucket for S3 Result Storage. Enable S3 Result Storage only if this value present")
@@ -93,8 +104,46 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"Upload ACL for S3 Result Storage")
 		s3ResultStorageExpiration = fs.Duration("s3-result-storage-expiration", 0,
 			"S3 Result Storage expiration duration e.g. 24h. Default no expiration")
+		s3ResultStorageCacheControl = fs.String("s3-result-storage-cache-control", "",
+			"Cache-Control header for S3 Result Storage objects")
+		s3ResultStorageContentDisposition = fs.String("s3-result-storage-content-disposition", "",
+			"Content-Disposition header for S3 Result Storage objects")
+		s3ResultStorageMetadata = fs.Bool("s3-result-storage-metadata", false,
+			"Set source key, params path and imagor version as user metadata of S3 Result Storage objects")
+		s3ResultStorageTags = fs.String("s3-result-storage-tags", "",
+			"Object tags for S3 Result Storage, comma separated key=value with {bucket} for the request tenant bucket e.g. kind=result,bucket={bucket}")
 		s3StorageClass = fs.String("s3-storage-class", "STANDARD",
 			"S3 File Storage Class. Available values: REDUCED_REDUNDANCY, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER, DEEP_ARCHIVE. Default: STANDARD.")
+		s3ServerSideEncryption = fs.String("s3-server-side-encryption", "",
+			"S3 server-side encryption for S3 Storage and Result Storage objects. Available values: AES256, aws:kms, aws:kms:dsse. Other values fail on startup")
+		s3SSEKMSKeyID = fs.String("s3-sse-kms-key-id", "",
+			"KMS key ID for aws:kms server-side encryption. Default to the bucket AWS managed key")
+		s3UploadPartSize = fs.Int64("s3-upload-part-size", 5*1024*1024,
+			"S3 multipart upload part size in bytes, minimum 5MB. Objects larger than a part are streamed by multipart upload")
+		s3UploadConcurrency = fs.Int("s3-upload-concurrency", 5,
+			"Number of S3 multipart upload parts uploaded in parallel per object")
+		s3Tenants = fs.String("s3-tenants", "",
+			"S3 tenant bucket routing table as JSON file path or inline JSON array e.g. [{\"bucket\":\"mybucket\",\"region\":\"us-west-2\",\"allowed_prefixes\":[\"images/\"]}]. "+
+				"Loader routes by AWS-BUCKET request header within the table, Storage and Result Storage nest keys under the tenant base dirs. Unknown buckets are rejected. "+
+				"Without the table, S3 Loader rejects buckets other than s3-loader-bucket unless s3-loader-bucket-from-request")
+		s3LoaderBucketFromRequest = fs.Bool("s3-loader-bucket-from-request", false,
+			"Trust AWS-BUCKET and AWS-REGION request headers as is for S3 Loader without s3-tenants, loading from any bucket reachable by the credentials. "+
+				"Otherwise buckets other than s3-loader-bucket are rejected")
+
+		s3LoaderFallbackOrigins = fs.String("s3-loader-fallback-origins", "",
+			"Fallback origin URL templates for S3 Loader on not found, comma separated with {bucket}, {subdomain} and {key} placeholders e.g. https://{subdomain}.imgix.net/{key}. Enable fallback only if this value present")
+		s3LoaderFallbackSubdomains = fs.String("s3-loader-fallback-subdomains", "",
+			"Bucket to {subdomain} mapping for S3 Loader fallback, comma separated bucket:subdomain e.g. mrsool-business:mrsool")
+		s3LoaderFallbackBuckets = fs.String("s3-loader-fallback-buckets", "",
+			"Buckets allowed to fallback for S3 Loader, comma separated. Allow all s3-tenants buckets if empty, or only s3-loader-bucket without s3-tenants")
+		s3LoaderFallbackMaxAllowedSize = fs.Int("s3-loader-fallback-max-allowed-size", fallbackloader.DefaultMaxAllowedSize,
+			"Maximum bytes allowed for S3 Loader fallback image. Default 32MB if not positive")
+		s3LoaderFallbackConcurrency = fs.Int64("s3-loader-fallback-concurrency", 20,
+			"Maximum number of S3 Loader fallback requests simultaneously. Set -1 for no limit")
+		s3LoaderFallbackTimeout = fs.Duration("s3-loader-fallback-timeout", time.Second*30,
+			"Timeout for S3 Loader fallback origin request")
+		s3LoaderFallbackBackfill = fs.String("s3-loader-fallback-backfill", "loader",
+			"Backfill S3 Loader fallback image asynchronously into: loader, storage, none")
 
 		logger, _ = cb()
 	)
@@ -156,7 +205,19 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			}
 		}
 
+		if err = s3storage.ValidateServerSideEncryption(*s3ServerSideEncryption); err != nil {
+			panic(err)
+		}
+
+		var tenants *s3storage.Tenants
+		if *s3Tenants != "" {
+			if tenants, err = parseTenants(*s3LoaderBucket, *s3Tenants); err != nil {
+				panic(err)
+			}
+		}
+
 		// Create S3 Storage instances
+		var s3Storage *s3storage.S3Storage
 		if *s3StorageBucket != "" {
 			// Determine endpoint: service-specific takes priority over global
 			endpoint := *s3StorageEndpoint
@@ -173,13 +234,21 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 				s3storage.WithStorageClass(*s3StorageClass),
 				s3storage.WithEndpoint(endpoint),
 				s3storage.WithForcePathStyle(*s3ForcePathStyle),
+				s3storage.WithPartSize(*s3UploadPartSize),
+				s3storage.WithUploadConcurrency(*s3UploadConcurrency),
 				s3storage.WithLogger(logger),
 				s3storage.WithBucketFromRequest(false),
 				s3storage.WithRegionFromRequest(false),
-				s3storage.WithImgixFallback(false),
-				s3storage.WithImgixFallbackTimeout(300*time.Second),
+				s3storage.WithTenants(tenants),
+				s3storage.WithTenantBaseDir(s3storage.Tenant.GetStorageBaseDir),
+				s3storage.WithCacheControl(*s3StorageCacheControl),
+				s3storage.WithContentDisposition(*s3StorageContentDisposition),
+				s3storage.WithMetadata(*s3StorageMetadata),
+				s3storage.WithTags(*s3StorageTags),
+				s3storage.WithServerSideEncryption(*s3ServerSideEncryption, *s3SSEKMSKeyID),
 			)
 
+			s3Storage = storage
 			app.Storages = append(app.Storages, storage)
 		}
 
@@ -190,20 +259,52 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 				endpoint = *s3Endpoint
 			}
 
+			loaderTenants := tenants
+			if loaderTenants == nil && !*s3LoaderBucketFromRequest {
+				// without tenants, only the loader bucket is routable unless request headers are trusted
+				bucket, _, _ := strings.Cut(*s3LoaderBucket, "/")
+				if loaderTenants, err = s3storage.NewTenants(bucket); err != nil {
+					panic(err)
+				}
+			}
 			loader := s3storage.New(loaderCfg, *s3LoaderBucket,
 				s3storage.WithPathPrefix(*s3LoaderPathPrefix),
 				s3storage.WithBaseDir(*s3LoaderBaseDir),
 				s3storage.WithSafeChars(*s3SafeChars),
 				s3storage.WithEndpoint(endpoint),
 				s3storage.WithForcePathStyle(*s3ForcePathStyle),
+				s3storage.WithPartSize(*s3UploadPartSize),
+				s3storage.WithUploadConcurrency(*s3UploadConcurrency),
 				s3storage.WithLogger(logger),
-				s3storage.WithBucketFromRequest(true),
-				s3storage.WithRegionFromRequest(true),
-				s3storage.WithImgixFallback(true),
-				s3storage.WithImgixFallbackTimeout(300*time.Second),
+				s3storage.WithBucketFromRequest(*s3LoaderBucketFromRequest),
+				s3storage.WithRegionFromRequest(*s3LoaderBucketFromRequest),
+				s3storage.WithTenants(loaderTenants),
 			)
 
-			app.Loaders = append(app.Loaders, loader)
+			if *s3LoaderFallbackOrigins != "" {
+				var backfill imagor.Storage
+				switch strings.ToLower(*s3LoaderFallbackBackfill) {
+				case "loader":
+					backfill = loader
+				case "storage":
+					if s3Storage != nil {
+						backfill = s3Storage
+					}
+				}
+				app.Loaders = append(app.Loaders, fallbackloader.New(loader,
+					fallbackloader.WithOrigins(*s3LoaderFallbackOrigins),
+					fallbackloader.WithSubdomains(*s3LoaderFallbackSubdomains),
+					fallbackloader.WithBuckets(*s3LoaderFallbackBuckets),
+					fallbackloader.WithDefaultBucket(*s3LoaderBucket),
+					fallbackloader.WithMaxAllowedSize(*s3LoaderFallbackMaxAllowedSize),
+					fallbackloader.WithConcurrency(*s3LoaderFallbackConcurrency),
+					fallbackloader.WithTimeout(*s3LoaderFallbackTimeout),
+					fallbackloader.WithStorage(backfill),
+					fallbackloader.WithLogger(logger),
+				))
+			} else {
+				app.Loaders = append(app.Loaders, loader)
+			}
 		}
 
 		if *s3ResultStorageBucket != "" {
@@ -222,14 +323,33 @@ func WithAWS(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 				s3storage.WithStorageClass(*s3StorageClass),
 				s3storage.WithEndpoint(endpoint),
 				s3storage.WithForcePathStyle(*s3ForcePathStyle),
+				s3storage.WithPartSize(*s3UploadPartSize),
+				s3storage.WithUploadConcurrency(*s3UploadConcurrency),
 				s3storage.WithLogger(logger),
 				s3storage.WithBucketFromRequest(false),
 				s3storage.WithRegionFromRequest(false),
-				s3storage.WithImgixFallback(false),
-				s3storage.WithImgixFallbackTimeout(300*time.Second),
+				s3storage.WithTenants(tenants),
+				s3storage.WithTenantBaseDir(s3storage.Tenant.GetResultStorageBaseDir),
+				s3storage.WithCacheControl(*s3ResultStorageCacheControl),
+				s3storage.WithContentDisposition(*s3ResultStorageContentDisposition),
+				s3storage.WithMetadata(*s3ResultStorageMetadata),
+				s3storage.WithTags(*s3ResultStorageTags),
+				s3storage.WithServerSideEncryption(*s3ServerSideEncryption, *s3SSEKMSKeyID),
 			)
 
 			app.ResultStorages = append(app.ResultStorages, resultStorage)
 		}
 	}
 }
+
+// parseTenants parses S3 tenant routing table from JSON file path or inline JSON array
+func parseTenants(defaultBucket, value string) (*s3storage.Tenants, error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, err
+		}
+	}
+	return s3storage.ParseTenants(defaultBucket, data)
+}
@@ -2,11 +2,14 @@ package awsconfig
 
 import (
 	"testing"
+	"time"
 
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/config"
+	"github.com/cshum/imagor/loader/fallbackloader"
 	"github.com/cshum/imagor/storage/s3storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestS3Empty(t *testing.T) {
@@ -54,6 +57,17 @@ func TestS3Storage(t *testing.T) {
 		"-s3-result-storage-bucket", "b",
 		"-s3-result-storage-base-dir", "bar",
 		"-s3-result-storage-path-prefix", "bcda",
+
+		"-s3-storage-cache-control", "public, max-age=31536000",
+		"-s3-storage-tags", "kind=original",
+		"-s3-result-storage-content-disposition", "inline",
+		"-s3-result-storage-metadata",
+		"-s3-result-storage-tags", "kind=result,bucket={bucket}",
+		"-s3-server-side-encryption", "aws:kms",
+		"-s3-sse-kms-key-id", "my-key",
+
+		"-s3-upload-part-size", "10485760",
+		"-s3-upload-concurrency", "3",
 	}, WithAWS)
 	app := srv.App.(*imagor.Imagor)
 	assert.Equal(t, 1, len(app.Loaders))
@@ -62,12 +76,37 @@ func TestS3Storage(t *testing.T) {
 	assert.Equal(t, "/foo/", storage.BaseDir)
 	assert.Equal(t, "/abcd/", storage.PathPrefix)
 	assert.Equal(t, "!", storage.SafeChars)
+	assert.Equal(t, int64(10485760), storage.PartSize)
+	assert.Equal(t, 3, storage.UploadConcurrency)
+	assert.Equal(t, "public, max-age=31536000", storage.CacheControl)
+	assert.Equal(t, "kind=original", storage.Tags.Encode())
+	assert.False(t, storage.Metadata)
+	assert.Equal(t, "aws:kms", storage.ServerSideEncryption)
+	assert.Equal(t, "my-key", storage.SSEKMSKeyID)
 
 	resultStorage := app.ResultStorages[0].(*s3storage.S3Storage)
 	assert.Equal(t, "b", resultStorage.Bucket)
 	assert.Equal(t, "/bar/", resultStorage.BaseDir)
 	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
 	assert.Equal(t, "!", resultStorage.SafeChars)
+	assert.Equal(t, int64(10485760), resultStorage.PartSize)
+	assert.Equal(t, 3, resultStorage.UploadConcurrency)
+	assert.Equal(t, "inline", resultStorage.ContentDisposition)
+	assert.Equal(t, "bucket=%7Bbucket%7D&kind=result", resultStorage.Tags.Encode())
+	assert.True(t, resultStorage.Metadata)
+	assert.Equal(t, "aws:kms", resultStorage.ServerSideEncryption)
+}
+
+func TestS3InvalidServerSideEncryption(t *testing.T) {
+	assert.Panics(t, func() {
+		config.CreateServer([]string{
+			"-aws-region", "asdf",
+			"-aws-access-key-id", "asdf",
+			"-aws-secret-access-key", "asdf",
+			"-s3-storage-bucket", "a",
+			"-s3-server-side-encryption", "aws:kmss",
+		}, WithAWS)
+	})
 }
 
 func TestS3SessionOverride(t *testing.T) {
@@ -162,3 +201,102 @@ func TestS3StorageClass(t *testing.T) {
 	storage = app.Storages[0].(*s3storage.S3Storage)
 	assert.Equal(t, "REDUCED_REDUNDANCY", storage.StorageClass)
 }
+
+func TestS3Tenants(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a",
+		"-s3-storage-bucket", "b",
+		"-s3-result-storage-bucket", "c",
+		"-s3-tenants", `[{"bucket":"d","region":"us-west-2","storage_base_dir":"dd"}]`,
+	}, WithAWS)
+	app := srv.App.(*imagor.Imagor)
+	loader := app.Loaders[0].(*s3storage.S3Storage)
+	tenant, ok := loader.Tenants.Get("d")
+	assert.True(t, ok)
+	assert.Equal(t, "us-west-2", tenant.Region)
+	_, ok = loader.Tenants.Get("")
+	assert.True(t, ok)
+	_, ok = loader.Tenants.Get("e")
+	assert.False(t, ok)
+
+	storage := app.Storages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "dd", storage.TenantBaseDir(tenant))
+	resultStorage := app.ResultStorages[0].(*s3storage.S3Storage)
+	assert.Equal(t, "d", resultStorage.TenantBaseDir(tenant))
+}
+
+func TestS3LoaderBucketFromRequest(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a/foo",
+	}, WithAWS)
+	app := srv.App.(*imagor.Imagor)
+	loader := app.Loaders[0].(*s3storage.S3Storage)
+	require.NotNil(t, loader.Tenants, "only loader bucket is routable by default")
+	_, ok := loader.Tenants.Get("")
+	assert.True(t, ok)
+	_, ok = loader.Tenants.Get("a")
+	assert.True(t, ok)
+	_, ok = loader.Tenants.Get("e")
+	assert.False(t, ok)
+
+	srv = config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a",
+		"-s3-loader-bucket-from-request",
+	}, WithAWS)
+	app = srv.App.(*imagor.Imagor)
+	loader = app.Loaders[0].(*s3storage.S3Storage)
+	assert.Nil(t, loader.Tenants, "request headers trusted as is")
+}
+
+func TestS3LoaderFallback(t *testing.T) {
+	srv := config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a",
+		"-s3-loader-fallback-origins", "https://{subdomain}.imgix.net/{key},https://{bucket}.example.com/{key}",
+		"-s3-loader-fallback-subdomains", "a:b",
+		"-s3-loader-fallback-buckets", "a",
+		"-s3-loader-fallback-max-allowed-size", "1000",
+		"-s3-loader-fallback-concurrency", "5",
+		"-s3-loader-fallback-timeout", "10s",
+	}, WithAWS)
+	app := srv.App.(*imagor.Imagor)
+	loader := app.Loaders[0].(*fallbackloader.FallbackLoader)
+	assert.Equal(t, []string{"https://{subdomain}.imgix.net/{key}", "https://{bucket}.example.com/{key}"}, loader.Origins)
+	assert.Equal(t, map[string]string{"a": "b"}, loader.Subdomains)
+	assert.Equal(t, []string{"a"}, loader.Buckets)
+	assert.Equal(t, "a", loader.DefaultBucket)
+	assert.Equal(t, 1000, loader.MaxAllowedSize)
+	assert.Equal(t, int64(5), loader.Concurrency)
+	assert.Equal(t, time.Second*10, loader.Timeout)
+	assert.Equal(t, loader.Loader, loader.Storage)
+	assert.Equal(t, loader.Loader, loader.Resolver)
+	assert.NotNil(t, loader.Instrumentation)
+
+	srv = config.CreateServer([]string{
+		"-aws-region", "asdf",
+		"-aws-access-key-id", "asdf",
+		"-aws-secret-access-key", "asdf",
+
+		"-s3-loader-bucket", "a",
+		"-s3-loader-fallback-origins", "https://{subdomain}.imgix.net/{key}",
+		"-s3-loader-fallback-max-allowed-size", "0",
+	}, WithAWS)
+	app = srv.App.(*imagor.Imagor)
+	loader = app.Loaders[0].(*fallbackloader.FallbackLoader)
+	assert.Equal(t, fallbackloader.DefaultMaxAllowedSize, loader.MaxAllowedSize)
+}
@@ -4,19 +4,26 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"os"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/TheZeroSlave/zapsentry"
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/imagorpath"
+	"github.com/cshum/imagor/loader/fallbackloader"
 	"github.com/cshum/imagor/metrics/instrumentation"
 	"github.com/cshum/imagor/metrics/prometheusmetrics"
 	"github.com/cshum/imagor/processor/vipsprocessor"
 	"github.com/cshum/imagor/server"
+	"github.com/cshum/imagor/storage/memorystorage"
 	"github.com/cshum/imagor/storage/s3storage"
 	"github.com/getsentry/sentry-go"
 	"github.com/peterbourgon/ff/v3"
@@ -37,6 +44,14 @@ func NewImagor(
 	var (
 		imagorSecret = fs.String("imagor-secret", "",
 			"Secret key for signing imagor URL")
+		imagorSecretID = fs.String("imagor-secret-id", "",
+			"Key ID of imagor-secret, for signature hash of ID=HASH")
+		imagorSecrets = fs.String("imagor-secrets", "",
+			"Additional active secret keys accepted for imagor URL signature, comma separated ID=SECRET e.g. k1=oldsecret. Key ID is embedded in signature hash as ID=HASH, or inferred by trying every key")
+		imagorSignerEmbedKeyID = fs.Bool("imagor-signer-embed-key-id", false,
+			"Embed key ID in generated URL signature hash as ID=HASH. Requires key ID of every secret")
+		imagorTenantSecrets = fs.String("imagor-tenant-secrets", "",
+			"Secret keys of AWS-BUCKET tenants in place of imagor-secret, JSON file path or inline JSON object of bucket to comma separated ID=SECRET, the first being the primary key e.g. {\"mybucket\":\"k2=newsecret,k1=oldsecret\"}")
 		imagorUnsafe = fs.Bool("imagor-unsafe", false,
 			"Unsafe imagor that does not require URL signature. Prone to URL tampering")
 		imagorAutoWebP = fs.Bool("imagor-auto-webp", false,
@@ -45,6 +60,14 @@ func NewImagor(
 			"Output AVIF format automatically if browser supports (experimental)")
 		imagorAutoJPEG = fs.Bool("imagor-auto-jpeg", false,
 			"Output JPEG format automatically if JPEG or no specific format is requested")
+		imagorAutoFormats = fs.String("imagor-auto-formats", "avif,webp,jpeg",
+			"Candidate formats of format(auto) filter by csv, the smallest output is picked. Candidates other than jpeg, png and gif are limited by browser Accept header")
+		imagorClientHints = fs.Bool("imagor-client-hints", false,
+			"Size images by Sec-CH-DPR, Sec-CH-Width, Sec-CH-Viewport-Width and Save-Data client hints request headers")
+		imagorMaxDPR = fs.Float64("imagor-max-dpr", 3,
+			"Maximum device pixel ratio of dpr(n) filter and client hints")
+		imagorSaveDataQuality = fs.Int("imagor-save-data-quality", 50,
+			"Image quality for Save-Data client hint requests, 0 to disable")
 		imagorRequestTimeout = fs.Duration("imagor-request-timeout",
 			time.Second*30, "Timeout for performing imagor request")
 		imagorLoadTimeout = fs.Duration("imagor-load-timeout",
@@ -69,6 +92,34 @@ func NewImagor(
 			false, "imagor HTTP Cache-Control header no-cache for successful image response")
 		imagorModifiedTimeCheck = fs.Bool("imagor-modified-time-check", false,
 			"Check modified time of result image against the source image. This eliminates stale result but require more lookups")
+		imagorResultStorageSWR = fs.Duration("imagor-result-storage-swr", 0,
+			"Serve stale result on modified time check and re-process in background, for source modified within the duration. Source modified beyond is re-processed synchronously. Set 0 to disable")
+		imagorRevalidateConcurrency = fs.Int64("imagor-revalidate-concurrency", 10,
+			"Maximum number of stale result background re-process to be executed simultaneously. Set -1 for no limit")
+		imagorImgixMode = fs.Bool("imagor-imgix-mode", false,
+			"Serve imgix compatible endpoint, parsing image path with imgix query string parameters in place of imagor endpoint")
+		imagorResultIndex = fs.Bool("imagor-result-index", false,
+			"Maintain source image to results index in result storages, allowing results to be purged regardless of result storage path style")
+		imagorEnablePurgeEndpoint = fs.Bool("imagor-enable-purge-endpoint", false,
+			"Enable signed DELETE /{hash}/purge/{image} endpoint deleting the source image from storages and its results from result storages")
+		imagorEnableCompareEndpoint = fs.Bool("imagor-enable-compare-endpoint", false,
+			"Enable signed GET /compare/{hash}/{image}/{image} endpoint responding Hamming distance of perceptual hashes of the images")
+		imagorEnableDiffEndpoint = fs.Bool("imagor-enable-diff-endpoint", false,
+			"Enable signed GET /diff/{hash}/{image}/{image} endpoint responding PSNR, SSIM and pixel mismatch of the images, or visual diff image with ?output=image")
+		imagorNegativeCacheTTL = fs.Duration("imagor-negative-cache-ttl", 0,
+			"Cache not found source image per bucket for the duration, skipping storages and loaders lookup. Set 0 to disable")
+		imagorNegativeCacheSize = fs.Int("imagor-negative-cache-size", 10000,
+			"Maximum number of not found source images in negative cache")
+		imagorTrustedProxies = fs.String("imagor-trusted-proxies", "",
+			"Trusted proxies CIDR or IP by csv e.g. 10.0.0.0/8. Client IP of ip(range) filter is the rightmost X-Forwarded-For address that is not a trusted proxy, or the remote address if not behind trusted proxies")
+		imagorFallbackImage = fs.String("imagor-fallback-image", "",
+			"Fallback image served on missing, invalid or timed out source, processed with params of the request")
+		imagorFallbackImages = fs.String("imagor-fallback-images", "",
+			"Fallback images by bucket and image path prefix, JSON file path or inline JSON array e.g. [{\"bucket\":\"mybucket\",\"prefix\":\"avatars/\",\"image\":\"avatar.png\"}]. Takes precedence over imagor-fallback-image")
+		imagorFallbackCacheTTL = fs.Duration("imagor-fallback-cache-ttl", time.Minute,
+			"imagor HTTP Cache-Control header TTL for fallback image response")
+		imagorPresets = fs.String("imagor-presets", "",
+			"Named params path fragments, JSON file path or inline JSON object e.g. {\"thumb\":\"fit-in/200x200/filters:format(webp)\"}. Expanded by preset:name/ path segment or preset(name) filter")
 		imagorDisableErrorBody       = fs.Bool("imagor-disable-error-body", false, "imagor disable response body on error")
 		imagorDisableParamsEndpoint  = fs.Bool("imagor-disable-params-endpoint", false, "imagor disable /params endpoint")
 		imagorSignerType             = fs.String("imagor-signer-type", "sha1", "imagor URL signature hasher type: sha1, sha256, sha512")
@@ -76,7 +127,7 @@ func NewImagor(
 		imagorStoragePathStyle       = fs.String("imagor-storage-path-style", "original", "imagor storage path style: original, digest")
 		imagorResultStoragePathStyle = fs.String("imagor-result-storage-path-style", "original", "imagor result storage path style: original, digest, suffix")
 
-		options, logger, isDebug = applyOptions(fs, cb, append(funcs, baseConfig...)...)
+		options, logger, isDebug = applyOptions(fs, cb, append(append(funcs, baseConfig...), withMemory)...)
 
 		alg          = sha1.New
 		hasher       imagorpath.StorageHasher
@@ -101,11 +152,69 @@ func NewImagor(
 		resultHasher = imagorpath.SizeSuffixResultStorageHasher
 	}
 
+	var fallbackImages []imagor.FallbackImage
+	if *imagorFallbackImages != "" {
+		var err error
+		if fallbackImages, err = parseFallbackImages(*imagorFallbackImages); err != nil {
+			panic(err)
+		}
+	}
+	if *imagorFallbackImage != "" {
+		fallbackImages = append(fallbackImages, imagor.FallbackImage{Image: *imagorFallbackImage})
+	}
+
+	trustedProxies, err := server.ParseTrustedProxies(*imagorTrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+
+	var presets imagorpath.Presets
+	if *imagorPresets != "" {
+		var err error
+		if presets, err = parsePresets(*imagorPresets); err != nil {
+			panic(err)
+		}
+	}
+
+	newSigner := func(primary imagorpath.SignerKey, secrets string) imagorpath.Signer {
+		keys, err := parseSignerKeys(alg, *imagorSignerTruncate, secrets)
+		if err != nil {
+			panic(err)
+		}
+		if primary.Signer == nil {
+			if len(keys) == 0 {
+				panic(errors.New("config: empty secrets"))
+			}
+			primary, keys = keys[0], keys[1:]
+		}
+		signer, err := imagorpath.NewMultiKeySigner(*imagorSignerEmbedKeyID, primary, keys...)
+		if err != nil {
+			panic(err)
+		}
+		return signer
+	}
+	var signer imagorpath.Signer = imagorpath.NewHMACSigner(
+		alg, *imagorSignerTruncate, *imagorSecret,
+	)
+	if *imagorSecrets != "" || *imagorSecretID != "" {
+		signer = newSigner(imagorpath.SignerKey{ID: *imagorSecretID, Signer: signer}, *imagorSecrets)
+	}
+	var tenantSigners []imagor.Option
+	if *imagorTenantSecrets != "" {
+		tenantSecrets, err := parseTenantSecrets(*imagorTenantSecrets)
+		if err != nil {
+			panic(err)
+		}
+		for bucket, secrets := range tenantSecrets {
+			tenantSigners = append(tenantSigners, imagor.WithTenantSigner(bucket, newSigner(imagorpath.SignerKey{}, secrets)))
+		}
+	}
+
 	app := imagor.New(append(
 		options,
-		imagor.WithSigner(imagorpath.NewHMACSigner(
-			alg, *imagorSignerTruncate, *imagorSecret,
-		)),
+		imagor.WithSigner(signer),
+		imagor.WithOptions(tenantSigners...),
+		imagor.WithClientIP(server.TrustedProxyIP(trustedProxies)),
 		imagor.WithBasePathRedirect(*imagorBasePathRedirect),
 		imagor.WithBaseParams(*imagorBaseParams),
 		imagor.WithRequestTimeout(*imagorRequestTimeout),
@@ -120,9 +229,25 @@ func NewImagor(
 		imagor.WithAutoWebP(*imagorAutoWebP),
 		imagor.WithAutoAVIF(*imagorAutoAVIF),
 		imagor.WithAutoJPEG(*imagorAutoJPEG),
+		imagor.WithAutoFormats(*imagorAutoFormats),
+		imagor.WithClientHints(*imagorClientHints),
+		imagor.WithMaxDPR(*imagorMaxDPR),
+		imagor.WithSaveDataQuality(*imagorSaveDataQuality),
 		imagor.WithModifiedTimeCheck(*imagorModifiedTimeCheck),
+		imagor.WithResultStorageSWR(*imagorResultStorageSWR),
+		imagor.WithRevalidateConcurrency(*imagorRevalidateConcurrency),
 		imagor.WithDisableErrorBody(*imagorDisableErrorBody),
 		imagor.WithDisableParamsEndpoint(*imagorDisableParamsEndpoint),
+		imagor.WithImgixMode(*imagorImgixMode),
+		imagor.WithResultIndex(*imagorResultIndex),
+		imagor.WithEnablePurgeEndpoint(*imagorEnablePurgeEndpoint),
+		imagor.WithEnableCompareEndpoint(*imagorEnableCompareEndpoint),
+		imagor.WithEnableDiffEndpoint(*imagorEnableDiffEndpoint),
+		imagor.WithNegativeCacheTTL(*imagorNegativeCacheTTL),
+		imagor.WithNegativeCacheSize(*imagorNegativeCacheSize),
+		imagor.WithFallbackImages(fallbackImages...),
+		imagor.WithFallbackCacheTTL(*imagorFallbackCacheTTL),
+		imagor.WithPresets(presets),
 		imagor.WithStoragePathStyle(hasher),
 		imagor.WithResultStoragePathStyle(resultHasher),
 		imagor.WithUnsafe(*imagorUnsafe),
@@ -135,9 +260,76 @@ func NewImagor(
 			vipsProcessor.Instrumentation = app.Instrumentation
 		}
 	}
+	for _, loader := range app.Loaders {
+		if fallbackLoader, ok := loader.(*fallbackloader.FallbackLoader); ok {
+			fallbackLoader.Instrumentation = app.Instrumentation
+			fallbackLoader.OnBackfill = app.InvalidateNotFound
+		}
+	}
+	for _, storage := range slices.Concat(app.Storages, app.ResultStorages) {
+		if memoryStorage, ok := storage.(*memorystorage.MemoryStorage); ok {
+			memoryStorage.Instrumentation = app.Instrumentation
+		}
+	}
 	return app
 }
 
+// parseFallbackImages parses fallback images from JSON file path or inline JSON array
+func parseFallbackImages(value string) ([]imagor.FallbackImage, error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, err
+		}
+	}
+	return imagor.ParseFallbackImages(data)
+}
+
+// parsePresets parses presets from JSON file path or inline JSON object
+func parsePresets(value string) (imagorpath.Presets, error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, err
+		}
+	}
+	return imagorpath.ParsePresets(data)
+}
+
+// parseSignerKeys parses signer keys from comma separated ID=SECRET.
+// Split at the first "=" as key ID cannot contain "=", while secret may
+func parseSignerKeys(alg func() hash.Hash, truncate int, secrets string) (keys []imagorpath.SignerKey, err error) {
+	for i, entry := range strings.Split(secrets, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, "=")
+		if !ok || id == "" || secret == "" {
+			// secret not included in error
+			return nil, fmt.Errorf("config: invalid secret key at position %d, ID=SECRET required", i+1)
+		}
+		keys = append(keys, imagorpath.SignerKey{
+			ID:     id,
+			Signer: imagorpath.NewHMACSigner(alg, truncate, secret),
+		})
+	}
+	return
+}
+
+// parseTenantSecrets parses tenant secrets from JSON file path or inline JSON object
+func parseTenantSecrets(value string) (secrets map[string]string, err error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		if data, err = os.ReadFile(value); err != nil {
+			return
+		}
+	}
+	err = json.Unmarshal(data, &secrets)
+	return
+}
+
 // CreateServer create server from config flags. Returns nil on version or help command
 func CreateServer(args []string, funcs ...Option) (srv *server.Server) {
 	var (
@@ -2,6 +2,7 @@ package config
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -11,7 +12,9 @@ import (
 	"github.com/cshum/imagor/loader/uploadloader"
 	"github.com/cshum/imagor/metrics/prometheusmetrics"
 	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/cshum/imagor/storage/memorystorage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDefault(t *testing.T) {
@@ -29,11 +32,18 @@ func TestDefault(t *testing.T) {
 	assert.Empty(t, app.ProcessConcurrency)
 	assert.Empty(t, app.BaseParams)
 	assert.False(t, app.ModifiedTimeCheck)
+	assert.Equal(t, time.Duration(0), app.ResultStorageSWR)
+	assert.Equal(t, int64(10), app.RevalidateConcurrency)
 	assert.False(t, app.AutoWebP)
 	assert.False(t, app.AutoAVIF)
 	assert.False(t, app.AutoJPEG)
+	assert.Equal(t, []string{"avif", "webp", "jpeg"}, app.AutoFormats)
+	assert.False(t, app.ClientHints)
+	assert.Equal(t, float64(3), app.MaxDPR)
+	assert.Equal(t, 50, app.SaveDataQuality)
 	assert.False(t, app.DisableErrorBody)
 	assert.False(t, app.DisableParamsEndpoint)
+	assert.False(t, app.ImgixMode)
 	assert.Equal(t, time.Hour*24*7, app.CacheHeaderTTL)
 	assert.Equal(t, time.Hour*24, app.CacheHeaderSWR)
 	assert.Empty(t, app.ResultStorages)
@@ -52,8 +62,17 @@ func TestBasic(t *testing.T) {
 		"-imagor-auto-webp",
 		"-imagor-auto-avif",
 		"-imagor-auto-jpeg",
+		"-imagor-auto-formats", "webp,jpeg",
+		"-imagor-client-hints",
+		"-imagor-max-dpr", "2.5",
+		"-imagor-save-data-quality", "40",
 		"-imagor-disable-error-body",
 		"-imagor-disable-params-endpoint",
+		"-imagor-imgix-mode",
+		"-imagor-result-index",
+		"-imagor-enable-purge-endpoint",
+		"-imagor-enable-compare-endpoint",
+		"-imagor-enable-diff-endpoint",
 		"-imagor-request-timeout", "16s",
 		"-imagor-load-timeout", "7s",
 		"-imagor-process-timeout", "19s",
@@ -63,6 +82,14 @@ func TestBasic(t *testing.T) {
 		"-imagor-base-params", "filters:watermark(example.jpg)",
 		"-imagor-cache-header-ttl", "169h",
 		"-imagor-cache-header-swr", "167h",
+		"-imagor-result-storage-swr", "1h",
+		"-imagor-revalidate-concurrency", "5",
+		"-imagor-negative-cache-ttl", "30s",
+		"-imagor-negative-cache-size", "500",
+		"-imagor-fallback-image", "default.png",
+		"-imagor-fallback-images", `[{"bucket":"mybucket","prefix":"avatars/","image":"avatar.png"}]`,
+		"-imagor-fallback-cache-ttl", "2m",
+		"-imagor-presets", `{"thumb":"fit-in/200x200"}`,
 		"-http-loader-insecure-skip-verify-transport",
 		"-http-loader-override-response-headers", "cache-control,content-type",
 		"-http-loader-base-url", "https://www.example.com/foo.org",
@@ -76,8 +103,17 @@ func TestBasic(t *testing.T) {
 	assert.True(t, app.AutoWebP)
 	assert.True(t, app.AutoAVIF)
 	assert.True(t, app.AutoJPEG)
+	assert.Equal(t, []string{"webp", "jpeg"}, app.AutoFormats)
+	assert.True(t, app.ClientHints)
+	assert.Equal(t, 2.5, app.MaxDPR)
+	assert.Equal(t, 40, app.SaveDataQuality)
 	assert.True(t, app.DisableErrorBody)
 	assert.True(t, app.DisableParamsEndpoint)
+	assert.True(t, app.ImgixMode)
+	assert.True(t, app.ResultIndex)
+	assert.True(t, app.EnablePurgeEndpoint)
+	assert.True(t, app.EnableCompareEndpoint)
+	assert.True(t, app.EnableDiffEndpoint)
 	assert.Equal(t, "RrTsWGEXFU2s1J1mTl1j_ciO-1E=", app.Signer.Sign("bar"))
 	assert.Equal(t, time.Second*16, app.RequestTimeout)
 	assert.Equal(t, time.Second*7, app.LoadTimeout)
@@ -88,6 +124,16 @@ func TestBasic(t *testing.T) {
 	assert.Equal(t, "filters:watermark(example.jpg)/", app.BaseParams)
 	assert.Equal(t, time.Hour*169, app.CacheHeaderTTL)
 	assert.Equal(t, time.Hour*167, app.CacheHeaderSWR)
+	assert.Equal(t, time.Hour, app.ResultStorageSWR)
+	assert.Equal(t, int64(5), app.RevalidateConcurrency)
+	assert.Equal(t, time.Second*30, app.NegativeCacheTTL)
+	assert.Equal(t, 500, app.NegativeCacheSize)
+	assert.Equal(t, []imagor.FallbackImage{
+		{Bucket: "mybucket", Prefix: "avatars/", Image: "avatar.png"},
+		{Image: "default.png"},
+	}, app.FallbackImages)
+	assert.Equal(t, time.Minute*2, app.FallbackCacheTTL)
+	assert.Equal(t, imagorpath.Presets{"thumb": "fit-in/200x200/"}, app.Presets)
 
 	httpLoader := app.Loaders[0].(*httploader.HTTPLoader)
 	assert.True(t, httpLoader.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
@@ -130,6 +176,42 @@ func TestSignerAlgorithm(t *testing.T) {
 	assert.Equal(t, "Kmml5ejnmsn7M7TszYkeM2j5G3bpI7mp", app.Signer.Sign("bar"))
 }
 
+func TestSignerKeys(t *testing.T) {
+	srv := CreateServer([]string{
+		"-imagor-secret", "new",
+		"-imagor-secret-id", "k2",
+		"-imagor-secrets", "k1=old==",
+		"-imagor-signer-embed-key-id",
+		"-imagor-tenant-secrets", `{"mybucket":"t1=tenant"}`,
+	})
+	app := srv.App.(*imagor.Imagor)
+	assert.Equal(t, "k2="+imagorpath.NewDefaultSigner("new").Sign("bar"), app.Signer.Sign("bar"))
+	assert.True(t, imagorpath.Verify(app.Signer, "bar", imagorpath.NewDefaultSigner("old==").Sign("bar")))
+	assert.True(t, imagorpath.Verify(app.TenantSigners["mybucket"], "bar",
+		imagorpath.NewDefaultSigner("tenant").Sign("bar")))
+	assert.False(t, imagorpath.Verify(app.TenantSigners["mybucket"], "bar",
+		imagorpath.NewDefaultSigner("new").Sign("bar")))
+
+	for _, secrets := range []string{"old", "k1:old", "=old", "k1="} {
+		assert.Panics(t, func() {
+			CreateServer([]string{"-imagor-secret", "new", "-imagor-secrets", secrets})
+		}, secrets)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	srv := CreateServer([]string{"-imagor-trusted-proxies", "10.0.0.0/8"})
+	app := srv.App.(*imagor.Imagor)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "9.9.9.9, 5.6.7.8")
+	assert.Equal(t, "5.6.7.8", app.ClientIP(r))
+
+	assert.Panics(t, func() {
+		CreateServer([]string{"-imagor-trusted-proxies", "foo"})
+	})
+}
+
 func TestCacheHeaderNoCache(t *testing.T) {
 	srv := CreateServer([]string{"-imagor-cache-header-no-cache"})
 	app := srv.App.(*imagor.Imagor)
@@ -165,6 +247,9 @@ func TestFileStorage(t *testing.T) {
 
 		"-file-result-storage-base-dir", "./bar",
 		"-file-result-storage-path-prefix", "bcda",
+		"-file-result-storage-max-size", "1000000",
+		"-file-result-storage-janitor-interval", "5m",
+		"-file-result-storage-shard-levels", "2",
 	})
 	app := srv.App.(*imagor.Imagor)
 	assert.Equal(t, 1, len(app.Loaders))
@@ -177,6 +262,33 @@ func TestFileStorage(t *testing.T) {
 	assert.Equal(t, "./bar", resultStorage.BaseDir)
 	assert.Equal(t, "/bcda/", resultStorage.PathPrefix)
 	assert.Equal(t, "!", resultStorage.SafeChars)
+	assert.Equal(t, int64(1000000), resultStorage.MaxSize)
+	assert.Equal(t, time.Minute*5, resultStorage.JanitorInterval)
+	assert.Equal(t, 2, resultStorage.ShardLevels)
+}
+
+func TestMemoryResultStorage(t *testing.T) {
+	srv := CreateServer([]string{
+		"-memory-result-storage-size", "1000000",
+		"-memory-result-storage-max-item-size", "1000",
+		"-memory-result-storage-ttl", "5m",
+	})
+	app := srv.App.(*imagor.Imagor)
+	resultStorage := app.ResultStorages[0].(*memorystorage.MemoryStorage)
+	assert.Equal(t, int64(1000000), resultStorage.MaxSize)
+	assert.Equal(t, int64(1000), resultStorage.MaxItemSize)
+	assert.Equal(t, time.Minute*5, resultStorage.TTL)
+	assert.Nil(t, resultStorage.Storage)
+
+	srv = CreateServer([]string{
+		"-memory-result-storage-size", "1000000",
+		"-file-result-storage-base-dir", "./bar",
+	})
+	app = srv.App.(*imagor.Imagor)
+	require.Len(t, app.ResultStorages, 1)
+	resultStorage = app.ResultStorages[0].(*memorystorage.MemoryStorage)
+	assert.Equal(t, time.Hour, resultStorage.TTL)
+	assert.Equal(t, "./bar", resultStorage.Storage.(*filestorage.FileStorage).BaseDir)
 }
 
 func TestPathStyle(t *testing.T) {
@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"time"
 
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/storage/filestorage"
@@ -39,6 +40,12 @@ func withFileSystem(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Opti
 			"File Storage write permission")
 		fileResultStorageExpiration = fs.Duration("file-result-storage-expiration", 0,
 			"File Result Storage expiration duration e.g. 24h. Default no expiration")
+		fileResultStorageMaxSize = fs.Int64("file-result-storage-max-size", 0,
+			"File Result Storage maximum total bytes, least recently accessed images are evicted beyond. Default no limit")
+		fileResultStorageJanitorInterval = fs.Duration("file-result-storage-janitor-interval", time.Minute,
+			"File Result Storage interval of evicting images beyond max size")
+		fileResultStorageShardLevels = fs.Int("file-result-storage-shard-levels", 0,
+			"File Result Storage number of hashed directory levels, up to 4. Default no sharding")
 
 		_, _ = cb()
 	)
@@ -76,6 +83,9 @@ func withFileSystem(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Opti
 					filestorage.WithWritePermission(*fileResultStorageWritePermission),
 					filestorage.WithSafeChars(*fileSafeChars),
 					filestorage.WithExpiration(*fileResultStorageExpiration),
+					filestorage.WithMaxSize(*fileResultStorageMaxSize),
+					filestorage.WithJanitorInterval(*fileResultStorageJanitorInterval),
+					filestorage.WithShardLevels(*fileResultStorageShardLevels),
 				),
 			)
 		}
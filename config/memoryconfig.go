@@ -0,0 +1,56 @@
+package config
+
+import (
+	"flag"
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/storage/memorystorage"
+	"go.uber.org/zap"
+)
+
+// withMemory with in-memory Result Storage tier in front of the first Result Storage config option
+func withMemory(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
+	var (
+		memoryResultStorageSize = fs.Int64("memory-result-storage-size", 0,
+			"Maximum bytes of in-memory LRU Result Storage, in front of the first Result Storage if any. Enable Memory Result Storage only if this value present")
+		memoryResultStorageMaxItemSize = fs.Int64("memory-result-storage-max-item-size", 1<<20,
+			"Maximum bytes of an image stored in Memory Result Storage. Larger images are not stored in memory")
+		memoryResultStorageTTL = fs.Duration("memory-result-storage-ttl", time.Hour,
+			"Memory Result Storage time to live of an image. Set 0 for no expiration")
+
+		_, _ = cb()
+	)
+	return func(o *imagor.Imagor) {
+		if *memoryResultStorageSize <= 0 {
+			return
+		}
+		options := []memorystorage.Option{
+			memorystorage.WithMaxSize(*memoryResultStorageSize),
+			memorystorage.WithMaxItemSize(*memoryResultStorageMaxItemSize),
+			memorystorage.WithTTL(*memoryResultStorageTTL),
+			memorystorage.WithName("result_storage"),
+		}
+		if len(o.ResultStorages) == 0 || !isTenantResolver(o.ResultStorages[0]) {
+			for _, loader := range o.Loaders {
+				// key by the tenant bucket of the loader if not resolved by the Result Storage
+				if resolver, ok := loader.(memorystorage.TenantResolver); ok {
+					options = append(options, memorystorage.WithTenantResolver(resolver))
+					break
+				}
+			}
+		}
+		if len(o.ResultStorages) > 0 {
+			// read through and write through the first Result Storage
+			o.ResultStorages[0] = memorystorage.New(append(options,
+				memorystorage.WithStorage(o.ResultStorages[0]))...)
+		} else {
+			o.ResultStorages = append(o.ResultStorages, memorystorage.New(options...))
+		}
+	}
+}
+
+func isTenantResolver(v any) bool {
+	_, ok := v.(memorystorage.TenantResolver)
+	return ok
+}
@@ -2,6 +2,7 @@ package vipsconfig
 
 import (
 	"flag"
+	"time"
 
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/processor/vipsprocessor"
@@ -37,13 +38,27 @@ func WithVips(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			"VIPS enable maximum compression with MozJPEG. Requires mozjpeg to be installed")
 		vipsAvifSpeed = fs.Int("vips-avif-speed", 5,
 			"VIPS avif speed, the lowest is at 0 and the fastest is at 9 (Default 5).")
+		vipsQualityTable = fs.String("vips-quality-table", "",
+			"VIPS format aware quality applied when no quality or quality(auto) is requested, comma separated FORMAT[@MAXSIZE]:QUALITY e.g. jpeg:80,webp:75,avif:50,avif@320:60. MAXSIZE bounds the rule by the maximum of output width and height")
+		vipsMaxSSIMIterations = fs.Int("vips-max-ssim-iterations", 6,
+			"VIPS maximum number of encodes of target_ssim quality search. Set 0 to disable target_ssim")
+		vipsAutoFormatBudget = fs.Duration("vips-auto-format-budget", time.Second*2,
+			"VIPS time budget of format(auto) encoding, remaining candidate formats are skipped once exceeded. Set 0 for unlimited")
 		vipsStripMetadata = fs.Bool("vips-strip-metadata", false,
 			"VIPS strips all metadata from the resulting image")
+		vipsKeepMetadata = fs.String("vips-keep-metadata", "",
+			"VIPS metadata categories kept in the resulting image, comma separated of icc,exif,gps,copyright,orientation,xmp,iptc,other. Categories not listed are always stripped")
+		vipsStripMetadataCategories = fs.String("vips-strip-metadata-categories", "",
+			"VIPS metadata categories always stripped from the resulting image, comma separated of icc,exif,gps,copyright,orientation,xmp,iptc,other e.g. gps")
 		vipsUnlimited = fs.Bool("vips-unlimited", false,
 			"VIPS bypass image max resolution check and remove all denial of service limits")
 
 		logger, isDebug = cb()
 	)
+	qualityTable, err := vipsprocessor.ParseQualityTable(*vipsQualityTable)
+	if err != nil {
+		panic(err)
+	}
 	return imagor.WithProcessors(
 		vipsprocessor.NewProcessor(
 			vipsprocessor.WithMaxAnimationFrames(*vipsMaxAnimationFrames),
@@ -59,7 +74,12 @@ func WithVips(fs *flag.FlagSet, cb func() (*zap.Logger, bool)) imagor.Option {
 			vipsprocessor.WithMaxResolution(*vipsMaxResolution),
 			vipsprocessor.WithMozJPEG(*vipsMozJPEG),
 			vipsprocessor.WithAvifSpeed(*vipsAvifSpeed),
+			vipsprocessor.WithQualityTable(qualityTable),
+			vipsprocessor.WithMaxSSIMIterations(*vipsMaxSSIMIterations),
+			vipsprocessor.WithAutoFormatBudget(*vipsAutoFormatBudget),
 			vipsprocessor.WithStripMetadata(*vipsStripMetadata),
+			vipsprocessor.WithKeepMetadata(*vipsKeepMetadata),
+			vipsprocessor.WithStripMetadataCategories(*vipsStripMetadataCategories),
 			vipsprocessor.WithUnlimited(*vipsUnlimited),
 			vipsprocessor.WithLogger(logger),
 			vipsprocessor.WithDebug(isDebug),
@@ -6,6 +6,7 @@ import (
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/config"
 	"github.com/cshum/imagor/processor/vipsprocessor"
+	"github.com/cshum/vipsgen/vips"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,9 +14,16 @@ func TestWithVips(t *testing.T) {
 	srv := config.CreateServer([]string{
 		"-vips-max-animation-frames", "167",
 		"-vips-disable-filters", "blur,watermark,rgb",
+		"-vips-quality-table", "jpeg:80,avif:50,avif@320:60",
+		"-vips-max-ssim-iterations", "4",
+		"-vips-strip-metadata-categories", "gps",
 	}, WithVips)
 	app := srv.App.(*imagor.Imagor)
 	processor := app.Processors[0].(*vipsprocessor.Processor)
 	assert.Equal(t, 167, processor.MaxAnimationFrames)
 	assert.Equal(t, []string{"blur", "watermark", "rgb"}, processor.DisableFilters)
+	assert.Equal(t, 60, processor.QualityTable.Quality(vips.ImageTypeAvif, 300, 200))
+	assert.Equal(t, 4, processor.MaxSSIMIterations)
+	assert.Equal(t, 80, processor.QualityTable.Quality(vips.ImageTypeJpeg, 300, 200))
+	assert.Equal(t, vipsprocessor.MetadataAll&^vipsprocessor.MetadataGPS, processor.MetadataPolicy)
 }
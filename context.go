@@ -7,6 +7,8 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/cshum/imagor/imagorpath"
 )
 
 type contextKey struct {
@@ -16,6 +18,8 @@ type contextKey struct {
 var imagorContextKey = contextKey{1}
 var detachContextKey = contextKey{2}
 var requestIDContextKey = contextKey{3}
+var paramsContextKey = contextKey{4}
+var revalidateContextKey = contextKey{5}
 
 type imagorContextRef struct {
 	funcs []func()
@@ -100,6 +104,12 @@ func isDetached(ctx context.Context) bool {
 	return ok
 }
 
+// isRevalidating returns if context is background revalidation of stale result
+func isRevalidating(ctx context.Context) bool {
+	_, ok := ctx.Value(revalidateContextKey).(bool)
+	return ok
+}
+
 // GenerateRequestID generates a random request ID
 func GenerateRequestID() string {
 	bytes := make([]byte, 8)
@@ -119,3 +129,14 @@ func GetRequestID(ctx context.Context) string {
 	}
 	return ""
 }
+
+// WithParams adds the request imagorpath.Params to the context
+func WithParams(ctx context.Context, p imagorpath.Params) context.Context {
+	return context.WithValue(ctx, paramsContextKey, p)
+}
+
+// GetParams retrieves the request imagorpath.Params from the context
+func GetParams(ctx context.Context) (imagorpath.Params, bool) {
+	p, ok := ctx.Value(paramsContextKey).(imagorpath.Params)
+	return p, ok
+}
@@ -2,10 +2,15 @@ package imagor
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/cshum/imagor/imagorpath"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDefer(t *testing.T) {
@@ -50,3 +55,42 @@ func TestDetachContext(t *testing.T) {
 	time.Sleep(time.Millisecond * 10)
 	assert.Equal(t, ctx.Err(), context.DeadlineExceeded)
 }
+
+func TestParamsContext(t *testing.T) {
+	_, ok := GetParams(context.Background())
+	assert.False(t, ok)
+
+	var params []imagorpath.Params
+	var l sync.Mutex
+	app := New(
+		WithUnsafe(true),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("foo")), nil
+		})),
+		WithStorages(saverFunc(func(ctx context.Context, image string, blob *Blob) error {
+			p, _ := GetParams(ctx)
+			l.Lock()
+			params = append(params, p)
+			l.Unlock()
+			return nil
+		})),
+		WithResultStorages(saverFunc(func(ctx context.Context, image string, blob *Blob) error {
+			p, _ := GetParams(ctx)
+			l.Lock()
+			params = append(params, p)
+			l.Unlock()
+			return nil
+		})),
+	)
+	w := httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/fit-in/100x100/foo.jpg", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	time.Sleep(time.Millisecond * 10)
+	l.Lock()
+	defer l.Unlock()
+	require.Len(t, params, 2)
+	for _, p := range params {
+		assert.Equal(t, "foo.jpg", p.Image)
+		assert.Equal(t, "fit-in/100x100/foo.jpg", p.Path)
+	}
+}
@@ -0,0 +1,117 @@
+package imagor
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/cshum/imagor/imagorpath"
+)
+
+// diffThreshold default channel difference threshold of mismatched pixels
+const diffThreshold = 0.1
+
+// Differ optional Processor interface for comparing pixels of images, required for the diff endpoint
+type Differ interface {
+	// Diff compares pixels of image b against image a,
+	// pixels of which any channel differs by more than threshold of the range are mismatched.
+	// Visual diff image highlighting mismatched pixels is returned if visual
+	Diff(ctx context.Context, a, b *Blob, threshold float64, visual bool) (*DiffResult, *Blob, error)
+}
+
+// DiffResult pixel difference metrics of images
+type DiffResult struct {
+	Images         [2]string `json:"images"`
+	Width          int       `json:"width"`
+	Height         int       `json:"height"`
+	Resized        bool      `json:"resized,omitempty"`
+	PSNR           float64   `json:"psnr"`
+	SSIM           float64   `json:"ssim"`
+	Threshold      float64   `json:"threshold"`
+	Mismatch       float64   `json:"mismatch"`
+	MismatchPixels int       `json:"mismatch_pixels"`
+}
+
+// handleDiffRequest handles GET /diff/{hash}/{image}/{image} requests,
+// responding pixel difference metrics of the images, or visual diff image with ?output=image.
+// Images are image keys, optionally with imagor params e.g. fit-in/500x500/image.jpg
+func (app *Imagor) handleDiffRequest(w http.ResponseWriter, r *http.Request, images [2]string) {
+	query := r.URL.Query()
+	threshold := diffThreshold
+	if s := query.Get("threshold"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f < 0 || f > 1 {
+			app.handleJSONError(w, r, ErrInvalid)
+			return
+		}
+		threshold = f
+	}
+	output := query.Get("output")
+	if output != "" && output != "json" && output != "image" {
+		app.handleJSONError(w, r, ErrInvalid)
+		return
+	}
+	var differ Differ
+	for _, processor := range app.Processors {
+		if d, ok := processor.(Differ); ok {
+			differ = d
+			break
+		}
+	}
+	if differ == nil {
+		app.handleJSONError(w, r, ErrDiffUnsupported)
+		return
+	}
+	var blobs [2]*Blob
+	for i, image := range images {
+		var err error
+		if blobs[i], err = app.diffImage(r, image); err != nil {
+			app.handleJSONError(w, r, err)
+			return
+		}
+	}
+	ctx := r.Context()
+	if app.sema != nil {
+		if err := app.sema.Acquire(ctx, 1); err != nil {
+			app.handleJSONError(w, r, err)
+			return
+		}
+		defer app.sema.Release(1)
+	}
+	res, blob, err := differ.Diff(ctx, blobs[0], blobs[1], threshold, output == "image")
+	if err != nil {
+		app.handleJSONError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if output == "image" && blob != nil {
+		reader, size, err := blob.NewReader()
+		if err != nil {
+			app.handleJSONError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", blob.ContentType())
+		writeBody(w, r, reader, size)
+		return
+	}
+	res.Images = images
+	res.Threshold = threshold
+	writeJSON(w, r, res)
+}
+
+// diffImage processes image path of the diff request,
+// image key without params is loaded as is
+func (app *Imagor) diffImage(r *http.Request, path string) (*Blob, error) {
+	p := imagorpath.Parse(path)
+	if p.Image == "" {
+		return nil, ErrInvalid
+	}
+	if imagorpath.GeneratePath(p) == imagorpath.GeneratePath(imagorpath.Params{Image: p.Image}) {
+		p.Filters = append(p.Filters, imagorpath.Filter{Name: "raw"})
+	}
+	// request signature already verified, path regenerated for the image
+	p.Meta = false
+	p.Path = ""
+	p.Hash = ""
+	return checkBlob(app.Do(r, p))
+}
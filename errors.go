@@ -23,6 +23,8 @@ var (
 	ErrSourceNotAllowed = NewError("http source not allowed", http.StatusForbidden)
 	// ErrSignatureMismatch URL signature mismatch error
 	ErrSignatureMismatch = NewError("url signature mismatch", http.StatusForbidden)
+	// ErrScopeMismatch URL referer or client IP scope mismatch error
+	ErrScopeMismatch = NewError("url scope mismatch", http.StatusForbidden)
 	// ErrTimeout timeout error
 	ErrTimeout = NewError("timeout", http.StatusRequestTimeout)
 	// ErrExpired expire error
@@ -35,6 +37,10 @@ var (
 	ErrMaxResolutionExceeded = NewError("maximum resolution exceeded", http.StatusUnprocessableEntity)
 	// ErrTooManyRequests too many requests error
 	ErrTooManyRequests = NewError("too many requests", http.StatusTooManyRequests)
+	// ErrPerceptualHashUnsupported perceptual hash not supported by processors error
+	ErrPerceptualHashUnsupported = NewError("perceptual hash not supported", http.StatusNotImplemented)
+	// ErrDiffUnsupported image diff not supported by processors error
+	ErrDiffUnsupported = NewError("image diff not supported", http.StatusNotImplemented)
 	// ErrInternal internal error
 	ErrInternal = NewError("internal error", http.StatusInternalServerError)
 )
@@ -0,0 +1,104 @@
+package imagor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// FallbackImage fallback image served on source errors,
+// matched by request bucket and image path prefix
+type FallbackImage struct {
+	// Bucket request AWS-BUCKET tenant to match, match all if empty
+	Bucket string `json:"bucket,omitempty"`
+
+	// Prefix image path prefix to match, match all if empty
+	Prefix string `json:"prefix,omitempty"`
+
+	// Image fallback image key, loaded from Storages and Loaders
+	Image string `json:"image"`
+}
+
+// ParseFallbackImages parses FallbackImage list from JSON array
+func ParseFallbackImages(data []byte) (images []FallbackImage, err error) {
+	if err = json.Unmarshal(data, &images); err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		if strings.TrimSpace(image.Image) == "" {
+			return nil, errors.New("imagor: fallback image is required")
+		}
+	}
+	return images, nil
+}
+
+// fallbackImage returns the first fallback image matching the request bucket and image
+func (app *Imagor) fallbackImage(ctx context.Context, image string) (string, bool) {
+	bucket, _ := ctx.Value("aws-bucket").(string)
+	image = strings.TrimPrefix(image, "/")
+	for _, fallback := range app.FallbackImages {
+		if fallback.Bucket != "" && fallback.Bucket != bucket {
+			continue
+		}
+		if !strings.HasPrefix(image, strings.TrimPrefix(fallback.Prefix, "/")) {
+			continue
+		}
+		return fallback.Image, true
+	}
+	return "", false
+}
+
+// isSourceError returns if error is caused by a missing, invalid or timed out source
+func isSourceError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	e := WrapError(err)
+	switch {
+	case e.Code == http.StatusNotFound,
+		e.Code == http.StatusNotAcceptable,
+		e.Code == http.StatusUnprocessableEntity,
+		e.Timeout():
+		return true
+	}
+	return e.Code >= http.StatusInternalServerError
+}
+
+// serveFallback serves the fallback image processed with params of the request on source error,
+// returns false if no fallback image served
+func (app *Imagor) serveFallback(w http.ResponseWriter, r *http.Request, err error) bool {
+	if len(app.FallbackImages) == 0 || !isSourceError(err) {
+		return false
+	}
+	p := app.parseRequest(r)
+	if p.Image == "" || p.Params {
+		return false
+	}
+	image, ok := app.fallbackImage(r.Context(), p.Image)
+	if !ok || image == p.Image {
+		return false
+	}
+	// request signature already verified, path regenerated for the fallback image
+	p.Image = image
+	p.Path = ""
+	p.Hash = ""
+	blob, e := checkBlob(app.Do(r, p))
+	if e != nil || isBlobEmpty(blob) {
+		app.withContextLogger(r.Context()).Warn("fallback",
+			zap.String("image", image),
+			zap.Error(e))
+		return false
+	}
+	app.setResponseHeaders(w, r, blob, p)
+	w.Header().Del("Expires")
+	w.Header().Del("Cache-Control")
+	setCacheHeaders(w, r, app.FallbackCacheTTL, 0)
+	w.Header().Set("Imagor-Fallback", "1")
+	reader, size, _ := blob.NewReader()
+	writeBody(w, r, reader, size)
+	return true
+}
@@ -10,12 +10,14 @@ import (
 	"net/url"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cshum/imagor/imagorpath"
+	"github.com/cshum/imagor/imgixpath"
 	"github.com/cshum/imagor/metrics/instrumentation"
 	"go.uber.org/zap"
 	"golang.org/x/sync/semaphore"
@@ -50,6 +52,19 @@ type Stater interface {
 	Stat(ctx context.Context, key string) (*Stat, error)
 }
 
+// Lifecycle optional interface for loaders and storages with startup and shutdown lifecycle,
+// called along with Imagor Startup and Shutdown
+type Lifecycle interface {
+	Startup(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+}
+
+// BucketResolver optional interface for loaders resolving the request bucket,
+// returns false if the request bucket is not allowed
+type BucketResolver interface {
+	ResolveBucket(ctx context.Context) (string, bool)
+}
+
 // LoadFunc function handler for Processor to call loader
 type LoadFunc func(string) (*Blob, error)
 
@@ -71,6 +86,8 @@ type Processor interface {
 type Imagor struct {
 	Unsafe                 bool
 	Signer                 imagorpath.Signer
+	TenantSigners          map[string]imagorpath.Signer
+	ClientIP               func(r *http.Request) string
 	StoragePathStyle       imagorpath.StorageHasher
 	ResultStoragePathStyle imagorpath.ResultStorageHasher
 	BasePathRedirect       string
@@ -89,10 +106,26 @@ type Imagor struct {
 	AutoWebP               bool
 	AutoAVIF               bool
 	AutoJPEG               bool
+	AutoFormats            []string
+	ClientHints            bool
+	MaxDPR                 float64
+	SaveDataQuality        int
 	ModifiedTimeCheck      bool
+	ResultStorageSWR       time.Duration
+	RevalidateConcurrency  int64
 	DisableErrorBody       bool
 	DisableParamsEndpoint  bool
 	EnablePostRequests     bool
+	ImgixMode              bool
+	ResultIndex            bool
+	EnablePurgeEndpoint    bool
+	EnableCompareEndpoint  bool
+	EnableDiffEndpoint     bool
+	NegativeCacheTTL       time.Duration
+	NegativeCacheSize      int
+	FallbackImages         []FallbackImage
+	FallbackCacheTTL       time.Duration
+	Presets                imagorpath.Presets
 	BaseParams             string
 	Logger                 *zap.Logger
 	Debug                  bool
@@ -101,7 +134,9 @@ type Imagor struct {
 	g          singleflight.Group
 	sema       *semaphore.Weighted
 	queueSema  *semaphore.Weighted
+	swrSema    *semaphore.Weighted
 	baseParams imagorpath.Params
+	notFound   *negativeCache
 }
 
 // New create new Imagor
@@ -114,14 +149,27 @@ func New(options ...Option) *Imagor {
 		ProcessTimeout: time.Second * 20,
 		CacheHeaderTTL: time.Hour * 24 * 7,
 		CacheHeaderSWR: time.Hour * 24,
+
+		AutoFormats:     []string{"avif", "webp", "jpeg"},
+		MaxDPR:          3,
+		SaveDataQuality: 50,
+
+		NegativeCacheSize: 10000,
+		FallbackCacheTTL:  time.Minute,
 	}
 	for _, option := range options {
 		option(app)
 	}
+	if app.NegativeCacheTTL > 0 && app.NegativeCacheSize > 0 {
+		app.notFound = newNegativeCache(app.NegativeCacheTTL, app.NegativeCacheSize)
+	}
 	if app.ProcessConcurrency > 0 {
 		app.sema = semaphore.NewWeighted(app.ProcessConcurrency)
 		app.queueSema = semaphore.NewWeighted(app.ProcessQueueSize + app.ProcessConcurrency)
 	}
+	if app.RevalidateConcurrency > 0 {
+		app.swrSema = semaphore.NewWeighted(app.RevalidateConcurrency)
+	}
 	if app.Debug {
 		app.debugLog()
 	}
@@ -143,6 +191,16 @@ func (app *Imagor) withContextLogger(ctx context.Context) *zap.Logger {
 	return app.Logger
 }
 
+// signer returns URL signature signer of the request AWS-BUCKET tenant if any, or the default signer
+func (app *Imagor) signer(ctx context.Context) imagorpath.Signer {
+	if bucket, ok := ctx.Value("aws-bucket").(string); ok && bucket != "" {
+		if signer, ok := app.TenantSigners[bucket]; ok {
+			return signer
+		}
+	}
+	return app.Signer
+}
+
 // NewMethodTimer creates a new method timer for instrumentation
 func (app *Imagor) NewMethodTimer(identifier string) *instrumentation.MethodTimer {
 	if app.Instrumentation == nil {
@@ -158,11 +216,21 @@ func (app *Imagor) Startup(ctx context.Context) (err error) {
 			return
 		}
 	}
+	for _, lifecycle := range app.lifecycles() {
+		if err = lifecycle.Startup(ctx); err != nil {
+			return
+		}
+	}
 	return
 }
 
 // Shutdown Imagor shutdown lifecycle
 func (app *Imagor) Shutdown(ctx context.Context) (err error) {
+	for _, lifecycle := range app.lifecycles() {
+		if err = lifecycle.Shutdown(ctx); err != nil {
+			return
+		}
+	}
 	for _, processor := range app.Processors {
 		if err = processor.Shutdown(ctx); err != nil {
 			return
@@ -171,8 +239,31 @@ func (app *Imagor) Shutdown(ctx context.Context) (err error) {
 	return
 }
 
+// lifecycles returns distinct loaders and storages implementing Lifecycle
+func (app *Imagor) lifecycles() (lifecycles []Lifecycle) {
+	add := func(v any) {
+		if lifecycle, ok := v.(Lifecycle); ok && !slices.Contains(lifecycles, lifecycle) {
+			lifecycles = append(lifecycles, lifecycle)
+		}
+	}
+	for _, loader := range app.Loaders {
+		add(loader)
+	}
+	for _, storage := range app.Storages {
+		add(storage)
+	}
+	for _, storage := range app.ResultStorages {
+		add(storage)
+	}
+	return
+}
+
 // ServeHTTP implements http.Handler for imagor operations
 func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete && app.EnablePurgeEndpoint {
+		app.handlePurgeRequest(w, r)
+		return
+	}
 	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -188,6 +279,14 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	path := r.URL.EscapedPath()
+	if app.EnableCompareEndpoint && isPairRequest(path, "compare") {
+		app.handlePairRequest(w, r, "compare", app.handleCompareRequest)
+		return
+	}
+	if app.EnableDiffEndpoint && isPairRequest(path, "diff") {
+		app.handlePairRequest(w, r, "diff", app.handleDiffRequest)
+		return
+	}
 	if path == "/" || path == "" {
 		if app.BasePathRedirect == "" {
 			renderLandingPage(w)
@@ -197,25 +296,33 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if this is a GET request to a processing path with no image
-	p := imagorpath.Parse(path)
-	if p.Image == "" && !p.Params && app.EnablePostRequests && app.Unsafe {
-		// Show upload form for processing paths when POST requests are enabled
-		renderUploadForm(w, path)
-		return
-	}
-	if p.Params {
-		if !app.DisableParamsEndpoint {
-			writeJSONIndent(w, r, p)
+	var p imagorpath.Params
+	var blob *Blob
+	var err error
+	if app.ImgixMode {
+		p = imgixpath.Parse(path, r.URL.Query())
+		blob, err = checkBlob(app.Do(r, p))
+	} else {
+		// Check if this is a GET request to a processing path with no image
+		p = imagorpath.Parse(path)
+		if p.Image == "" && !p.Params && app.EnablePostRequests && app.Unsafe {
+			// Show upload form for processing paths when POST requests are enabled
+			renderUploadForm(w, path)
+			return
 		}
-		return
-	}
-	blob, err := checkBlob(app.Do(r, p))
-	if err == ErrInvalid || err == ErrSignatureMismatch {
-		if path2, e := url.QueryUnescape(path); e == nil {
-			path = path2
-			p = imagorpath.Parse(path)
-			blob, err = checkBlob(app.Do(r, p))
+		if p.Params {
+			if !app.DisableParamsEndpoint {
+				app.handleParamsRequest(w, r, p)
+			}
+			return
+		}
+		blob, err = checkBlob(app.Do(r, p))
+		if err == ErrInvalid || err == ErrSignatureMismatch {
+			if path2, e := url.QueryUnescape(path); e == nil {
+				path = path2
+				p = imagorpath.Parse(path)
+				blob, err = checkBlob(app.Do(r, p))
+			}
 		}
 	}
 	if err != nil {
@@ -235,6 +342,24 @@ func (app *Imagor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// handleParamsRequest writes params of the path with presets expanded,
+// or the presets if no path specified
+func (app *Imagor) handleParamsRequest(w http.ResponseWriter, r *http.Request, p imagorpath.Params) {
+	if p.Path == "" && len(app.Presets) > 0 {
+		writeJSONIndent(w, r, map[string]imagorpath.Presets{"presets": app.Presets})
+		return
+	}
+	if len(p.Presets) > 0 {
+		var err error
+		if p, err = app.Presets.Expand(p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, r, NewError(err.Error(), http.StatusBadRequest))
+			return
+		}
+	}
+	writeJSONIndent(w, r, p)
+}
+
 // Serve serves imagor by context and params
 func (app *Imagor) Serve(ctx context.Context, p imagorpath.Params) (*Blob, error) {
 	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
@@ -265,29 +390,39 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 	if timer != nil {
 		defer timer.ObserveDuration(ctx)
 	}
+	var params = p // params as requested for background revalidation
 	var cancel func()
 	if app.RequestTimeout > 0 {
 		ctx, cancel = context.WithTimeout(ctx, app.RequestTimeout)
 		contextDefer(ctx, cancel)
 		r = r.WithContext(ctx)
 	}
-	if !(app.Unsafe && p.Unsafe) && app.Signer != nil && p.Path != "" {
-		if hash := app.Signer.Sign(p.Path); hash != p.Hash {
+	if signer := app.signer(ctx); !(app.Unsafe && p.Unsafe) && signer != nil && p.Path != "" {
+		if !imagorpath.Verify(signer, p.Path, p.Hash) {
 			err = ErrSignatureMismatch
 			if app.Debug {
 				app.withContextLogger(ctx).Debug("sign-mismatch",
 					zap.Any("params", p),
-					zap.String("expected", hash))
+					zap.String("expected", signer.Sign(p.Path)))
 			}
 			return
 		}
 	}
 	var isPathChanged bool
+	if len(p.Presets) > 0 {
+		// signature is of the requested path, presets expanded afterwards
+		if p, err = app.Presets.Expand(p); err != nil {
+			err = NewError(err.Error(), http.StatusBadRequest)
+			return
+		}
+		isPathChanged = true
+	}
 	if app.BaseParams != "" {
 		p = imagorpath.Apply(p, app.BaseParams)
 		isPathChanged = true
 	}
 	var hasFormat, hasPreview, isRaw bool
+	var dpr float64
 	var filters = p.Filters
 	p.Filters = nil
 
@@ -302,8 +437,30 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 				}
 				r.Header.Set("Cache-Control", "private")
 			}
+		case "referer":
+			// referer(host,...) filter
+			if !isRefererAllowed(r, f.Args) {
+				err = ErrScopeMismatch
+				return
+			}
+			r.Header.Set("Cache-Control", "private")
+		case "ip":
+			// ip(cidr,...) filter
+			if !app.isClientIPAllowed(r, f.Args) {
+				err = ErrScopeMismatch
+				return
+			}
+			r.Header.Set("Cache-Control", "private")
+		case "dpr":
+			dpr = parseDPR(f.Args)
 		case "format":
 			hasFormat = true
+			if f.Args == "auto" {
+				// format(auto) negotiated by Accept header, smallest output picked by processor
+				f.Args = app.autoFormatArgs(r)
+				r.Header.Set("Imagor-Auto-Format", "auto") // response Vary: Accept header
+				isPathChanged = true
+			}
 		case "raw":
 			r.Header.Set("Imagor-Raw", "1")
 			isRaw = true
@@ -313,12 +470,18 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 		}
 		// exclude utility filters from result path
 		switch f.Name {
-		case "expire", "attachment":
+		case "expire", "attachment", "referer", "ip", "dpr":
 			isPathChanged = true
 		default:
 			p.Filters = append(p.Filters, f)
 		}
 	}
+	if dpr > 0 || app.ClientHints {
+		var changed bool
+		if p, changed = app.applyClientHints(r, p, dpr); changed {
+			isPathChanged = true
+		}
+	}
 	// auto WebP / AVIF / JPEG
 	if !hasFormat && (app.AutoWebP || app.AutoAVIF || app.AutoJPEG) {
 		accept := r.Header.Get("Accept")
@@ -368,9 +531,13 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 		blob, _, err := app.loadStorage(r, image)
 		return blob, err
 	}
+	ctx = WithParams(ctx, p)
 	return app.suppress(ctx, resultKey, func(ctx context.Context, cb func(*Blob, error)) (*Blob, error) {
-		if resultKey != "" && !isRaw {
-			if blob := app.loadResult(r, resultKey, p.Image); blob != nil {
+		if resultKey != "" && !isRaw && !isRevalidating(ctx) {
+			if blob, isStale := app.loadResult(r, resultKey, p.Image); blob != nil {
+				if isStale {
+					app.revalidate(r, resultKey, params)
+				}
 				return blob, nil
 			}
 		}
@@ -473,6 +640,9 @@ func (app *Imagor) Do(r *http.Request, p imagorpath.Params) (blob *Blob, err err
 		if err == nil && !isBlobEmpty(blob) && resultKey != "" && !isRaw &&
 			len(app.ResultStorages) > 0 {
 			app.save(ctx, app.ResultStorages, resultKey, blob)
+			if app.ResultIndex {
+				app.saveResultIndex(ctx, p.Image, resultKey)
+			}
 		}
 		if err != nil && shouldSave {
 			var storageKey = p.Image
@@ -541,7 +711,9 @@ func (app *Imagor) requestWithLoadContext(r *http.Request) *http.Request {
 	return r
 }
 
-func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string) *Blob {
+// loadResult loads result from result storages, isStale if the stale result is served
+// within the result storage stale-while-revalidate window
+func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string) (_ *Blob, isStale bool) {
 	timer := app.NewMethodTimer("Imagor.loadResult")
 	r = app.requestWithLoadContext(r)
 	ctx := r.Context()
@@ -585,7 +757,12 @@ func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string) *Blob
 						zap.String("image_key", imageKey))
 				}
 				if !blob.Stat.ModifiedTime.Before(sourceStat.ModifiedTime) {
-					return blob
+					return blob, false
+				}
+				if app.ResultStorageSWR > 0 &&
+					time.Since(sourceStat.ModifiedTime) <= app.ResultStorageSWR {
+					// serve stale result within max staleness, revalidate in background
+					return blob, true
 				}
 			} else {
 				if app.Debug {
@@ -596,7 +773,7 @@ func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string) *Blob
 				}
 				// If we can't stat the source, use the cached result
 				// This handles cases where source is in loader but not storage
-				return blob
+				return blob, false
 			}
 		} else {
 			if app.Debug && app.ModifiedTimeCheck {
@@ -605,10 +782,44 @@ func (app *Imagor) loadResult(r *http.Request, resultKey, imageKey string) *Blob
 					zap.Bool("has_blob_stat", blob.Stat != nil),
 					zap.String("result_key", resultKey))
 			}
-			return blob
+			return blob, false
 		}
 	}
-	return nil
+	return nil, false
+}
+
+// revalidate re-processes stale result and saves to result storages in background,
+// deduplicated by result key and bounded by revalidate concurrency
+func (app *Imagor) revalidate(r *http.Request, resultKey string, p imagorpath.Params) {
+	if app.swrSema != nil && !app.swrSema.TryAcquire(1) {
+		if app.Debug {
+			app.withContextLogger(r.Context()).Debug("revalidate-skipped",
+				zap.String("result_key", resultKey))
+		}
+		return
+	}
+	// new imagor context detached from the request, keeping the request values
+	ctx := context.WithValue(detachContext(r.Context()), imagorContextKey, (*imagorContextRef)(nil))
+	ctx = context.WithValue(ctx, revalidateContextKey, true)
+	ctx, cancel := context.WithCancel(ctx)
+	r = r.Clone(ctx)
+	go func() {
+		defer cancel()
+		if app.swrSema != nil {
+			defer app.swrSema.Release(1)
+		}
+		_, err, _ := app.g.Do("revalidate:"+resultKey, func() (interface{}, error) {
+			return checkBlob(app.Do(r, p))
+		})
+		if err != nil {
+			app.withContextLogger(ctx).Warn("revalidate",
+				zap.String("result_key", resultKey),
+				zap.Error(err))
+		} else if app.Debug {
+			app.withContextLogger(ctx).Debug("revalidated",
+				zap.String("result_key", resultKey))
+		}
+	}()
 }
 
 func fromStorages(
@@ -676,6 +887,11 @@ func (app *Imagor) fromStoragesAndLoaders(
 	if app.StoragePathStyle != nil {
 		storageKey = app.StoragePathStyle.Hash(image)
 	}
+	if storageKey != "" && app.notFound != nil && app.notFound.Has(app.negativeCacheKey(r.Context(), storageKey)) {
+		app.recordNegativeCache(r.Context(), "hit")
+		err = ErrNotFound
+		return
+	}
 	if storageKey != "" {
 		blob, origin, err = fromStorages(r, storages, storageKey)
 		if !isBlobEmpty(blob) && origin != nil && err == nil {
@@ -696,9 +912,68 @@ func (app *Imagor) fromStoragesAndLoaders(
 	if err == nil && isBlobEmpty(blob) {
 		err = ErrNotFound
 	}
+	if storageKey != "" && app.notFound != nil && errors.Is(err, ErrNotFound) {
+		if app.notFound.Set(app.negativeCacheKey(r.Context(), storageKey)) {
+			app.recordNegativeCache(r.Context(), "store")
+		}
+	}
 	return
 }
 
+// InvalidateNotFound invalidates not found cache of the image saved into storage outside of imagor,
+// e.g. fallback loader backfill or migration
+func (app *Imagor) InvalidateNotFound(ctx context.Context, image string) {
+	if app.notFound == nil || image == "" {
+		return
+	}
+	var storageKey = image
+	if app.StoragePathStyle != nil {
+		storageKey = app.StoragePathStyle.Hash(image)
+	}
+	app.notFound.Delete(app.negativeCacheKey(ctx, storageKey))
+}
+
+// bucketResolver returns the first loader implementing BucketResolver, nil if none
+func (app *Imagor) bucketResolver() BucketResolver {
+	for _, loader := range app.Loaders {
+		if resolver, ok := loader.(BucketResolver); ok {
+			return resolver
+		}
+	}
+	return nil
+}
+
+// negativeCacheKey returns not found cache key scoped by the bucket resolved by the loaders,
+// or the request bucket as is without resolver
+func (app *Imagor) negativeCacheKey(ctx context.Context, key string) string {
+	bucket, _ := ctx.Value("aws-bucket").(string)
+	if resolver := app.bucketResolver(); resolver != nil {
+		resolved, ok := resolver.ResolveBucket(ctx)
+		if !ok {
+			// unresolved request bucket scoped apart from resolved buckets
+			return "?" + bucket + ":" + key
+		}
+		bucket = resolved
+	}
+	return bucket + ":" + key
+}
+
+// recordNegativeCache records negative cache metrics labelled by the bucket resolved by the loaders,
+// "other" if the request bucket is not resolved
+func (app *Imagor) recordNegativeCache(ctx context.Context, status string) {
+	if app.Instrumentation == nil {
+		return
+	}
+	var bucket string
+	if resolver := app.bucketResolver(); resolver != nil {
+		var ok bool
+		if bucket, ok = resolver.ResolveBucket(ctx); !ok {
+			bucket = "other"
+		}
+	}
+	app.Instrumentation.RecordNegativeCache(bucket, status)
+}
+
 func (app *Imagor) storageStat(ctx context.Context, key string) (stat *Stat, err error) {
 	for _, storage := range app.Storages {
 		if stat, err = storage.Stat(ctx, key); stat != nil && err == nil {
@@ -728,6 +1003,10 @@ func (app *Imagor) save(ctx context.Context, storages []Storage, key string, blo
 	if key == "" {
 		return
 	}
+	if app.notFound != nil {
+		// key saved no longer not found
+		app.notFound.Delete(app.negativeCacheKey(ctx, key))
+	}
 	if app.SaveTimeout > 0 {
 		var cancel func()
 		ctx, cancel = context.WithTimeout(ctx, app.SaveTimeout)
@@ -846,6 +1125,9 @@ func (app *Imagor) setResponseHeaders(w http.ResponseWriter, r *http.Request, bl
 	if r.Header.Get("Imagor-Auto-Format") != "" {
 		w.Header().Add("Vary", "Accept")
 	}
+	if app.ClientHints {
+		setClientHintsHeaders(w)
+	}
 	if r.Header.Get("Imagor-Raw") != "" {
 		w.Header().Set("Content-Security-Policy", "script-src 'none'")
 	}
@@ -865,9 +1147,8 @@ func (app *Imagor) handleErrorResponse(w http.ResponseWriter, r *http.Request, e
 	e := WrapError(err)
 
 	// For non-404 errors, try to return original image from storage with no-cache headers
-	if e.Code != http.StatusNotFound {
-		path := r.URL.EscapedPath()
-		p := imagorpath.Parse(path)
+	if e.Code != http.StatusNotFound && !isAccessError(err) {
+		p := app.parseRequest(r)
 		if p.Image != "" {
 			originalBlob, _, loadErr := app.fromStoragesAndLoaders(r, app.Storages, app.Loaders, p.Image)
 			if loadErr == nil && !isBlobEmpty(originalBlob) {
@@ -880,6 +1161,9 @@ func (app *Imagor) handleErrorResponse(w http.ResponseWriter, r *http.Request, e
 			}
 		}
 	}
+	if app.serveFallback(w, r, err) {
+		return
+	}
 
 	if app.DisableErrorBody {
 		w.WriteHeader(e.Code)
@@ -889,6 +1173,14 @@ func (app *Imagor) handleErrorResponse(w http.ResponseWriter, r *http.Request, e
 	writeJSON(w, r, e)
 }
 
+// parseRequest parses imagorpath.Params from request path, or from imgix query string on imgix mode
+func (app *Imagor) parseRequest(r *http.Request) imagorpath.Params {
+	if app.ImgixMode {
+		return imgixpath.Parse(r.URL.EscapedPath(), r.URL.Query())
+	}
+	return imagorpath.Parse(r.URL.EscapedPath())
+}
+
 func (app *Imagor) debugLog() {
 	if !app.Debug {
 		return
@@ -909,6 +1201,7 @@ func (app *Imagor) debugLog() {
 	app.Logger.Debug("imagor",
 		zap.String("version", Version),
 		zap.Bool("unsafe", app.Unsafe),
+		zap.Bool("imgix_mode", app.ImgixMode),
 		zap.Duration("request_timeout", app.RequestTimeout),
 		zap.Duration("load_timeout", app.LoadTimeout),
 		zap.Duration("process_timeout", app.ProcessTimeout),
@@ -996,6 +1289,56 @@ func getCacheControl(isPrivate bool, ttl, swr time.Duration) string {
 	return val
 }
 
+// verifyEndpoint verifies hash of the endpoint path, signed as endpoint name and path joined by colon
+// e.g. "purge:image.jpg", so that endpoint signatures are not interchangeable with image URL signatures
+func (app *Imagor) verifyEndpoint(r *http.Request, endpoint, path, hash string) bool {
+	return imagorpath.Verify(app.signer(r.Context()), endpoint+":"+path, hash)
+}
+
+// isPairRequest returns if path is of GET /{endpoint}/{hash}/{image}/{image} request
+func isPairRequest(path, endpoint string) bool {
+	return strings.HasPrefix(path, "/"+endpoint+"/")
+}
+
+// handlePairRequest handles GET /{endpoint}/{hash}/{image}/{image} requests,
+// signed with the endpoint signature of the images, e.g. "compare:a.jpg/b.jpg".
+// Images are path escaped image keys, unescaped for the handle func
+func (app *Imagor) handlePairRequest(
+	w http.ResponseWriter, r *http.Request, endpoint string,
+	handle func(w http.ResponseWriter, r *http.Request, images [2]string),
+) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/"+endpoint+"/")
+	hash, path, _ := strings.Cut(path, "/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		app.handleJSONError(w, r, ErrInvalid)
+		return
+	}
+	if !(app.Unsafe && hash == "unsafe") && !app.verifyEndpoint(r, endpoint, path, hash) {
+		app.handleJSONError(w, r, ErrSignatureMismatch)
+		return
+	}
+	var images [2]string
+	for i, part := range parts {
+		image, err := url.PathUnescape(part)
+		if err != nil {
+			app.handleJSONError(w, r, ErrInvalid)
+			return
+		}
+		images[i] = image
+	}
+	handle(w, r, images)
+}
+
+// handleJSONError writes error response of the JSON endpoints
+func (app *Imagor) handleJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	e := WrapError(err)
+	w.WriteHeader(e.Code)
+	if !app.DisableErrorBody {
+		writeJSON(w, r, e)
+	}
+}
+
 func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
 	buf, _ := json.Marshal(v)
 	w.Header().Set("Content-Type", "application/json")
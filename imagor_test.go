@@ -11,12 +11,16 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/cshum/imagor/imagorpath"
+	"github.com/cshum/imagor/metrics/instrumentation"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
@@ -727,6 +731,17 @@ func (s *mapStore) Delete(ctx context.Context, image string) error {
 	return nil
 }
 
+func (s *mapStore) List(ctx context.Context, prefix string) (keys []string, err error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	for key := range s.Map {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
 func (s *mapStore) Stat(ctx context.Context, image string) (*Stat, error) {
 	s.l.RLock()
 	defer s.l.RUnlock()
@@ -1325,6 +1340,62 @@ func TestWithModifiedTimeCheck(t *testing.T) {
 	assert.Equal(t, 2, resultStore.SaveCnt["foo"])
 }
 
+func TestWithResultStorageSWR(t *testing.T) {
+	store := newMapStore()
+	resultStore := newMapStore()
+	app := New(
+		WithDebug(true), WithLogger(zap.NewExample()),
+		WithStorages(store),
+		WithResultStorages(resultStore),
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte("v1")), nil
+		})),
+		WithUnsafe(true),
+		WithModifiedTimeCheck(true),
+		WithResultStorageSWR(time.Hour),
+		WithRevalidateConcurrency(1),
+	)
+	request := func() string {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/unsafe/foo", nil))
+		assert.Equal(t, 200, w.Code)
+		return w.Body.String()
+	}
+	assertSaveCnt := func(n int) {
+		assert.Eventually(t, func() bool {
+			resultStore.l.RLock()
+			defer resultStore.l.RUnlock()
+			return resultStore.SaveCnt["foo"] == n
+		}, time.Second, time.Millisecond)
+	}
+	replace := func(buf string, sourceTime, resultTime time.Time) {
+		require.NoError(t, store.Put(context.Background(), "foo", NewBlobFromBytes([]byte(buf))))
+		store.l.Lock()
+		store.ModTime["foo"] = sourceTime
+		store.l.Unlock()
+		resultStore.l.Lock()
+		resultStore.ModTime["foo"] = resultTime
+		resultStore.l.Unlock()
+	}
+	assert.Equal(t, "v1", request())
+	assertSaveCnt(1)
+
+	// stale within max staleness, serve stale result and revalidate in background
+	replace("v2", time.Now(), time.Now().Add(-time.Minute))
+	assert.Equal(t, "v1", request())
+	assertSaveCnt(2)
+	b, err := resultStore.Get(httptest.NewRequest(http.MethodGet, "/", nil), "foo")
+	require.NoError(t, err)
+	buf, _ := b.ReadAll()
+	assert.Equal(t, "v2", string(buf))
+
+	// stale beyond max staleness, process synchronously
+	replace("v3", time.Now().Add(-time.Hour*2), time.Now().Add(-time.Hour*3))
+	assert.Equal(t, "v3", request())
+	assertSaveCnt(3)
+}
+
 func TestWithSameStore(t *testing.T) {
 	store := newMapStore()
 	app := New(
@@ -1684,6 +1755,71 @@ func TestAutoFormatPrecedence(t *testing.T) {
 	})
 }
 
+func TestImgixMode(t *testing.T) {
+	resultStore := newMapStore()
+	factory := func(unsafe bool) *Imagor {
+		return New(
+			WithDebug(true),
+			WithUnsafe(unsafe),
+			WithImgixMode(true),
+			WithAutoWebP(true),
+			WithSigner(imagorpath.NewDefaultSigner("1234")),
+			WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+				if image == "foo/abc.png" {
+					return NewBlobFromBytes([]byte("foo")), nil
+				}
+				return nil, ErrNotFound
+			})),
+			WithResultStorages(resultStore),
+			WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+				return NewBlobFromBytes([]byte(p.Path)), nil
+			})),
+		)
+	}
+	t.Run("unsafe", func(t *testing.T) {
+		app := factory(true)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/foo/abc.png?w=300&h=200&fit=crop&q=60", nil))
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "300x200/filters:upscale():quality(60)/foo/abc.png", w.Body.String())
+		assert.Equal(t, 1, resultStore.SaveCnt["300x200/filters:upscale():quality(60)/foo/abc.png"])
+	})
+	t.Run("auto format", func(t *testing.T) {
+		app := factory(true)
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(
+			http.MethodGet, "https://example.com/foo/abc.png?w=300&auto=format", nil)
+		r.Header.Set("Accept", "image/webp,*/*")
+		app.ServeHTTP(w, r)
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		assert.Equal(t, "fit-in/300x0/filters:upscale():format(webp)/foo/abc.png", w.Body.String())
+	})
+	t.Run("signature required", func(t *testing.T) {
+		app := factory(false)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/foo/def.png?w=300", nil))
+		assert.Equal(t, 403, w.Code)
+		assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+
+		sig := imagorpath.NewDefaultSigner("1234").Sign("fit-in/300x0/filters:upscale()/foo/abc.png")
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/foo/abc.png?w=300&s="+url.QueryEscape(sig), nil))
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, "fit-in/300x0/filters:upscale()/foo/abc.png", w.Body.String())
+	})
+	t.Run("not found", func(t *testing.T) {
+		app := factory(true)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(
+			http.MethodGet, "https://example.com/bar.png?w=300", nil))
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
 func TestWithTimeout(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.URL.String(), "sleep") {
@@ -2013,9 +2149,706 @@ type processorFunc func(ctx context.Context, blob *Blob, p imagorpath.Params, lo
 func (f processorFunc) Process(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
 	return f(ctx, blob, p, load)
 }
+
+type lifecycleStore struct {
+	*mapStore
+	Started int
+	Stopped int
+}
+
+func (s *lifecycleStore) Startup(_ context.Context) error {
+	s.Started++
+	return nil
+}
+
+func (s *lifecycleStore) Shutdown(_ context.Context) error {
+	s.Stopped++
+	return nil
+}
+
+func TestWithLifecycle(t *testing.T) {
+	store := &lifecycleStore{mapStore: newMapStore()}
+	app := New(
+		WithLoaders(store),
+		WithStorages(store),
+		WithResultStorages(store),
+	)
+	require.NoError(t, app.Startup(context.Background()))
+	assert.Equal(t, 1, store.Started)
+	require.NoError(t, app.Shutdown(context.Background()))
+	assert.Equal(t, 1, store.Stopped)
+}
+
 func (f processorFunc) Startup(_ context.Context) error {
 	return nil
 }
 func (f processorFunc) Shutdown(_ context.Context) error {
 	return nil
 }
+
+func TestPurge(t *testing.T) {
+	newApp := func(options ...Option) (*Imagor, *mapStore, *mapStore) {
+		store := newMapStore()
+		resultStore := newMapStore()
+		app := New(append([]Option{
+			WithUnsafe(true),
+			WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+				return NewBlobFromBytes([]byte(image)), nil
+			})),
+			WithStorages(store),
+			WithResultStorages(resultStore),
+		}, options...)...)
+		for _, path := range []string{
+			"/unsafe/fit-in/100x100/foo.jpg",
+			"/unsafe/200x200/filters:format(webp)/foo.jpg",
+			"/unsafe/meta/foo.jpg",
+			"/unsafe/200x200/foo.png",
+			"/unsafe/200x200/bar.jpg",
+		} {
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+		time.Sleep(time.Millisecond * 10)
+		return app, store, resultStore
+	}
+	keys := func(s *mapStore) (keys []string) {
+		s.l.RLock()
+		defer s.l.RUnlock()
+		for key := range s.Map {
+			keys = append(keys, key)
+		}
+		return
+	}
+
+	t.Run("suffix path style", func(t *testing.T) {
+		app, store, resultStore := newApp(WithResultStoragePathStyle(imagorpath.SizeSuffixResultStorageHasher))
+		res, err := app.Purge(context.Background(), "foo.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo.jpg"}, res.Storages)
+		// results of same name with different extensions are not distinguishable
+		assert.Len(t, res.Results, 4)
+		assert.ElementsMatch(t, []string{"foo.png", "bar.jpg"}, keys(store))
+		assert.Len(t, keys(resultStore), 1)
+		assert.True(t, strings.HasPrefix(keys(resultStore)[0], "bar."))
+	})
+
+	t.Run("result index", func(t *testing.T) {
+		app, store, resultStore := newApp(
+			WithResultStoragePathStyle(imagorpath.DigestResultStorageHasher), WithResultIndex(true))
+		assert.Len(t, keys(resultStore), 10)
+		res, err := app.Purge(context.Background(), "foo.jpg")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"foo.jpg"}, res.Storages)
+		assert.Len(t, res.Results, 3)
+		assert.ElementsMatch(t, []string{"foo.png", "bar.jpg"}, keys(store))
+		assert.Len(t, keys(resultStore), 4)
+
+		res, err = app.Purge(context.Background(), "foo.jpg")
+		require.NoError(t, err)
+		assert.Empty(t, res.Storages)
+		assert.Empty(t, res.Results)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		app, store, resultStore := newApp(WithResultStoragePathStyle(imagorpath.DigestResultStorageHasher))
+		res, err := app.Purge(context.Background(), "foo.jpg")
+		assert.Error(t, err)
+		assert.Empty(t, res.Storages)
+		assert.Len(t, res.Errors, 1)
+		// nothing deleted
+		assert.ElementsMatch(t, []string{"foo.jpg", "foo.png", "bar.jpg"}, keys(store))
+		assert.Len(t, keys(resultStore), 5)
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		app, store, _ := newApp(
+			WithSigner(imagorpath.NewDefaultSigner("1234")),
+			WithResultStoragePathStyle(imagorpath.SuffixResultStorageHasher),
+		)
+		app.Unsafe = false
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "https://example.com/unsafe/purge/foo.jpg", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+		app.EnablePurgeEndpoint = true
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "https://example.com/unsafe/purge/foo.jpg", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// image URL signature of the same path is not a purge signature
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete,
+			"https://example.com/"+app.Signer.Sign("purge/foo.jpg")+"/purge/foo.jpg", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// refused in unsafe mode
+		app.Unsafe = true
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete,
+			"https://example.com/"+app.Signer.Sign("purge:foo.jpg")+"/purge/foo.jpg", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.ElementsMatch(t, []string{"foo.jpg", "foo.png", "bar.jpg"}, keys(store))
+
+		app.Unsafe = false
+		w = httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodDelete,
+			"https://example.com/"+app.Signer.Sign("purge:foo.jpg")+"/purge/foo.jpg", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var res PurgeResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.Equal(t, "foo.jpg", res.Image)
+		assert.Equal(t, []string{"foo.jpg"}, res.Storages)
+		assert.Len(t, res.Results, 4)
+		assert.ElementsMatch(t, []string{"foo.png", "bar.jpg"}, keys(store))
+	})
+}
+
+type bucketLoader struct {
+	loaderFunc
+}
+
+func (l bucketLoader) ResolveBucket(ctx context.Context) (string, bool) {
+	switch bucket, _ := ctx.Value("aws-bucket").(string); bucket {
+	case "", "default":
+		return "default", true
+	}
+	return "", false
+}
+
+func TestWithNegativeCache(t *testing.T) {
+	store := newMapStore()
+	var loadCnt int64
+	app := New(
+		WithStorages(store),
+		WithLoaders(bucketLoader{func(r *http.Request, image string) (*Blob, error) {
+			atomic.AddInt64(&loadCnt, 1)
+			return nil, ErrNotFound
+		}}),
+		WithUnsafe(true),
+		WithNegativeCacheTTL(time.Millisecond*50),
+		WithInstrumentation(instrumentation.New(nil)),
+	)
+	counter := func(bucket, status string) float64 {
+		return testutil.ToFloat64(instrumentation.NegativeCacheCounter.WithLabelValues(bucket, status))
+	}
+	request := func(bucket string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/foo", nil)
+		if bucket != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "aws-bucket", bucket))
+		}
+		app.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNotFound, request(""))
+	assert.Equal(t, http.StatusNotFound, request(""))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&loadCnt))
+	assert.Equal(t, float64(1), counter("default", "store"))
+	assert.Equal(t, float64(1), counter("default", "hit"))
+
+	// keyed by resolved bucket
+	assert.Equal(t, http.StatusNotFound, request("default"))
+	assert.Equal(t, int64(1), atomic.LoadInt64(&loadCnt))
+	assert.Equal(t, float64(2), counter("default", "hit"))
+
+	// keyed by request bucket, labelled other if not resolved
+	assert.Equal(t, http.StatusNotFound, request("mybucket"))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&loadCnt))
+	assert.Equal(t, float64(1), counter("other", "store"))
+
+	// expired
+	time.Sleep(time.Millisecond * 60)
+	assert.Equal(t, http.StatusNotFound, request(""))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&loadCnt))
+
+	// purge invalidates
+	_, err := app.Purge(context.Background(), "foo")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "foo", NewBlobFromBytes([]byte("foo"))))
+	assert.Equal(t, http.StatusOK, request(""))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&loadCnt))
+
+	// saved outside of imagor invalidates by resolved bucket
+	require.NoError(t, store.Delete(context.Background(), "foo"))
+	assert.Equal(t, http.StatusNotFound, request(""))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&loadCnt))
+	require.NoError(t, store.Put(context.Background(), "foo", NewBlobFromBytes([]byte("foo"))))
+	assert.Equal(t, http.StatusNotFound, request(""))
+	app.InvalidateNotFound(context.WithValue(context.Background(), "aws-bucket", "default"), "foo")
+	assert.Equal(t, http.StatusOK, request(""))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&loadCnt))
+}
+
+func TestWithFallbackImages(t *testing.T) {
+	app := New(
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			if strings.HasPrefix(image, "placeholder") {
+				return NewBlobFromBytes([]byte(image)), nil
+			}
+			if image == "bad.jpg" {
+				return nil, ErrUnsupportedFormat
+			}
+			return nil, ErrNotFound
+		})),
+		WithSigner(imagorpath.NewDefaultSigner("1234")),
+		WithFallbackImages(
+			FallbackImage{Bucket: "mybucket", Prefix: "avatars/", Image: "placeholder-avatar.jpg"},
+			FallbackImage{Image: "placeholder.jpg"},
+		),
+		WithFallbackCacheTTL(time.Minute),
+	)
+	request := func(path, bucket string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		if bucket != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "aws-bucket", bucket))
+		}
+		app.ServeHTTP(w, r)
+		return w
+	}
+	signed := func(path string) string {
+		return "/" + app.Signer.Sign(path) + "/" + path
+	}
+	w := request(signed("100x100/foo.jpg"), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "placeholder.jpg", w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("Imagor-Fallback"))
+	assert.Equal(t, "public, s-maxage=60, max-age=60, no-transform", w.Header().Get("Cache-Control"))
+
+	w = request(signed("bad.jpg"), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "placeholder.jpg", w.Body.String())
+
+	w = request(signed("100x100/avatars/foo.jpg"), "mybucket")
+	assert.Equal(t, "placeholder-avatar.jpg", w.Body.String())
+	w = request(signed("100x100/avatars/foo.jpg"), "other")
+	assert.Equal(t, "placeholder.jpg", w.Body.String())
+
+	// no fallback on signature mismatch
+	w = request("/abcd/100x100/foo.jpg", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Imagor-Fallback"))
+
+	// no fallback if the fallback image itself is missing
+	app.FallbackImages = []FallbackImage{{Image: "missing.jpg"}}
+	w = request(signed("100x100/foo.jpg"), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Imagor-Fallback"))
+}
+
+func TestWithPresets(t *testing.T) {
+	presets, err := imagorpath.NewPresets(map[string]string{
+		"thumb": "fit-in/200x200/filters:format(webp)",
+	})
+	require.NoError(t, err)
+	resultStore := newMapStore()
+	app := New(
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithResultStorages(resultStore),
+		WithSigner(imagorpath.NewDefaultSigner("1234")),
+		WithPresets(presets),
+	)
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil))
+		return w
+	}
+	sign := func(path string) string {
+		return "/" + app.Signer.Sign(path) + "/" + path
+	}
+
+	w := request(sign("preset:thumb/foo.jpg"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "foo.jpg", w.Body.String())
+	time.Sleep(time.Millisecond * 10)
+	// result stored by expanded path
+	_, err = resultStore.Stat(context.Background(), "fit-in/200x200/filters:format(webp)/foo.jpg")
+	assert.NoError(t, err)
+
+	do := func(path string) error {
+		_, err := app.Do(httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil),
+			imagorpath.Parse(path))
+		return err
+	}
+	assert.Equal(t, http.StatusBadRequest, WrapError(do(sign("filters:preset(none)/foo.jpg"))).Code)
+	assert.Equal(t, ErrSignatureMismatch, do("/abcdefghijk/preset:thumb/foo.jpg"))
+
+	w = request("/params/preset:thumb/foo.jpg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var p imagorpath.Params
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.True(t, p.FitIn)
+	assert.Equal(t, 200, p.Width)
+	assert.Equal(t, []string{"thumb"}, p.Presets)
+
+	w = request("/params/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"presets":{"thumb":"fit-in/200x200/filters:format(webp)/"}}`, w.Body.String())
+}
+
+func TestWithTenantSigner(t *testing.T) {
+	signer, err := imagorpath.NewMultiKeySigner(false,
+		imagorpath.SignerKey{ID: "k2", Signer: imagorpath.NewDefaultSigner("new")},
+		imagorpath.SignerKey{ID: "k1", Signer: imagorpath.NewDefaultSigner("old")},
+	)
+	require.NoError(t, err)
+	app := New(
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithSigner(signer),
+		WithTenantSigner("mybucket", imagorpath.NewDefaultSigner("tenant")),
+	)
+	do := func(secret, bucket string) error {
+		path := "/" + imagorpath.Generate(imagorpath.Params{Image: "foo.jpg", Width: 100},
+			imagorpath.NewDefaultSigner(secret))
+		r := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		if bucket != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "aws-bucket", bucket))
+		}
+		_, err := app.Do(r, imagorpath.Parse(path))
+		return err
+	}
+	assert.NoError(t, do("new", ""))
+	assert.NoError(t, do("old", ""))
+	assert.Equal(t, ErrSignatureMismatch, do("tenant", ""))
+	assert.NoError(t, do("tenant", "mybucket"))
+	assert.Equal(t, ErrSignatureMismatch, do("new", "mybucket"))
+	assert.NoError(t, do("new", "otherbucket"))
+}
+
+func TestWithScopedSignedURL(t *testing.T) {
+	app := New(
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithSigner(imagorpath.NewDefaultSigner("1234")),
+		WithClientIP(func(r *http.Request) string {
+			return r.Header.Get("X-Real-Ip")
+		}),
+	)
+	request := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		path = "/" + app.Signer.Sign(path) + "/" + path
+		r := httptest.NewRequest(http.MethodGet, "https://example.com"+path, nil)
+		for key, val := range header {
+			r.Header.Set(key, val)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+	future := time.Now().Add(time.Hour).UnixMilli()
+	path := fmt.Sprintf("filters:expire(%d):referer(example.com,*.example.org):ip(10.0.0.0/8,1.2.3.4)/foo.jpg", future)
+
+	w := request(path, map[string]string{"Origin": "https://example.com", "X-Real-Ip": "10.1.2.3"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "foo.jpg", w.Body.String())
+	assert.Contains(t, w.Header().Get("Cache-Control"), "private")
+
+	w = request(path, map[string]string{"Referer": "https://a.example.org/page", "X-Real-Ip": "1.2.3.4"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(path, map[string]string{"Referer": "https://evil.com/", "X-Real-Ip": "10.1.2.3"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrScopeMismatch), w.Body.String())
+
+	w = request(path, map[string]string{"Origin": "https://example.com", "X-Real-Ip": "11.0.0.1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrScopeMismatch), w.Body.String())
+
+	w = request(path, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	past := time.Now().Add(-time.Hour).UnixMilli()
+	w = request(fmt.Sprintf("filters:expire(%d):referer(example.com)/foo.jpg", past),
+		map[string]string{"Origin": "https://example.com"})
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, jsonStr(ErrExpired), w.Body.String())
+
+	// scope bound by signature
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"https://example.com/"+app.Signer.Sign(path)+"/foo.jpg", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+}
+
+func TestWithClientHints(t *testing.T) {
+	factory := func(enable bool) *Imagor {
+		return New(
+			WithUnsafe(true),
+			WithClientHints(enable),
+			WithMaxDPR(2),
+			WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+				return NewBlobFromBytes([]byte("foo")), nil
+			})),
+			WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+				return NewBlobFromBytes([]byte(p.Path)), nil
+			})),
+		)
+	}
+	tests := []struct {
+		name     string
+		enable   bool
+		path     string
+		header   map[string]string
+		expected string
+	}{
+		{"dpr filter", false, "100x50/filters:dpr(1.5)/abc.png", nil, "150x75/abc.png"},
+		{"dpr filter capped", false, "100x50/filters:dpr(3)/abc.png", nil, "200x100/abc.png"},
+		{"dpr filter without dimensions", false, "filters:dpr(2)/abc.png", nil, "abc.png"},
+		{"hints disabled", false, "100x50/abc.png", map[string]string{
+			"Sec-CH-DPR": "2", "Sec-CH-Width": "300", "Save-Data": "on"}, "100x50/abc.png"},
+		{"dpr hint", true, "fit-in/100x0/abc.png", map[string]string{
+			"Sec-CH-DPR": "1.5"}, "fit-in/150x0/abc.png"},
+		{"dpr filter over hint", true, "100x0/filters:dpr(1)/abc.png", map[string]string{
+			"Sec-CH-DPR": "2"}, "100x0/abc.png"},
+		{"width hint", true, "abc.png", map[string]string{
+			"Sec-CH-DPR": "2", "Sec-CH-Width": "300", "Sec-CH-Viewport-Width": "1000"},
+			"320x0/filters:no_upscale()/abc.png"},
+		{"width hint within viewport", true, "abc.png", map[string]string{
+			"Sec-CH-Width": "5000", "Sec-CH-Viewport-Width": "400"},
+			"828x0/filters:no_upscale()/abc.png"},
+		{"width hint bounded", true, "abc.png", map[string]string{
+			"Sec-CH-Width": "99999999999"}, "3840x0/filters:no_upscale()/abc.png"},
+		{"viewport width hint", true, "abc.png", map[string]string{
+			"Sec-CH-DPR": "2", "Sec-CH-Viewport-Width": "400"}, "828x0/filters:no_upscale()/abc.png"},
+		{"viewport width hint bounded", true, "abc.png", map[string]string{
+			"Sec-CH-DPR": "9", "Sec-CH-Viewport-Width": "99999999999"}, "3840x0/filters:no_upscale()/abc.png"},
+		{"save data", true, "100x0/abc.png", map[string]string{
+			"Save-Data": "on"}, "100x0/filters:quality(50)/abc.png"},
+		{"save data lower quality", true, "filters:quality(90)/abc.png", map[string]string{
+			"Save-Data": "on"}, "filters:quality(50)/abc.png"},
+		{"save data keep quality", true, "filters:quality(30)/abc.png", map[string]string{
+			"Save-Data": "on"}, "filters:quality(30)/abc.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := factory(tt.enable)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/"+tt.path, nil)
+			for key, val := range tt.header {
+				r.Header.Set(key, val)
+			}
+			app.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+			if tt.enable {
+				assert.Equal(t, "Sec-CH-DPR, Sec-CH-Width, Sec-CH-Viewport-Width, Save-Data", w.Header().Get("Accept-CH"))
+				assert.Equal(t, []string{"Sec-CH-DPR", "Sec-CH-Width", "Sec-CH-Viewport-Width", "Save-Data"}, w.Header().Values("Vary"))
+			} else {
+				assert.Empty(t, w.Header().Get("Accept-CH"))
+			}
+		})
+	}
+}
+
+func TestWithAutoFormats(t *testing.T) {
+	factory := func(options ...Option) *Imagor {
+		return New(append([]Option{
+			WithUnsafe(true),
+			WithAutoWebP(true),
+			WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+				return NewBlobFromBytes([]byte("foo")), nil
+			})),
+			WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+				return NewBlobFromBytes([]byte(p.Path)), nil
+			})),
+		}, options...)...)
+	}
+	tests := []struct {
+		name     string
+		options  []Option
+		accept   string
+		expected string
+	}{
+		{"all accepted", nil, "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8",
+			"filters:format(auto,avif,webp,jpeg)/abc.png"},
+		{"webp accepted", nil, "image/webp,*/*", "filters:format(auto,webp,jpeg)/abc.png"},
+		{"none accepted", nil, "", "filters:format(auto,jpeg)/abc.png"},
+		{"custom formats", []Option{WithAutoFormats("webp, PNG", "jxl")}, "image/avif,image/webp,image/jxl",
+			"filters:format(auto,webp,png,jxl)/abc.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := factory(tt.options...)
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/unsafe/filters:format(auto)/abc.png", nil)
+			r.Header.Set("Accept", tt.accept)
+			app.ServeHTTP(w, r)
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestWithCompareEndpoint(t *testing.T) {
+	hashes := map[string]string{
+		"a.jpg": "ff00ff00ff00ff00",
+		"b.jpg": "ff00ff00ff00ff0f",
+		"c.jpg": "00ff00ff00ff00ff",
+	}
+	var paths []string
+	app := New(
+		WithLoaders(loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+			if _, ok := hashes[image]; !ok && image != "raw.jpg" {
+				return nil, ErrNotFound
+			}
+			return NewBlobFromBytes([]byte(image)), nil
+		})),
+		WithProcessors(processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+			paths = append(paths, imagorpath.GeneratePath(p))
+			buf, _ := blob.ReadAll()
+			for _, f := range p.Filters {
+				if f.Name == "phash" || f.Name == "dhash" {
+					return NewBlobFromBytes([]byte(hashes[string(buf)])), nil
+				}
+			}
+			return blob, nil
+		})),
+		WithSigner(imagorpath.NewDefaultSigner("1234")),
+		WithEnableCompareEndpoint(true),
+	)
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+			"https://example.com/compare/"+app.Signer.Sign("compare:"+path)+"/"+path, nil))
+		return w
+	}
+	w := request("a.jpg/b.jpg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"algorithm":"phash","hashes":["ff00ff00ff00ff00","ff00ff00ff00ff0f"],"distance":4}`, w.Body.String())
+	assert.Equal(t, []string{
+		"fit-in/256x256/filters:phash()/a.jpg",
+		"fit-in/256x256/filters:phash()/b.jpg",
+	}, paths)
+
+	paths = nil
+	w = httptest.NewRecorder()
+	path := url.PathEscape("fit-in/100x100/a.jpg") + "/c.jpg"
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"https://example.com/compare/"+app.Signer.Sign("compare:"+path)+"/"+path+"?algorithm=dhash", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"algorithm":"dhash","hashes":["ff00ff00ff00ff00","00ff00ff00ff00ff"],"distance":64}`, w.Body.String())
+	assert.Equal(t, []string{
+		"fit-in/100x100/filters:dhash()/a.jpg",
+		"fit-in/256x256/filters:dhash()/c.jpg",
+	}, paths)
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/compare/unsafe/a.jpg/b.jpg", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+
+	// image URL signature of the path is not a compare signature
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"https://example.com/compare/"+app.Signer.Sign("a.jpg/b.jpg")+"/a.jpg/b.jpg", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+
+	w = request("a.jpg")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("a.jpg/notfound.jpg")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request("a.jpg/raw.jpg")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Equal(t, jsonStr(ErrPerceptualHashUnsupported), w.Body.String())
+
+	app.EnableCompareEndpoint = false
+	w = request("a.jpg/b.jpg")
+	assert.NotEqual(t, http.StatusOK, w.Code)
+}
+
+type differFunc struct {
+	processorFunc
+	diff func(ctx context.Context, a, b *Blob, threshold float64, visual bool) (*DiffResult, *Blob, error)
+}
+
+func (d differFunc) Diff(ctx context.Context, a, b *Blob, threshold float64, visual bool) (*DiffResult, *Blob, error) {
+	return d.diff(ctx, a, b, threshold, visual)
+}
+
+func TestWithDiffEndpoint(t *testing.T) {
+	var paths []string
+	processor := processorFunc(func(ctx context.Context, blob *Blob, p imagorpath.Params, load LoadFunc) (*Blob, error) {
+		path := imagorpath.GeneratePath(p)
+		paths = append(paths, path)
+		return NewBlobFromBytes([]byte(path)), nil
+	})
+	differ := differFunc{processor, func(ctx context.Context, a, b *Blob, threshold float64, visual bool) (*DiffResult, *Blob, error) {
+		bufA, _ := a.ReadAll()
+		bufB, _ := b.ReadAll()
+		res := &DiffResult{Width: 100, Height: 100, PSNR: 100, SSIM: 1}
+		if string(bufA) != string(bufB) {
+			res.PSNR, res.SSIM, res.Mismatch, res.MismatchPixels = 35.5, 0.98, 1.5, 150
+		}
+		if visual {
+			return res, NewBlobFromBytes([]byte(string(bufA) + "|" + string(bufB))), nil
+		}
+		return res, nil, nil
+	}}
+	loader := loaderFunc(func(r *http.Request, image string) (*Blob, error) {
+		if image == "notfound.jpg" {
+			return nil, ErrNotFound
+		}
+		return NewBlobFromBytes([]byte(image)), nil
+	})
+	app := New(
+		WithLoaders(loader),
+		WithProcessors(differ),
+		WithSigner(imagorpath.NewDefaultSigner("1234")),
+		WithEnableDiffEndpoint(true),
+	)
+	request := func(path, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+			"https://example.com/diff/"+app.Signer.Sign("diff:"+path)+"/"+path+query, nil))
+		return w
+	}
+	w := request("a.jpg/a.jpg", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"images":["a.jpg","a.jpg"],"width":100,"height":100,"psnr":100,"ssim":1,"threshold":0.1,"mismatch":0,"mismatch_pixels":0}`, w.Body.String())
+	assert.Empty(t, paths, "image keys loaded as is")
+
+	path := "a.jpg/" + url.PathEscape("fit-in/100x100/filters:quality(50)/a.jpg")
+	w = request(path, "?threshold=0.2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"images":["a.jpg","fit-in/100x100/filters:quality(50)/a.jpg"],"width":100,"height":100,"psnr":35.5,"ssim":0.98,"threshold":0.2,"mismatch":1.5,"mismatch_pixels":150}`, w.Body.String())
+	assert.Equal(t, []string{"fit-in/100x100/filters:quality(50)/a.jpg"}, paths)
+
+	w = request(path, "?output=image")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "a.jpg|fit-in/100x100/filters:quality(50)/a.jpg", w.Body.String())
+
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/diff/unsafe/a.jpg/b.jpg", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+
+	// compare signature of the images is not a diff signature
+	w = httptest.NewRecorder()
+	app.ServeHTTP(w, httptest.NewRequest(http.MethodGet,
+		"https://example.com/diff/"+app.Signer.Sign("compare:a.jpg/b.jpg")+"/a.jpg/b.jpg", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, jsonStr(ErrSignatureMismatch), w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, request("a.jpg", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("a.jpg/b.jpg", "?threshold=2").Code)
+	assert.Equal(t, http.StatusBadRequest, request("a.jpg/b.jpg", "?output=gif").Code)
+	assert.Equal(t, http.StatusNotFound, request("a.jpg/notfound.jpg", "").Code)
+
+	app.Processors = []Processor{processor}
+	w = request("a.jpg/b.jpg", "")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Equal(t, jsonStr(ErrDiffUnsupported), w.Body.String())
+
+	app.EnableDiffEndpoint = false
+	assert.NotContains(t, request("a.jpg/b.jpg", "").Body.String(), "mismatch_pixels")
+}
@@ -3,6 +3,7 @@ package imagorpath
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -50,39 +51,30 @@ var DigestResultStorageHasher = ResultStorageHasherFunc(func(p Params) string {
 	return hexDigestPath(p.Path)
 })
 
-// SuffixResultStorageHasher  ResultStorageHasher using storage path with digest suffix
-var SuffixResultStorageHasher = ResultStorageHasherFunc(func(p Params) string {
-	if p.Path == "" {
-		p.Path = GeneratePath(p)
-	}
-	var digest = sha1.Sum([]byte(p.Path))
-	var hash = "." + hex.EncodeToString(digest[:])[:20]
-	var dotIdx = strings.LastIndex(p.Image, ".")
-	var slashIdx = strings.LastIndex(p.Image, "/")
-	if dotIdx > -1 && slashIdx < dotIdx {
-		ext := p.Image[dotIdx:]
-		if p.Meta {
-			ext = ".json"
-		} else {
-			for _, filter := range p.Filters {
-				if filter.Name == "format" {
-					ext = "." + filter.Args
-				}
-			}
-		}
-		return p.Image[:dotIdx] + hash + ext // /abc/def.{digest}.jpg
-	}
-	return p.Image + hash // /abc/def.{digest}
-})
+// ResultStoragePrefixer optional ResultStorageHasher interface,
+// locating result keys of the source image by key prefix
+type ResultStoragePrefixer interface {
+	// ResultPrefix returns key prefix of the results of the image
+	ResultPrefix(image string) string
 
-// SizeSuffixResultStorageHasher  ResultStorageHasher using storage path with digest and size suffix
-var SizeSuffixResultStorageHasher = ResultStorageHasherFunc(func(p Params) string {
+	// MatchResult checks if key is a result key of the image
+	MatchResult(image, key string) bool
+}
+
+var suffixResultRegex = regexp.MustCompile(`^[0-9a-f]{20}(_[0-9]+x[0-9]+)?(\.[0-9A-Za-z]+)?$`)
+
+type suffixResultStorageHasher struct {
+	size bool
+}
+
+// HashResult implements ResultStorageHasher interface
+func (h suffixResultStorageHasher) HashResult(p Params) string {
 	if p.Path == "" {
 		p.Path = GeneratePath(p)
 	}
 	var digest = sha1.Sum([]byte(p.Path))
 	var hash = "." + hex.EncodeToString(digest[:])[:20]
-	if p.Width != 0 || p.Height != 0 {
+	if h.size && (p.Width != 0 || p.Height != 0) {
 		hash += "_" + strconv.Itoa(p.Width) + "x" + strconv.Itoa(p.Height)
 	}
 	var dotIdx = strings.LastIndex(p.Image, ".")
@@ -94,11 +86,35 @@ var SizeSuffixResultStorageHasher = ResultStorageHasherFunc(func(p Params) strin
 		} else {
 			for _, filter := range p.Filters {
 				if filter.Name == "format" {
-					ext = "." + filter.Args
+					format, _, _ := strings.Cut(filter.Args, ",") // format(auto,...)
+					ext = "." + format
 				}
 			}
 		}
 		return p.Image[:dotIdx] + hash + ext // /abc/def.{digest}_{width}x{height}.jpg
 	}
 	return p.Image + hash // /abc/def.{digest}_{width}x{height}
-})
+}
+
+// ResultPrefix implements ResultStoragePrefixer interface
+func (h suffixResultStorageHasher) ResultPrefix(image string) string {
+	var dotIdx = strings.LastIndex(image, ".")
+	var slashIdx = strings.LastIndex(image, "/")
+	if dotIdx > -1 && slashIdx < dotIdx {
+		return image[:dotIdx] + "." // /abc/def.
+	}
+	return image + "."
+}
+
+// MatchResult implements ResultStoragePrefixer interface.
+// Results of images sharing the same name with different extensions are not distinguishable
+func (h suffixResultStorageHasher) MatchResult(image, key string) bool {
+	prefix := h.ResultPrefix(image)
+	return strings.HasPrefix(key, prefix) && suffixResultRegex.MatchString(key[len(prefix):])
+}
+
+// SuffixResultStorageHasher  ResultStorageHasher using storage path with digest suffix
+var SuffixResultStorageHasher = suffixResultStorageHasher{}
+
+// SizeSuffixResultStorageHasher  ResultStorageHasher using storage path with digest and size suffix
+var SizeSuffixResultStorageHasher = suffixResultStorageHasher{size: true}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHasher(t *testing.T) {
@@ -39,6 +40,12 @@ func TestSuffixResultStorageHasher(t *testing.T) {
 	assert.Equal(t, "example.com/foobar.8aade9060badfcb289f9.webp", SuffixResultStorageHasher.HashResult(p))
 	assert.Equal(t, "example.com/foobar.8aade9060badfcb289f9_17x19.webp", SizeSuffixResultStorageHasher.HashResult(p))
 
+	p = Params{
+		Smart: true, Width: 17, Height: 19, Image: "example.com/foobar.jpg",
+		Filters: []Filter{{"format", "auto,avif,webp,jpeg"}},
+	}
+	assert.Equal(t, "example.com/foobar.4a97eb6fc24f734620ed.auto", SuffixResultStorageHasher.HashResult(p))
+
 	p = Params{
 		Meta:  true,
 		Smart: true, Width: 17, Height: 19, Image: "example.com/foobar.jpg",
@@ -56,3 +63,23 @@ func TestSuffixResultStorageHasher(t *testing.T) {
 	assert.Equal(t, "example.com/foobar.c80ab0faf85b35a140a8.json", SuffixResultStorageHasher.HashResult(p))
 	assert.Equal(t, "example.com/foobar.c80ab0faf85b35a140a8_17x19.json", SizeSuffixResultStorageHasher.HashResult(p))
 }
+
+func TestResultStoragePrefixer(t *testing.T) {
+	for _, hasher := range []ResultStorageHasher{SuffixResultStorageHasher, SizeSuffixResultStorageHasher} {
+		prefixer, ok := hasher.(ResultStoragePrefixer)
+		require.True(t, ok)
+		p := Params{Width: 17, Height: 19, Image: "example.com/foobar.jpg", Filters: []Filter{{"format", "webp"}}}
+		assert.Equal(t, "example.com/foobar.", prefixer.ResultPrefix(p.Image))
+		assert.True(t, prefixer.MatchResult(p.Image, hasher.HashResult(p)))
+		assert.True(t, prefixer.MatchResult(p.Image, hasher.HashResult(Params{Image: p.Image, Meta: true})))
+		assert.False(t, prefixer.MatchResult(p.Image, "example.com/foobar.jpg"))
+		assert.False(t, prefixer.MatchResult(p.Image, "example.com/foobar.8aade9060badfcb289f9/abc.jpg"))
+		assert.False(t, prefixer.MatchResult(p.Image, "example.com/foobar2.8aade9060badfcb289f9.jpg"))
+
+		p.Image = "example.com/foobar"
+		assert.Equal(t, "example.com/foobar.", prefixer.ResultPrefix(p.Image))
+		assert.True(t, prefixer.MatchResult(p.Image, hasher.HashResult(p)))
+	}
+	_, ok := ResultStorageHasher(DigestResultStorageHasher).(ResultStoragePrefixer)
+	assert.False(t, ok)
+}
@@ -436,6 +436,36 @@ func TestHMACSigner(t *testing.T) {
 	assert.Equal(t, signer.Sign("assfasf"), "zb6uWXQxwJDOe_zOgxkuj96Etrsz")
 }
 
+func TestMultiKeySigner(t *testing.T) {
+	k1 := SignerKey{ID: "k1", Signer: NewDefaultSigner("old")}
+	k2 := SignerKey{ID: "k2", Signer: NewDefaultSigner("new")}
+	path := "fit-in/100x100/foo.jpg"
+
+	signer, err := NewMultiKeySigner(false, k2, k1)
+	assert.NoError(t, err)
+	assert.Equal(t, k2.Signer.Sign(path), signer.Sign(path))
+	assert.Equal(t, k2.Signer.Sign(path)+"/"+path, Generate(Params{Path: path, Image: "foo.jpg", FitIn: true, Width: 100, Height: 100}, signer))
+	assert.True(t, Verify(signer, path, k1.Signer.Sign(path)))
+	assert.True(t, Verify(signer, path, k2.Signer.Sign(path)))
+	assert.True(t, Verify(signer, path, "k1="+k1.Signer.Sign(path)))
+	assert.False(t, Verify(signer, path, "k2="+k1.Signer.Sign(path)))
+	assert.False(t, Verify(signer, path, NewDefaultSigner("other").Sign(path)))
+	assert.False(t, Verify(signer, path, ""))
+
+	signer, err = NewMultiKeySigner(true, k2, k1)
+	assert.NoError(t, err)
+	assert.Equal(t, "k2="+k2.Signer.Sign(path), signer.Sign(path))
+	assert.True(t, Verify(signer, path, signer.Sign(path)))
+	assert.Equal(t, signer.Sign(path), Parse("/"+signer.Sign(path)+"/"+path).Hash)
+
+	_, err = NewMultiKeySigner(true, SignerKey{Signer: NewDefaultSigner("a")})
+	assert.Error(t, err)
+	_, err = NewMultiKeySigner(false, k1, k1)
+	assert.Error(t, err)
+	_, err = NewMultiKeySigner(false, SignerKey{ID: "a.b", Signer: NewDefaultSigner("a")})
+	assert.Error(t, err)
+}
+
 func TestParseFilters(t *testing.T) {
 	filters, img := parseFilters("filters:watermark(s.glbimg.com/filters:label(abc):watermark(aaa.com/fit-in/filters:aaa(bbb))/aaa.jpg,0,0,0):brightness(-50):grayscale()/some/example/img")
 	assert.Equal(t, []Filter{
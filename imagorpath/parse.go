@@ -17,6 +17,8 @@ var pathRegex = regexp.MustCompile(
 		"(.+)?",
 )
 
+var presetSegmentRegex = regexp.MustCompile("^/*preset:([A-Za-z0-9-_]+)/")
+
 var paramsRegex = regexp.MustCompile(
 	"/*" +
 		// meta
@@ -69,12 +71,25 @@ func Apply(p Params, path string) Params {
 	}
 	index += 3
 	p.Path = match[index]
+	return applyParams(p, p.Path)
+}
 
-	match = paramsRegex.FindStringSubmatch(p.Path)
+// applyParams applies the params part of imagor endpoint URI, excluding params and hash
+func applyParams(p Params, path string) Params {
+	for {
+		// leading preset:name/ segments
+		match := presetSegmentRegex.FindStringSubmatch(path)
+		if len(match) == 0 {
+			break
+		}
+		p.Presets = append(p.Presets, match[1])
+		path = path[len(match[0]):]
+	}
+	match := paramsRegex.FindStringSubmatch(path)
 	if len(match) == 0 {
 		return p
 	}
-	index = 1
+	index := 1
 	if match[index] != "" {
 		p.Meta = true
 	}
@@ -140,7 +155,13 @@ func Apply(p Params, path string) Params {
 	index++
 	if match[index] != "" {
 		filters, img := parseFilters(match[index])
-		p.Filters = append(p.Filters, filters...)
+		for _, filter := range filters {
+			if filter.Name == "preset" {
+				p.Presets = append(p.Presets, filter.Args)
+			} else {
+				p.Filters = append(p.Filters, filter)
+			}
+		}
 		if img != "" {
 			p.Image = img
 			if u, err := url.QueryUnescape(img); err == nil {
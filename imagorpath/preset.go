@@ -0,0 +1,79 @@
+package imagorpath
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var presetNameRegex = regexp.MustCompile("^[A-Za-z0-9-_]+$")
+
+// ErrPresetNotFound preset not found error
+var ErrPresetNotFound = errors.New("imagorpath: preset not found")
+
+// Presets named params path fragments,
+// expanded by preset:name/ path segment or preset(name) filter
+type Presets map[string]string
+
+// NewPresets validates and creates Presets from name to params path fragment
+func NewPresets(presets map[string]string) (Presets, error) {
+	ps := Presets{}
+	for name, fragment := range presets {
+		if !presetNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("imagorpath: invalid preset name %q", name)
+		}
+		fragment = strings.Trim(strings.TrimSpace(fragment), "/")
+		if fragment == "" {
+			return nil, fmt.Errorf("imagorpath: empty preset %s", name)
+		}
+		fragment += "/"
+		p := applyParams(Params{}, fragment)
+		if p.Image != "" {
+			return nil, fmt.Errorf("imagorpath: invalid preset %s params %s", name, p.Image)
+		}
+		if len(p.Presets) > 0 {
+			return nil, fmt.Errorf("imagorpath: nested preset %s", name)
+		}
+		ps[name] = fragment
+	}
+	return ps, nil
+}
+
+// ParsePresets parses Presets from JSON object of name to params path fragment
+func ParsePresets(data []byte) (Presets, error) {
+	var presets map[string]string
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, err
+	}
+	return NewPresets(presets)
+}
+
+// Expand returns Params with presets expanded in order,
+// params of the path take precedence over presets.
+// Path, Hash and Unsafe are kept as requested
+func (ps Presets) Expand(p Params) (Params, error) {
+	if len(p.Presets) == 0 {
+		return p, nil
+	}
+	var e Params
+	for _, name := range p.Presets {
+		fragment, ok := ps[name]
+		if !ok {
+			return p, fmt.Errorf("%w: %s", ErrPresetNotFound, name)
+		}
+		e = applyParams(e, fragment)
+	}
+	path := p.Path
+	if path == "" {
+		path = GeneratePath(p)
+	}
+	e = applyParams(e, path)
+	e.Presets = p.Presets
+	e.Params = p.Params
+	e.Path = p.Path
+	e.Hash = p.Hash
+	e.Unsafe = p.Unsafe
+	return e, nil
+}
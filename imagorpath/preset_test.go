@@ -0,0 +1,63 @@
+package imagorpath
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresets(t *testing.T) {
+	presets, err := ParsePresets([]byte(`{
+		"menu-thumb": "fit-in/200x200/filters:format(webp):quality(80)",
+		"avatar": "/300x300/smart/filters:round_corner(150)/",
+		"gray": "filters:grayscale()"
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "fit-in/200x200/filters:format(webp):quality(80)/", presets["menu-thumb"])
+	assert.Equal(t, "300x300/smart/filters:round_corner(150)/", presets["avatar"])
+
+	t.Run("path segment", func(t *testing.T) {
+		p := Parse("/unsafe/preset:menu-thumb/foo/bar.jpg")
+		assert.Equal(t, []string{"menu-thumb"}, p.Presets)
+		assert.Equal(t, "foo/bar.jpg", p.Image)
+		p, err := presets.Expand(p)
+		require.NoError(t, err)
+		assert.Equal(t, "preset:menu-thumb/foo/bar.jpg", p.Path)
+		assert.True(t, p.Unsafe)
+		assert.Equal(t, "fit-in/200x200/filters:format(webp):quality(80)/foo/bar.jpg", GeneratePath(p))
+	})
+
+	t.Run("filter with overrides", func(t *testing.T) {
+		p := Parse("/abcdefghij/100x0/filters:preset(avatar):preset(gray):quality(50)/foo/bar.jpg")
+		assert.Equal(t, []string{"avatar", "gray"}, p.Presets)
+		p, err := presets.Expand(p)
+		require.NoError(t, err)
+		assert.Equal(t, "abcdefghij", p.Hash)
+		assert.Equal(t,
+			"100x0/smart/filters:round_corner(150):grayscale():quality(50)/foo/bar.jpg",
+			GeneratePath(p))
+	})
+
+	t.Run("params", func(t *testing.T) {
+		p, err := presets.Expand(Params{Image: "foo.jpg", Presets: []string{"menu-thumb"}})
+		require.NoError(t, err)
+		assert.Equal(t, "fit-in/200x200/filters:format(webp):quality(80)/foo.jpg", GeneratePath(p))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := presets.Expand(Parse("/unsafe/preset:none/foo.jpg"))
+		assert.ErrorIs(t, err, ErrPresetNotFound)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := NewPresets(map[string]string{"a b": "fit-in/"})
+		assert.Error(t, err)
+		_, err = NewPresets(map[string]string{"a": ""})
+		assert.Error(t, err)
+		_, err = NewPresets(map[string]string{"a": "fit-in/foo.jpg"})
+		assert.Error(t, err)
+		_, err = NewPresets(map[string]string{"a": "preset:b/fit-in"})
+		assert.Error(t, err)
+	})
+}
@@ -3,8 +3,13 @@ package imagorpath
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"hash"
+	"regexp"
+	"strings"
 )
 
 // Signer imagor URL signature signer
@@ -41,3 +46,94 @@ func (s *hmacSigner) Sign(path string) string {
 	}
 	return sig
 }
+
+// Verifier optional Signer interface verifying signature hash of path,
+// for signers accepting more than one signature
+type Verifier interface {
+	Verify(path, hash string) bool
+}
+
+// Verify verifies signature hash of path by signer, using Verifier if implemented
+func Verify(signer Signer, path, hash string) bool {
+	if v, ok := signer.(Verifier); ok {
+		return v.Verify(path, hash)
+	}
+	return subtle.ConstantTimeCompare([]byte(signer.Sign(path)), []byte(hash)) == 1
+}
+
+var keyIDRegex = regexp.MustCompile("^[A-Za-z0-9-_]+$")
+
+// SignerKey Signer with key ID
+type SignerKey struct {
+	// ID key ID, embedded in signature hash as ID=HASH if EmbedKeyID enabled
+	ID string
+
+	// Signer of the key
+	Signer Signer
+}
+
+// MultiKeySigner signer of multiple active keys for key rotation,
+// signs with the primary key and verifies with any of the keys
+type MultiKeySigner struct {
+	// Keys active keys, the first key is the primary key
+	Keys []SignerKey
+
+	// EmbedKeyID embeds primary key ID in signature hash as ID=HASH
+	EmbedKeyID bool
+}
+
+// NewMultiKeySigner creates MultiKeySigner with primary key followed by other active keys
+func NewMultiKeySigner(embedKeyID bool, primary SignerKey, keys ...SignerKey) (*MultiKeySigner, error) {
+	s := &MultiKeySigner{
+		Keys:       append([]SignerKey{primary}, keys...),
+		EmbedKeyID: embedKeyID,
+	}
+	var ids = map[string]bool{}
+	for _, key := range s.Keys {
+		if key.Signer == nil {
+			return nil, errors.New("imagorpath: nil signer")
+		}
+		if key.ID == "" {
+			if embedKeyID {
+				return nil, errors.New("imagorpath: key ID required to embed key ID")
+			}
+			continue
+		}
+		if !keyIDRegex.MatchString(key.ID) {
+			return nil, fmt.Errorf("imagorpath: invalid key ID %q", key.ID)
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("imagorpath: duplicated key ID %q", key.ID)
+		}
+		ids[key.ID] = true
+	}
+	return s, nil
+}
+
+// Sign implements Signer interface, signing with the primary key
+func (s *MultiKeySigner) Sign(path string) string {
+	key := s.Keys[0]
+	if s.EmbedKeyID {
+		return key.ID + "=" + key.Signer.Sign(path)
+	}
+	return key.Signer.Sign(path)
+}
+
+// Verify implements Verifier interface, verifying with the key of embedded key ID,
+// or inferred by any of the keys
+func (s *MultiKeySigner) Verify(path, hash string) bool {
+	if idx := strings.IndexByte(hash, '='); idx > 0 {
+		id := hash[:idx]
+		for _, key := range s.Keys {
+			if key.ID != "" && key.ID == id {
+				return Verify(key.Signer, path, hash[idx+1:])
+			}
+		}
+	}
+	for _, key := range s.Keys {
+		if Verify(key.Signer, path, hash) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+package imgixpath
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cshum/imagor/imagorpath"
+)
+
+const (
+	// FitClip resize to fit within the dimensions without cropping, default fit mode
+	FitClip = "clip"
+	// FitCrop resize to fill the dimensions and crop the excess
+	FitCrop = "crop"
+	// FitFill resize to fit within the dimensions and fill the remaining space
+	FitFill = "fill"
+	// FitClamp resize to fit within the dimensions and extend the edges
+	FitClamp = "clamp"
+	// FitMax resize to fit within the dimensions without upscaling
+	FitMax = "max"
+	// FitMin resize to fill the dimensions without upscaling
+	FitMin = "min"
+	// FitScale resize to the exact dimensions, ignoring aspect ratio
+	FitScale = "scale"
+)
+
+// CompressQuality quality applied by auto=compress when q is absent
+const CompressQuality = 80
+
+// SignatureParam query parameter carrying the URL signature
+const SignatureParam = "s"
+
+// maxDPR maximum device pixel ratio accepted by dpr
+const maxDPR = 5
+
+var formatMap = map[string]string{
+	"jpg":  "jpeg",
+	"jpeg": "jpeg",
+	"pjpg": "jpeg",
+	"png":  "png",
+	"webp": "webp",
+	"avif": "avif",
+	"gif":  "gif",
+	"tiff": "tiff",
+	"jxl":  "jxl",
+}
+
+// Parse imagorpath.Params from imgix image path and query string values
+func Parse(path string, query url.Values) imagorpath.Params {
+	var p imagorpath.Params
+	return Apply(p, path, query)
+}
+
+// Apply imgix image path and query string values on top of existing imagorpath.Params
+func Apply(p imagorpath.Params, path string, query url.Values) imagorpath.Params {
+	if image := strings.TrimLeft(path, "/"); image != "" {
+		p.Image = image
+		if u, err := url.PathUnescape(image); err == nil {
+			p.Image = u
+		}
+	}
+	var (
+		fit    = strings.ToLower(query.Get("fit"))
+		crop   = strings.Split(strings.ToLower(query.Get("crop")), ",")
+		autos  = strings.Split(strings.ToLower(query.Get("auto")), ",")
+		dpr    = parseFloat(query.Get("dpr"))
+		width  = parseFloat(query.Get("w"))
+		height = parseFloat(query.Get("h"))
+		maxW   = parseFloat(query.Get("max-w"))
+		maxH   = parseFloat(query.Get("max-h"))
+	)
+	if maxW > 0 || maxH > 0 {
+		// max-w and max-h take precedence as maximum constraints
+		p.MaxDim = true
+		if maxW > 0 {
+			width = maxW
+		}
+		if maxH > 0 {
+			height = maxH
+		}
+	}
+	if fit == FitCrop || fit == FitMin {
+		if ar := parseAspectRatio(query.Get("ar")); ar > 0 {
+			if width > 0 && height == 0 {
+				height = width / ar
+			} else if height > 0 && width == 0 {
+				width = height * ar
+			}
+		}
+	}
+	if dpr > 0 && dpr != 1 {
+		dpr = math.Min(dpr, maxDPR)
+		width *= dpr
+		height *= dpr
+	}
+	p.Width = int(math.Max(width, 0))
+	p.Height = int(math.Max(height, 0))
+
+	if rect := strings.Split(query.Get("rect"), ","); len(rect) == 4 {
+		x, y := parseFloat(rect[0]), parseFloat(rect[1])
+		w, h := parseFloat(rect[2]), parseFloat(rect[3])
+		if w > 0 && h > 0 {
+			p.CropLeft = x
+			p.CropTop = y
+			p.CropRight = x + w
+			p.CropBottom = y + h
+		}
+	}
+
+	var upscale bool
+	switch fit {
+	case FitCrop:
+		upscale = true
+	case FitMin:
+		// crop without upscale
+	case FitFill:
+		p.FitIn = true
+		upscale = true
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "fill", Args: fillColor(query),
+		})
+	case FitClamp:
+		p.FitIn = true
+		upscale = true
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "fill", Args: "blur",
+		})
+	case FitMax:
+		p.FitIn = true
+	case FitScale:
+		p.Stretch = true
+		upscale = true
+	case FitClip:
+		p.FitIn = true
+		upscale = true
+	default:
+		// clip by default unless bounded by max-w and max-h
+		if !p.MaxDim {
+			p.FitIn = true
+			upscale = true
+		}
+	}
+	if upscale && (p.Width > 0 || p.Height > 0) {
+		p.Filters = append(p.Filters, imagorpath.Filter{Name: "upscale"})
+	}
+
+	if !p.FitIn && !p.Stretch {
+		for _, c := range crop {
+			switch c {
+			case "top", "bottom":
+				p.VAlign = c
+			case "left", "right":
+				p.HAlign = c
+			case "faces", "entropy", "edges":
+				p.Smart = true
+			case "focalpoint":
+				fpX := parseFloat(query.Get("fp-x"))
+				fpY := parseFloat(query.Get("fp-y"))
+				if query.Get("fp-x") == "" {
+					fpX = 0.5
+				}
+				if query.Get("fp-y") == "" {
+					fpY = 0.5
+				}
+				p.Filters = append(p.Filters, imagorpath.Filter{
+					Name: "focal",
+					Args: formatFloat(clamp(fpX, 0, 0.999)) + "," + formatFloat(clamp(fpY, 0, 0.999)),
+				})
+			}
+		}
+	}
+
+	if pad := parseInt(query.Get("pad")); pad > 0 {
+		p.PaddingLeft, p.PaddingTop, p.PaddingRight, p.PaddingBottom = pad, pad, pad, pad
+	}
+	if v := query.Get("pad-left"); v != "" {
+		p.PaddingLeft = parseInt(v)
+	}
+	if v := query.Get("pad-top"); v != "" {
+		p.PaddingTop = parseInt(v)
+	}
+	if v := query.Get("pad-right"); v != "" {
+		p.PaddingRight = parseInt(v)
+	}
+	if v := query.Get("pad-bottom"); v != "" {
+		p.PaddingBottom = parseInt(v)
+	}
+	if bg := parseColor(query.Get("bg")); bg != "" && fit != FitFill {
+		if p.PaddingLeft > 0 || p.PaddingTop > 0 || p.PaddingRight > 0 || p.PaddingBottom > 0 {
+			// padding color
+			p.Filters = append(p.Filters, imagorpath.Filter{Name: "fill", Args: bg})
+		} else {
+			p.Filters = append(p.Filters, imagorpath.Filter{Name: "background_color", Args: bg})
+		}
+	}
+
+	if q := query.Get("q"); q != "" {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "quality", Args: strconv.Itoa(clampInt(parseInt(q), 0, 100)),
+		})
+	} else if hasValue(autos, "compress") {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "quality", Args: strconv.Itoa(CompressQuality),
+		})
+	}
+	if fm := strings.ToLower(query.Get("fm")); fm == "json" {
+		p.Meta = true
+	} else if format, ok := formatMap[fm]; ok {
+		p.Filters = append(p.Filters, imagorpath.Filter{Name: "format", Args: format})
+	}
+	// auto=format is left to the imagor auto format negotiation by Accept header
+
+	if v := query.Get("bri"); v != "" {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "brightness", Args: strconv.Itoa(clampInt(parseInt(v), -100, 100)),
+		})
+	}
+	if v := query.Get("con"); v != "" {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "contrast", Args: strconv.Itoa(clampInt(parseInt(v), -100, 100)),
+		})
+	}
+	if v := query.Get("sat"); v != "" {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "saturation", Args: strconv.Itoa(clampInt(parseInt(v), -100, 100)),
+		})
+	}
+	if v := parseFloat(query.Get("blur")); v > 0 {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "blur", Args: formatFloat(v),
+		})
+	}
+	if v := parseFloat(query.Get("sharp")); v > 0 {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "sharpen", Args: formatFloat(v),
+		})
+	} else if v := parseFloat(query.Get("sharpen")); v > 0 {
+		p.Filters = append(p.Filters, imagorpath.Filter{
+			Name: "sharpen", Args: formatFloat(v),
+		})
+	}
+	if query.Get("monochrome") != "" {
+		p.Filters = append(p.Filters, imagorpath.Filter{Name: "grayscale"})
+	}
+
+	// unsigned imgix URL is unsafe, only allowed when imagor is unsafe
+	p.Hash = query.Get(SignatureParam)
+	p.Unsafe = p.Hash == ""
+	p.Path = imagorpath.GeneratePath(p)
+	return p
+}
+
+func fillColor(query url.Values) string {
+	if c := parseColor(query.Get("fill-color")); c != "" {
+		return c
+	}
+	if c := parseColor(query.Get("bg")); c != "" {
+		return c
+	}
+	return "white"
+}
+
+// parseColor converts imgix RGB, ARGB, RRGGBB, AARRGGBB hex or color name
+// into imagor color argument
+func parseColor(s string) string {
+	s = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "#"))
+	if s == "" {
+		return ""
+	}
+	if !isHex(s) {
+		return s // color keyword
+	}
+	switch len(s) {
+	case 3, 6:
+		return s
+	case 4:
+		if s[0] == '0' {
+			return "none"
+		}
+		return s[1:]
+	case 8:
+		if s[:2] == "00" {
+			return "none"
+		}
+		return s[2:]
+	}
+	return ""
+}
+
+func isHex(s string) bool {
+	for _, ch := range s {
+		if !(ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func parseAspectRatio(s string) float64 {
+	if w, h, ok := strings.Cut(s, ":"); ok {
+		if fw, fh := parseFloat(w), parseFloat(h); fw > 0 && fh > 0 {
+			return fw / fh
+		}
+		return 0
+	}
+	return parseFloat(s)
+}
+
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
+
+func parseInt(s string) int {
+	return int(parseFloat(s))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func clamp(f, min, max float64) float64 {
+	return math.Max(min, math.Min(max, f))
+}
+
+func clampInt(i, min, max int) int {
+	if i < min {
+		return min
+	}
+	if i > max {
+		return max
+	}
+	return i
+}
+
+func hasValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) == value {
+			return true
+		}
+	}
+	return false
+}
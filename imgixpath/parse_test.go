@@ -0,0 +1,250 @@
+package imgixpath
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/cshum/imagor/imagorpath"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		query string
+		path2 string
+	}{
+		{
+			name:  "no params",
+			path:  "/foo/bar.jpg",
+			path2: "fit-in/foo/bar.jpg",
+		},
+		{
+			name:  "width height default clip",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200",
+			path2: "fit-in/300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "float dimensions truncated",
+			path:  "/foo/bar.jpg",
+			query: "w=300.7&h=200.2",
+			path2: "fit-in/300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit crop",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=crop",
+			path2: "300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit crop align",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=crop&crop=top,left",
+			path2: "300x200/left/top/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit crop faces",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=crop&crop=faces",
+			path2: "300x200/smart/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit crop focalpoint",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=crop&crop=focalpoint&fp-x=0.2&fp-y=0.7",
+			path2: "300x200/filters:upscale():focal(0.2,0.7)/foo/bar.jpg",
+		},
+		{
+			name:  "crop ignored on fit-in",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&crop=focalpoint&fp-x=0.2&fp-y=0.7",
+			path2: "fit-in/300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit clip",
+			path:  "/foo/bar.jpg",
+			query: "w=300&fit=clip",
+			path2: "fit-in/300x0/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit fill",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=fill&fill-color=FF0000",
+			path2: "fit-in/300x200/filters:fill(ff0000):upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit fill default white",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=fill",
+			path2: "fit-in/300x200/filters:fill(white):upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit clamp",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=clamp",
+			path2: "fit-in/300x200/filters:fill(blur):upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "fit max",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=max",
+			path2: "fit-in/300x200/foo/bar.jpg",
+		},
+		{
+			name:  "fit min",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=min",
+			path2: "300x200/foo/bar.jpg",
+		},
+		{
+			name:  "fit scale",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&fit=scale",
+			path2: "stretch/300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "max width height",
+			path:  "/foo/bar.jpg",
+			query: "max-w=300&max-h=200",
+			path2: "max-dim/300x200/foo/bar.jpg",
+		},
+		{
+			name:  "max width overrides width",
+			path:  "/foo/bar.jpg",
+			query: "w=500&max-w=300",
+			path2: "max-dim/300x0/foo/bar.jpg",
+		},
+		{
+			name:  "max width with fit crop",
+			path:  "/foo/bar.jpg",
+			query: "max-w=300&max-h=200&fit=crop",
+			path2: "max-dim/300x200/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "dpr",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&dpr=2",
+			path2: "fit-in/600x400/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "dpr capped",
+			path:  "/foo/bar.jpg",
+			query: "w=100&dpr=10",
+			path2: "fit-in/500x0/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "aspect ratio",
+			path:  "/foo/bar.jpg",
+			query: "w=400&ar=16:9&fit=crop",
+			path2: "400x225/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "aspect ratio ignored without crop",
+			path:  "/foo/bar.jpg",
+			query: "w=400&ar=16:9",
+			path2: "fit-in/400x0/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "rect",
+			path:  "/foo/bar.jpg",
+			query: "rect=10,20,300,400&w=100&fit=crop",
+			path2: "10x20:310x420/100x0/filters:upscale()/foo/bar.jpg",
+		},
+		{
+			name:  "pad with bg",
+			path:  "/foo/bar.jpg",
+			query: "w=300&h=200&pad=10&pad-top=5&bg=FFF",
+			path2: "fit-in/300x200/10x5:10x10/filters:upscale():fill(fff)/foo/bar.jpg",
+		},
+		{
+			name:  "bg argb",
+			path:  "/foo/bar.jpg",
+			query: "bg=80FF0000",
+			path2: "fit-in/filters:background_color(ff0000)/foo/bar.jpg",
+		},
+		{
+			name:  "bg transparent",
+			path:  "/foo/bar.jpg",
+			query: "bg=00FF0000",
+			path2: "fit-in/filters:background_color(none)/foo/bar.jpg",
+		},
+		{
+			name:  "quality format",
+			path:  "/foo/bar.jpg",
+			query: "q=60.5&fm=jpg",
+			path2: "fit-in/filters:quality(60):format(jpeg)/foo/bar.jpg",
+		},
+		{
+			name:  "auto compress",
+			path:  "/foo/bar.jpg",
+			query: "auto=format,compress",
+			path2: "fit-in/filters:quality(80)/foo/bar.jpg",
+		},
+		{
+			name:  "auto compress explicit quality",
+			path:  "/foo/bar.jpg",
+			query: "auto=compress&q=30",
+			path2: "fit-in/filters:quality(30)/foo/bar.jpg",
+		},
+		{
+			name:  "unsupported format ignored",
+			path:  "/foo/bar.jpg",
+			query: "fm=mp4",
+			path2: "fit-in/foo/bar.jpg",
+		},
+		{
+			name:  "json format meta",
+			path:  "/foo/bar.jpg",
+			query: "fm=json",
+			path2: "meta/fit-in/foo/bar.jpg",
+		},
+		{
+			name:  "adjustments",
+			path:  "/foo/bar.jpg",
+			query: "bri=10&con=-20&sat=200&blur=5&sharp=3&monochrome=000000",
+			path2: "fit-in/filters:brightness(10):contrast(-20):saturation(100):blur(5):sharpen(3):grayscale()/foo/bar.jpg",
+		},
+		{
+			name:  "escaped image path",
+			path:  "/foo%20bar/baz.jpg",
+			query: "w=100",
+			path2: "fit-in/100x0/filters:upscale()/foo bar/baz.jpg",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			assert.NoError(t, err)
+			p := Parse(test.path, query)
+			assert.Equal(t, test.path2, p.Path)
+			assert.Equal(t, test.path2, imagorpath.GeneratePath(p))
+			assert.True(t, p.Unsafe)
+			assert.Empty(t, p.Hash)
+		})
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	signer := imagorpath.NewDefaultSigner("1234")
+	p := Parse("/foo/bar.jpg", url.Values{"w": {"300"}, "h": {"200"}})
+	hash := signer.Sign(p.Path)
+
+	p = Parse("/foo/bar.jpg", url.Values{"w": {"300"}, "h": {"200"}, SignatureParam: {hash}})
+	assert.False(t, p.Unsafe)
+	assert.Equal(t, hash, p.Hash)
+	assert.Equal(t, hash, signer.Sign(p.Path))
+	assert.Equal(t, "foo/bar.jpg", p.Image)
+
+	// query parameter order does not affect signature
+	p = Parse("/foo/bar.jpg", url.Values{SignatureParam: {hash}, "h": {"200"}, "w": {"300"}})
+	assert.Equal(t, hash, signer.Sign(p.Path))
+}
+
+func TestApply(t *testing.T) {
+	p := Apply(imagorpath.Params{
+		Filters: imagorpath.Filters{{Name: "quality", Args: "40"}},
+	}, "/foo.jpg", url.Values{"q": {"90"}})
+	assert.Equal(t, "fit-in/filters:quality(40):quality(90)/foo.jpg", p.Path)
+}
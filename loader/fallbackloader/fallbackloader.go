@@ -0,0 +1,300 @@
+package fallbackloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+// DefaultMaxAllowedSize default maximum bytes allowed for fallback image
+const DefaultMaxAllowedSize = 32 << 20
+
+// FallbackLoader wraps imagor.Loader and loads from fallback origins
+// when the image is not found, implements imagor.Loader interface
+type FallbackLoader struct {
+	// Loader the primary loader
+	Loader imagor.Loader
+
+	// Origins fallback origin URL templates, tried in order.
+	// Supports {bucket}, {subdomain} and {key} placeholders
+	Origins []string
+
+	// Subdomains maps bucket to {subdomain} placeholder, default to bucket name
+	Subdomains map[string]string
+
+	// Buckets allowed to fallback.
+	// Allow all buckets resolved by Resolver if empty, or only the DefaultBucket without Resolver
+	Buckets []string
+
+	// DefaultBucket bucket when request does not specify bucket
+	DefaultBucket string
+
+	// Resolver resolves the request bucket, default to the Loader if implements imagor.BucketResolver
+	// e.g. S3 Loader with Tenants
+	Resolver imagor.BucketResolver
+
+	// MaxAllowedSize maximum bytes allowed for fallback image, DefaultMaxAllowedSize if not positive
+	MaxAllowedSize int
+
+	// Concurrency maximum number of fallback requests simultaneously, no limit if not positive
+	Concurrency int64
+
+	// Timeout fallback origin request timeout
+	Timeout time.Duration
+
+	// Storage backfills fallback image asynchronously if set
+	Storage imagor.Storage
+
+	// OnBackfill called on image backfilled into Storage, e.g. invalidating imagor not found cache
+	OnBackfill func(ctx context.Context, image string)
+
+	// SaveTimeout timeout for backfilling fallback image into Storage
+	SaveTimeout time.Duration
+
+	// Transport used to request fallback origins, default http.DefaultTransport
+	Transport http.RoundTripper
+
+	Logger *zap.Logger
+
+	// Instrumentation records fallback and backfill metrics if set
+	Instrumentation *instrumentation.Instrumentation
+
+	sema *semaphore.Weighted
+}
+
+// New creates FallbackLoader wrapping the Loader
+func New(loader imagor.Loader, options ...Option) *FallbackLoader {
+	l := &FallbackLoader{
+		Loader:         loader,
+		Subdomains:     map[string]string{},
+		MaxAllowedSize: DefaultMaxAllowedSize,
+		Timeout:        time.Second * 30,
+		SaveTimeout:    time.Minute,
+		Transport:      http.DefaultTransport,
+		Logger:         zap.NewNop(),
+	}
+	for _, option := range options {
+		option(l)
+	}
+	if l.Resolver == nil {
+		if resolver, ok := loader.(imagor.BucketResolver); ok {
+			l.Resolver = resolver
+		}
+	}
+	if l.Concurrency > 0 {
+		l.sema = semaphore.NewWeighted(l.Concurrency)
+	}
+	return l
+}
+
+// Get implements imagor.Loader interface
+func (l *FallbackLoader) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	blob, err := l.Loader.Get(r, image)
+	if blob != nil && err == nil {
+		err = blob.Err()
+	}
+	if !errors.Is(err, imagor.ErrNotFound) || len(l.Origins) == 0 {
+		return blob, err
+	}
+	bucket, ok := l.fallbackBucket(r.Context())
+	if !ok {
+		return blob, err
+	}
+	fallback, e := l.Fetch(r.Context(), bucket, image)
+	if e != nil {
+		l.recordFallback(bucket, "failure")
+		if errors.Is(e, imagor.ErrMaxSizeExceeded) || r.Context().Err() != nil {
+			return nil, e
+		}
+		return blob, err
+	}
+	l.recordFallback(bucket, "hit")
+	if l.Storage != nil {
+		go l.backfill(context.WithoutCancel(r.Context()), bucket, image, fallback)
+	}
+	return fallback, nil
+}
+
+// URL returns the fallback origin URL of the template by bucket and image key
+func (l *FallbackLoader) URL(origin, bucket, image string) string {
+	subdomain := bucket
+	if s, ok := l.Subdomains[bucket]; ok {
+		subdomain = s
+	}
+	key := (&url.URL{Path: strings.TrimPrefix(image, "/")}).EscapedPath()
+	return strings.NewReplacer(
+		"{bucket}", bucket,
+		"{subdomain}", subdomain,
+		"{key}", key,
+	).Replace(origin)
+}
+
+// TenantBucket returns the request tenant bucket of the primary Loader if resolvable,
+// e.g. S3 Loader with Tenants
+func (l *FallbackLoader) TenantBucket(ctx context.Context) (string, error) {
+	if resolver, ok := l.Loader.(interface {
+		TenantBucket(ctx context.Context) (string, error)
+	}); ok {
+		return resolver.TenantBucket(ctx)
+	}
+	return "", nil
+}
+
+// ResolveBucket resolves the request bucket by Resolver, or the DefaultBucket without Resolver.
+// Returns false if the bucket is unknown
+func (l *FallbackLoader) ResolveBucket(ctx context.Context) (string, bool) {
+	if l.Resolver != nil {
+		return l.Resolver.ResolveBucket(ctx)
+	}
+	bucket := getBucketFromContext(ctx)
+	if bucket == "" {
+		bucket = l.DefaultBucket
+	} else if bucket != l.DefaultBucket && !slices.Contains(l.Buckets, bucket) {
+		// request bucket not verified without Resolver
+		return "", false
+	}
+	return bucket, bucket != ""
+}
+
+// fallbackBucket resolves the request bucket, false if unknown or not allowed to fallback
+func (l *FallbackLoader) fallbackBucket(ctx context.Context) (string, bool) {
+	bucket, ok := l.ResolveBucket(ctx)
+	if !ok || bucket == "" || len(l.Buckets) > 0 && !slices.Contains(l.Buckets, bucket) {
+		return "", false
+	}
+	return bucket, true
+}
+
+// Fetch fetches the image of bucket from fallback origins in order,
+// within the concurrency limit
+func (l *FallbackLoader) Fetch(ctx context.Context, bucket, image string) (*imagor.Blob, error) {
+	if l.sema != nil {
+		if err := l.sema.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		defer l.sema.Release(1)
+	}
+	var err error = imagor.ErrNotFound
+	for _, origin := range l.Origins {
+		u := l.URL(origin, bucket, image)
+		var blob *imagor.Blob
+		if blob, err = l.fetch(ctx, u); err == nil {
+			l.Logger.Debug("fallback",
+				zap.String("bucket", bucket),
+				zap.String("image", image),
+				zap.String("url", u))
+			return blob, nil
+		}
+		l.Logger.Warn("fallback-error",
+			zap.String("bucket", bucket),
+			zap.String("image", image),
+			zap.String("url", u),
+			zap.Error(err))
+		if errors.Is(err, imagor.ErrMaxSizeExceeded) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (l *FallbackLoader) fetch(ctx context.Context, u string) (*imagor.Blob, error) {
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "imagor/"+imagor.Version)
+	resp, err := (&http.Client{Transport: l.Transport}).Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, imagor.ErrTimeout
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= 400 {
+		return nil, imagor.NewErrorFromStatusCode(resp.StatusCode)
+	}
+	maxSize := l.MaxAllowedSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAllowedSize
+	}
+	if resp.ContentLength > int64(maxSize) {
+		return nil, imagor.ErrMaxSizeExceeded
+	}
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > maxSize {
+		return nil, imagor.ErrMaxSizeExceeded
+	}
+	blob := imagor.NewBlobFromBytes(buf)
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		blob.SetContentType(contentType)
+	}
+	return blob, nil
+}
+
+func (l *FallbackLoader) backfill(ctx context.Context, bucket, image string, blob *imagor.Blob) {
+	if l.SaveTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.SaveTimeout)
+		defer cancel()
+	}
+	if err := l.Storage.Put(ctx, image, blob); err != nil {
+		l.recordBackfill(bucket, "error")
+		l.Logger.Warn("fallback-backfill-error",
+			zap.String("bucket", bucket),
+			zap.String("image", image),
+			zap.Error(err))
+		return
+	}
+	l.recordBackfill(bucket, "success")
+	l.onBackfill(ctx, image)
+	l.Logger.Debug("fallback-backfill",
+		zap.String("bucket", bucket),
+		zap.String("image", image))
+}
+
+func (l *FallbackLoader) onBackfill(ctx context.Context, image string) {
+	if l.OnBackfill != nil {
+		l.OnBackfill(ctx, image)
+	}
+}
+
+func (l *FallbackLoader) recordFallback(bucket, status string) {
+	if l.Instrumentation != nil {
+		l.Instrumentation.RecordFallback(bucket, status)
+	}
+}
+
+func (l *FallbackLoader) recordBackfill(bucket, status string) {
+	if l.Instrumentation != nil {
+		l.Instrumentation.RecordBackfill(bucket, status)
+	}
+}
+
+// getBucketFromContext extracts the requested bucket name from the context
+func getBucketFromContext(ctx context.Context) string {
+	if bucket, ok := ctx.Value("aws-bucket").(string); ok {
+		return bucket
+	}
+	return ""
+}
@@ -0,0 +1,369 @@
+package fallbackloader
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTransport map[string]string
+
+func (t testTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if res, ok := t[r.URL.String()]; ok {
+		w := &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(res)),
+			Header:     make(http.Header),
+		}
+		w.Header.Set("Content-Type", "image/jpeg")
+		return w, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader("not found")),
+	}, nil
+}
+
+type mapStore struct {
+	l   sync.Mutex
+	Map map[string]*imagor.Blob
+	ctx map[string]context.Context
+	put chan string
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{
+		Map: map[string]*imagor.Blob{},
+		ctx: map[string]context.Context{},
+		put: make(chan string, 10),
+	}
+}
+
+func (s *mapStore) Get(_ *http.Request, image string) (*imagor.Blob, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	buf, ok := s.Map[image]
+	if !ok {
+		return nil, imagor.ErrNotFound
+	}
+	return buf, nil
+}
+
+func (s *mapStore) Put(ctx context.Context, image string, blob *imagor.Blob) error {
+	s.l.Lock()
+	s.Map[image] = blob
+	s.ctx[image] = ctx
+	s.l.Unlock()
+	s.put <- image
+	return nil
+}
+
+func (s *mapStore) Delete(_ context.Context, image string) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.Map, image)
+	return nil
+}
+
+func (s *mapStore) Stat(_ context.Context, image string) (*imagor.Stat, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if _, ok := s.Map[image]; !ok {
+		return nil, imagor.ErrNotFound
+	}
+	return &imagor.Stat{}, nil
+}
+
+func newRequest(bucket string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/imagor", nil)
+	if bucket != "" {
+		r = r.WithContext(context.WithValue(r.Context(), "aws-bucket", bucket))
+	}
+	return r
+}
+
+func TestURL(t *testing.T) {
+	l := New(newMapStore(), WithSubdomains("mrsool-business:mrsool, foo:"))
+	assert.Equal(t, "https://mrsool.imgix.net/foo/bar%20baz.jpg?q=100&w=1",
+		l.URL("https://{subdomain}.imgix.net/{key}?q=100&w=1", "mrsool-business", "/foo/bar baz.jpg"))
+	assert.Equal(t, "https://foo.example.com/foo/bar.jpg",
+		l.URL("https://{subdomain}.example.com/{key}", "foo", "foo/bar.jpg"))
+	assert.Equal(t, "https://cdn.example.com/abc/foo/bar.jpg",
+		l.URL("https://cdn.example.com/{bucket}/{key}", "abc", "foo/bar.jpg"))
+}
+
+func TestFallbackLoader(t *testing.T) {
+	origin := newMapStore()
+	storage := newMapStore()
+	backfilled := make(chan string, 10)
+	require.NoError(t, origin.Put(context.Background(), "foo.jpg", imagor.NewBlobFromBytes([]byte("foo"))))
+	<-origin.put
+
+	l := New(origin,
+		WithOrigins("https://{subdomain}.imgix.net/{key}?q=100, https://{bucket}.example.com/{key}"),
+		WithSubdomains("mrsool-business:mrsool"),
+		WithBuckets("mrsool-business,mrsool-data"),
+		WithDefaultBucket("mrsool-data"),
+		WithMaxAllowedSize(10),
+		WithConcurrency(2),
+		WithStorage(storage),
+		WithOnBackfill(func(ctx context.Context, image string) {
+			backfilled <- getBucketFromContext(ctx) + ":" + image
+		}),
+		WithInstrumentation(instrumentation.New(nil)),
+		WithTransport(testTransport{
+			"https://mrsool.imgix.net/bar.jpg?q=100":          "bar",
+			"https://mrsool-data.example.com/baz.jpg":         "baz",
+			"https://mrsool-data.imgix.net/large.jpg?q=100":   "12345678901",
+			"https://mrsool-disabled.imgix.net/bar.jpg?q=100": "bar",
+		}),
+	)
+
+	t.Run("primary hit", func(t *testing.T) {
+		b, err := l.Get(newRequest("mrsool-business"), "foo.jpg")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(buf))
+	})
+
+	t.Run("fallback hit with backfill", func(t *testing.T) {
+		hits := testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("mrsool-business", "hit"))
+		b, err := l.Get(newRequest("mrsool-business"), "bar.jpg")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(buf))
+		assert.Equal(t, "image/jpeg", b.ContentType())
+		assert.Equal(t, hits+1, testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("mrsool-business", "hit")))
+
+		select {
+		case image := <-storage.put:
+			assert.Equal(t, "bar.jpg", image)
+		case <-time.After(time.Second):
+			t.Fatal("backfill timeout")
+		}
+		storage.l.Lock()
+		assert.Equal(t, "mrsool-business", storage.ctx["bar.jpg"].Value("aws-bucket"))
+		storage.l.Unlock()
+		assert.Equal(t, "mrsool-business:bar.jpg", <-backfilled)
+	})
+
+	t.Run("fallback next origin with default bucket", func(t *testing.T) {
+		b, err := l.Get(newRequest(""), "baz.jpg")
+		require.NoError(t, err)
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "baz", string(buf))
+		<-storage.put
+		assert.Equal(t, ":baz.jpg", <-backfilled)
+	})
+
+	t.Run("fallback not found", func(t *testing.T) {
+		failures := testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("mrsool-data", "failure"))
+		_, err := l.Get(newRequest("mrsool-data"), "abc.jpg")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		assert.Equal(t, failures+1, testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("mrsool-data", "failure")))
+	})
+
+	t.Run("fallback max size exceeded", func(t *testing.T) {
+		_, err := l.Get(newRequest("mrsool-data"), "large.jpg")
+		assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+	})
+
+	t.Run("bucket not allowed", func(t *testing.T) {
+		_, err := l.Get(newRequest("mrsool-disabled"), "bar.jpg")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	})
+}
+
+func TestFallbackLoaderConcurrency(t *testing.T) {
+	block := make(chan struct{})
+	l := New(newMapStore(),
+		WithOrigins("https://{bucket}.example.com/{key}"),
+		WithDefaultBucket("a"),
+		WithConcurrency(1),
+		WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			<-block
+			return testTransport{"https://a.example.com/foo.jpg": "foo"}.RoundTrip(r)
+		})),
+	)
+	done := make(chan error)
+	go func() {
+		_, err := l.Get(newRequest("a"), "foo.jpg")
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	r := newRequest("a").WithContext(context.WithValue(ctx, "aws-bucket", "a"))
+	_, err := l.Get(r, "foo.jpg")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(block)
+	assert.NoError(t, <-done)
+}
+
+func TestFallbackLoaderBucket(t *testing.T) {
+	var urls []string
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		urls = append(urls, r.URL.String())
+		return testTransport{}.RoundTrip(r)
+	})
+	l := New(newMapStore(),
+		WithOrigins("https://{subdomain}.imgix.net/{key}"),
+		WithDefaultBucket("mrsool"),
+		WithTransport(transport),
+	)
+	for _, bucket := range []string{"", "mrsool", "evil"} {
+		_, err := l.Get(newRequest(bucket), "foo.jpg")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	}
+	// request bucket not verified without tenants
+	assert.Equal(t, []string{
+		"https://mrsool.imgix.net/foo.jpg",
+		"https://mrsool.imgix.net/foo.jpg",
+	}, urls)
+
+	urls = nil
+	l = New(newMapStore(),
+		WithOrigins("https://{subdomain}.imgix.net/{key}"),
+		WithDefaultBucket("mrsool"),
+		WithBucketResolver(bucketResolverFunc(func(ctx context.Context) (string, bool) {
+			switch bucket := getBucketFromContext(ctx); bucket {
+			case "":
+				return "mrsool", true
+			case "mrsool-business":
+				return bucket, true
+			}
+			return "", false
+		})),
+		WithTransport(transport),
+		WithInstrumentation(instrumentation.New(nil)),
+	)
+	unknown := testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("evil", "failure"))
+	for _, bucket := range []string{"", "mrsool-business", "evil"} {
+		_, err := l.Get(newRequest(bucket), "foo.jpg")
+		assert.Equal(t, imagor.ErrNotFound, err)
+	}
+	assert.Equal(t, []string{
+		"https://mrsool.imgix.net/foo.jpg",
+		"https://mrsool-business.imgix.net/foo.jpg",
+	}, urls)
+	assert.Equal(t, unknown, testutil.ToFloat64(instrumentation.FallbackCounter.WithLabelValues("evil", "failure")))
+
+	// resolved regardless of buckets allowed to fallback
+	urls = nil
+	WithBuckets("mrsool")(l)
+	bucket, ok := l.ResolveBucket(newRequest("mrsool-business").Context())
+	assert.True(t, ok)
+	assert.Equal(t, "mrsool-business", bucket)
+	_, err := l.Get(newRequest("mrsool-business"), "foo.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	assert.Empty(t, urls)
+}
+
+func TestFallbackLoaderMaxAllowedSize(t *testing.T) {
+	l := New(newMapStore(),
+		WithOrigins("https://{bucket}.example.com/{key}"),
+		WithDefaultBucket("a"),
+		WithMaxAllowedSize(0),
+		WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				ContentLength: DefaultMaxAllowedSize + 1,
+				Body:          io.NopCloser(strings.NewReader("foo")),
+			}, nil
+		})),
+	)
+	assert.Equal(t, DefaultMaxAllowedSize, l.MaxAllowedSize)
+	_, err := l.Get(newRequest("a"), "foo.jpg")
+	assert.Equal(t, imagor.ErrMaxSizeExceeded, err)
+
+	l.MaxAllowedSize = 0
+	_, err = l.Get(newRequest("a"), "foo.jpg")
+	assert.Equal(t, imagor.ErrMaxSizeExceeded, err, "bounded by default if not positive")
+}
+
+type bucketResolverFunc func(ctx context.Context) (string, bool)
+
+func (f bucketResolverFunc) ResolveBucket(ctx context.Context) (string, bool) {
+	return f(ctx)
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestMigrator(t *testing.T) {
+	storage := newMapStore()
+	require.NoError(t, storage.Put(context.Background(), "a.jpg", imagor.NewBlobFromBytes([]byte("a"))))
+	<-storage.put
+	l := New(storage,
+		WithOrigins("https://{subdomain}.imgix.net/{key}"),
+		WithSubdomains("mrsool-business:mrsool"),
+		WithTransport(testTransport{
+			"https://mrsool.imgix.net/b.jpg": "b",
+			"https://mrsool.imgix.net/c.jpg": "c",
+		}),
+	)
+	newKeys := func(keys ...string) <-chan string {
+		ch := make(chan string, len(keys))
+		for _, key := range keys {
+			ch <- key
+		}
+		close(ch)
+		return ch
+	}
+
+	m := &Migrator{Fallback: l, Storage: storage, Bucket: "mrsool-business", Concurrency: 2, DryRun: true}
+	report := m.Migrate(context.Background(), newKeys("a.jpg", "b.jpg", "d.jpg"), nil)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Existing)
+	assert.ElementsMatch(t, []string{"b.jpg", "d.jpg"}, report.Pending)
+	assert.Empty(t, report.Copied)
+
+	var done []string
+	var backfilled []string
+	var mu sync.Mutex
+	l.OnBackfill = func(ctx context.Context, image string) {
+		mu.Lock()
+		backfilled = append(backfilled, image)
+		mu.Unlock()
+	}
+	m.DryRun = false
+	report = m.Migrate(context.Background(), newKeys("a.jpg", "b.jpg", "c.jpg", "d.jpg"), func(key string) {
+		done = append(done, key)
+	})
+	assert.Equal(t, 1, report.Existing)
+	assert.ElementsMatch(t, []string{"b.jpg", "c.jpg"}, report.Copied)
+	assert.Equal(t, []string{"d.jpg"}, report.Missing)
+	assert.Empty(t, report.Failed)
+	assert.ElementsMatch(t, []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"}, done)
+	assert.ElementsMatch(t, []string{"b.jpg", "c.jpg"}, backfilled)
+	for range report.Copied {
+		<-storage.put
+	}
+	storage.l.Lock()
+	assert.Equal(t, "mrsool-business", storage.ctx["b.jpg"].Value("aws-bucket"))
+	storage.l.Unlock()
+	b, err := storage.Get(nil, "c.jpg")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "c", string(buf))
+}
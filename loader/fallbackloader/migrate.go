@@ -0,0 +1,138 @@
+package fallbackloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/cshum/imagor"
+	"go.uber.org/zap"
+)
+
+// MigrateFailure failed key of migration
+type MigrateFailure struct {
+	Key   string `json:"key"`
+	Error string `json:"error"`
+}
+
+// MigrateReport migration report of keys
+type MigrateReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Existing int              `json:"existing"`
+	Pending  []string         `json:"pending,omitempty"`
+	Copied   []string         `json:"copied"`
+	Missing  []string         `json:"missing"`
+	Failed   []MigrateFailure `json:"failed"`
+}
+
+// Migrator backfills keys from fallback origins into Storage in bulk
+type Migrator struct {
+	// Fallback fetches keys from fallback origins
+	Fallback *FallbackLoader
+
+	// Storage checks and saves keys
+	Storage imagor.Storage
+
+	// Bucket of the keys, default to Fallback default bucket
+	Bucket string
+
+	// Concurrency number of keys migrated simultaneously
+	Concurrency int
+
+	// DryRun checks keys against Storage without copying
+	DryRun bool
+
+	Logger *zap.Logger
+}
+
+// Migrate migrates keys until channel closed.
+// done is called on key completed, except failures so that they can be retried on resume
+func (m *Migrator) Migrate(ctx context.Context, keys <-chan string, done func(key string)) *MigrateReport {
+	report := &MigrateReport{
+		DryRun:  m.DryRun,
+		Copied:  []string{},
+		Missing: []string{},
+		Failed:  []MigrateFailure{},
+	}
+	logger := m.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	bucket := m.Bucket
+	if bucket == "" {
+		bucket = m.Fallback.DefaultBucket
+	}
+	if m.Bucket != "" {
+		ctx = context.WithValue(ctx, "aws-bucket", m.Bucket)
+	}
+	concurrency := m.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				status, err := m.migrate(ctx, bucket, key)
+				mu.Lock()
+				switch status {
+				case "existing":
+					report.Existing++
+				case "pending":
+					report.Pending = append(report.Pending, key)
+				case "copied":
+					report.Copied = append(report.Copied, key)
+				case "missing":
+					report.Missing = append(report.Missing, key)
+				default:
+					report.Failed = append(report.Failed, MigrateFailure{Key: key, Error: err.Error()})
+				}
+				if status != "failed" && done != nil {
+					done(key)
+				}
+				mu.Unlock()
+				if err != nil {
+					logger.Warn("migrate-error", zap.String("key", key), zap.Error(err))
+				} else {
+					logger.Debug("migrate", zap.String("key", key), zap.String("status", status))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func (m *Migrator) migrate(ctx context.Context, bucket, key string) (string, error) {
+	if _, err := m.Storage.Stat(ctx, key); err == nil {
+		return "existing", nil
+	} else if !isNotFound(err) {
+		return "failed", err
+	}
+	if m.DryRun {
+		return "pending", nil
+	}
+	blob, err := m.Fallback.Fetch(ctx, bucket, key)
+	if err != nil {
+		if isNotFound(err) {
+			return "missing", nil
+		}
+		return "failed", err
+	}
+	if err := m.Storage.Put(ctx, key, blob); err != nil {
+		m.Fallback.recordBackfill(bucket, "error")
+		return "failed", err
+	}
+	m.Fallback.recordBackfill(bucket, "success")
+	m.Fallback.onBackfill(ctx, key)
+	return "copied", nil
+}
+
+func isNotFound(err error) bool {
+	var e imagor.Error
+	return errors.As(err, &e) && e.Code == http.StatusNotFound
+}
@@ -0,0 +1,155 @@
+package fallbackloader
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+	"go.uber.org/zap"
+)
+
+// Option FallbackLoader option
+type Option func(l *FallbackLoader)
+
+// WithOrigins with fallback origin URL templates option, comma separated.
+// Supports {bucket}, {subdomain} and {key} placeholders e.g. https://{subdomain}.imgix.net/{key}
+func WithOrigins(origins ...string) Option {
+	return func(l *FallbackLoader) {
+		for _, raw := range origins {
+			for _, origin := range strings.Split(raw, ",") {
+				origin = strings.TrimSpace(origin)
+				if len(origin) > 0 {
+					l.Origins = append(l.Origins, origin)
+				}
+			}
+		}
+	}
+}
+
+// WithSubdomains with bucket to subdomain mapping option, comma separated bucket:subdomain
+// e.g. mrsool-business:mrsool
+func WithSubdomains(mappings ...string) Option {
+	return func(l *FallbackLoader) {
+		for _, raw := range mappings {
+			for _, mapping := range strings.Split(raw, ",") {
+				if idx := strings.Index(mapping, ":"); idx > -1 {
+					bucket := strings.TrimSpace(mapping[:idx])
+					subdomain := strings.TrimSpace(mapping[idx+1:])
+					if bucket != "" && subdomain != "" {
+						l.Subdomains[bucket] = subdomain
+					}
+				}
+			}
+		}
+	}
+}
+
+// WithBuckets with buckets allowed to fallback option, comma separated.
+// Allow all buckets resolved by the bucket resolver if empty, or only the default bucket without resolver
+func WithBuckets(buckets ...string) Option {
+	return func(l *FallbackLoader) {
+		for _, raw := range buckets {
+			for _, bucket := range strings.Split(raw, ",") {
+				bucket = strings.TrimSpace(bucket)
+				if len(bucket) > 0 {
+					l.Buckets = append(l.Buckets, bucket)
+				}
+			}
+		}
+	}
+}
+
+// WithDefaultBucket with default bucket option when request does not specify bucket
+func WithDefaultBucket(bucket string) Option {
+	return func(l *FallbackLoader) {
+		l.DefaultBucket = bucket
+	}
+}
+
+// WithBucketResolver with bucket resolver option,
+// resolving the request bucket of fallback origins and backfill in place of the wrapped Loader
+func WithBucketResolver(resolver imagor.BucketResolver) Option {
+	return func(l *FallbackLoader) {
+		if resolver != nil {
+			l.Resolver = resolver
+		}
+	}
+}
+
+// WithMaxAllowedSize with maximum allowed size option for fallback image,
+// DefaultMaxAllowedSize if not positive
+func WithMaxAllowedSize(maxAllowedSize int) Option {
+	return func(l *FallbackLoader) {
+		if maxAllowedSize > 0 {
+			l.MaxAllowedSize = maxAllowedSize
+		}
+	}
+}
+
+// WithConcurrency with maximum number of fallback requests simultaneously option
+func WithConcurrency(concurrency int64) Option {
+	return func(l *FallbackLoader) {
+		l.Concurrency = concurrency
+	}
+}
+
+// WithTimeout with fallback origin request timeout option
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *FallbackLoader) {
+		if timeout > 0 {
+			l.Timeout = timeout
+		}
+	}
+}
+
+// WithStorage with Storage option for backfilling fallback image asynchronously
+func WithStorage(storage imagor.Storage) Option {
+	return func(l *FallbackLoader) {
+		l.Storage = storage
+	}
+}
+
+// WithOnBackfill with callback option on image backfilled into Storage,
+// e.g. imagor.Imagor InvalidateNotFound
+func WithOnBackfill(onBackfill func(ctx context.Context, image string)) Option {
+	return func(l *FallbackLoader) {
+		l.OnBackfill = onBackfill
+	}
+}
+
+// WithSaveTimeout with timeout option for backfilling fallback image into Storage
+func WithSaveTimeout(timeout time.Duration) Option {
+	return func(l *FallbackLoader) {
+		if timeout > 0 {
+			l.SaveTimeout = timeout
+		}
+	}
+}
+
+// WithTransport with custom http.RoundTripper transport option
+func WithTransport(transport http.RoundTripper) Option {
+	return func(l *FallbackLoader) {
+		if transport != nil {
+			l.Transport = transport
+		}
+	}
+}
+
+// WithLogger with logger option
+func WithLogger(logger *zap.Logger) Option {
+	return func(l *FallbackLoader) {
+		if logger != nil {
+			l.Logger = logger
+		}
+	}
+}
+
+// WithInstrumentation with instrumentation option recording fallback and backfill metrics
+func WithInstrumentation(instrumentation *instrumentation.Instrumentation) Option {
+	return func(l *FallbackLoader) {
+		l.Instrumentation = instrumentation
+	}
+}
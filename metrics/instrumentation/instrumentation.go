@@ -28,11 +28,71 @@ var (
 		},
 		[]string{"package", "struct", "method", "status", "source"},
 	)
+
+	// NegativeCacheCounter tracks not found negative cache hits and stores by bucket
+	NegativeCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "imagor_negative_cache_total",
+			Help: "Total number of not found negative cache hits and stores",
+		},
+		[]string{"bucket", "status"},
+	)
+
+	// FallbackCounter tracks fallback origin hits and failures by bucket
+	FallbackCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "imagor_fallback_total",
+			Help: "Total number of fallback origin requests",
+		},
+		[]string{"bucket", "status"},
+	)
+
+	// BackfillCounter tracks backfill of fallback images into Storage by bucket
+	BackfillCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "imagor_fallback_backfill_total",
+			Help: "Total number of fallback images backfilled into storage",
+		},
+		[]string{"bucket", "status"},
+	)
+
+	// MemoryStorageCounter tracks memory storage hits and misses by storage name
+	MemoryStorageCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "imagor_memory_storage_total",
+			Help: "Total number of memory storage requests",
+		},
+		[]string{"name", "status"},
+	)
+
+	// MemoryStorageEvictionCounter tracks memory storage items evicted for space by storage name
+	MemoryStorageEvictionCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "imagor_memory_storage_evictions_total",
+			Help: "Total number of memory storage items evicted",
+		},
+		[]string{"name"},
+	)
+
+	// MemoryStorageSizeGauge tracks memory storage size in bytes by storage name
+	MemoryStorageSizeGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "imagor_memory_storage_bytes",
+			Help: "Total bytes of memory storage items",
+		},
+		[]string{"name"},
+	)
 )
 
 func init() {
 	prometheus.MustRegister(MethodLatency)
 	prometheus.MustRegister(MethodCounter)
+	prometheus.MustRegister(NegativeCacheCounter)
+	prometheus.MustRegister(FallbackCounter)
+	prometheus.MustRegister(BackfillCounter)
+	prometheus.MustRegister(MemoryStorageCounter)
+	prometheus.MustRegister(MemoryStorageEvictionCounter)
+	prometheus.MustRegister(MemoryStorageSizeGauge)
 }
 
 // Instrumentation provides method-level metrics tracking
@@ -151,3 +211,33 @@ func (i *Instrumentation) RecordMethodDuration(ctx context.Context, pkg, structN
 			zap.Error(err))
 	}
 }
+
+// RecordNegativeCache records not found negative cache hit or store of the bucket
+func (i *Instrumentation) RecordNegativeCache(bucket, status string) {
+	NegativeCacheCounter.WithLabelValues(bucket, status).Inc()
+}
+
+// RecordFallback records fallback origin hit or failure of the bucket
+func (i *Instrumentation) RecordFallback(bucket, status string) {
+	FallbackCounter.WithLabelValues(bucket, status).Inc()
+}
+
+// RecordBackfill records backfill success or error of fallback image of the bucket
+func (i *Instrumentation) RecordBackfill(bucket, status string) {
+	BackfillCounter.WithLabelValues(bucket, status).Inc()
+}
+
+// RecordMemoryStorage records memory storage hit or miss of the storage name
+func (i *Instrumentation) RecordMemoryStorage(name, status string) {
+	MemoryStorageCounter.WithLabelValues(name, status).Inc()
+}
+
+// RecordMemoryStorageEviction records memory storage item evicted of the storage name
+func (i *Instrumentation) RecordMemoryStorageEviction(name string) {
+	MemoryStorageEvictionCounter.WithLabelValues(name).Inc()
+}
+
+// RecordMemoryStorageSize records memory storage size in bytes of the storage name
+func (i *Instrumentation) RecordMemoryStorageSize(name string, size int64) {
+	MemoryStorageSizeGauge.WithLabelValues(name).Set(float64(size))
+}
@@ -0,0 +1,77 @@
+package imagor
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type negativeEntry struct {
+	key     string
+	expires time.Time
+}
+
+// negativeCache bounded LRU of not found image keys with time to live
+type negativeCache struct {
+	ttl   time.Duration
+	size  int
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newNegativeCache(ttl time.Duration, size int) *negativeCache {
+	return &negativeCache{
+		ttl:   ttl,
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+// Has returns if the key is cached as not found
+func (c *negativeCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(el.Value.(*negativeEntry).expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return false
+	}
+	c.ll.MoveToFront(el)
+	return true
+}
+
+// Set caches the key as not found, evicting the least recently used beyond size.
+// Returns false if already cached
+func (c *negativeCache) Set(key string) bool {
+	entry := &negativeEntry{key: key, expires: time.Now().Add(c.ttl)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return false
+	}
+	c.items[key] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*negativeEntry).key)
+	}
+	return true
+}
+
+// Delete invalidates not found cache of the key
+func (c *negativeCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
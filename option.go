@@ -1,6 +1,8 @@
 package imagor
 
 import (
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cshum/imagor/imagorpath"
@@ -168,6 +170,32 @@ func WithAutoAVIF(enable bool) Option {
 	}
 }
 
+// WithClientHints with client hints option, sizing images by Sec-CH-DPR, Sec-CH-Width,
+// Sec-CH-Viewport-Width and Save-Data request headers
+func WithClientHints(enable bool) Option {
+	return func(app *Imagor) {
+		app.ClientHints = enable
+	}
+}
+
+// WithMaxDPR with maximum device pixel ratio of dpr(n) filter and client hints
+func WithMaxDPR(dpr float64) Option {
+	return func(app *Imagor) {
+		if dpr > 0 {
+			app.MaxDPR = dpr
+		}
+	}
+}
+
+// WithSaveDataQuality with quality of images requested with Save-Data client hint, 0 to disable
+func WithSaveDataQuality(quality int) Option {
+	return func(app *Imagor) {
+		if quality >= 0 && quality <= 100 {
+			app.SaveDataQuality = quality
+		}
+	}
+}
+
 // WithAutoJPEG with auto JPEG option when JPEG or no specific format is requested
 func WithAutoJPEG(enable bool) Option {
 	return func(app *Imagor) {
@@ -175,6 +203,24 @@ func WithAutoJPEG(enable bool) Option {
 	}
 }
 
+// WithAutoFormats with candidate formats of format(auto) filter option, by csv e.g. avif,webp,jpeg.
+// Candidates other than jpeg, png and gif are limited by browser Accept header
+func WithAutoFormats(formats ...string) Option {
+	return func(app *Imagor) {
+		var autoFormats []string
+		for _, raw := range formats {
+			for _, format := range strings.Split(raw, ",") {
+				if format = strings.ToLower(strings.TrimSpace(format)); format != "" {
+					autoFormats = append(autoFormats, format)
+				}
+			}
+		}
+		if len(autoFormats) > 0 {
+			app.AutoFormats = autoFormats
+		}
+	}
+}
+
 // WithBasePathRedirect with base path redirect option
 func WithBasePathRedirect(url string) Option {
 	return func(app *Imagor) {
@@ -196,6 +242,22 @@ func WithModifiedTimeCheck(enabled bool) Option {
 	}
 }
 
+// WithResultStorageSWR with option serving stale result on modified time check
+// while re-processing in background, for source modified within the max staleness.
+// Source modified beyond max staleness is re-processed synchronously
+func WithResultStorageSWR(maxStaleness time.Duration) Option {
+	return func(app *Imagor) {
+		app.ResultStorageSWR = maxStaleness
+	}
+}
+
+// WithRevalidateConcurrency with maximum number of background revalidation simultaneously
+func WithRevalidateConcurrency(concurrency int64) Option {
+	return func(app *Imagor) {
+		app.RevalidateConcurrency = concurrency
+	}
+}
+
 // WithDisableErrorBody with disable error body option, resulting empty response on error
 func WithDisableErrorBody(disabled bool) Option {
 	return func(app *Imagor) {
@@ -244,9 +306,120 @@ func WithSigner(signer imagorpath.Signer) Option {
 	}
 }
 
+// WithTenantSigner with URL signature signer option of requests with AWS-BUCKET tenant,
+// in place of the default signer
+func WithTenantSigner(bucket string, signer imagorpath.Signer) Option {
+	return func(app *Imagor) {
+		if bucket != "" && signer != nil {
+			if app.TenantSigners == nil {
+				app.TenantSigners = map[string]imagorpath.Signer{}
+			}
+			app.TenantSigners[bucket] = signer
+		}
+	}
+}
+
 // WithEnablePostRequests with enable POST requests option
 func WithEnablePostRequests(enable bool) Option {
 	return func(app *Imagor) {
 		app.EnablePostRequests = enable
 	}
 }
+
+// WithImgixMode with imgix compatible query string endpoint option,
+// parsing image path and imgix query parameters in place of imagor endpoint
+func WithImgixMode(enabled bool) Option {
+	return func(app *Imagor) {
+		app.ImgixMode = enabled
+	}
+}
+
+// WithResultIndex with option to maintain source image to results index in result storages,
+// allowing results to be purged regardless of result storage path style
+func WithResultIndex(enabled bool) Option {
+	return func(app *Imagor) {
+		app.ResultIndex = enabled
+	}
+}
+
+// WithEnablePurgeEndpoint with enable DELETE /{hash}/purge/{image} endpoint option
+func WithEnablePurgeEndpoint(enabled bool) Option {
+	return func(app *Imagor) {
+		app.EnablePurgeEndpoint = enabled
+	}
+}
+
+// WithEnableCompareEndpoint with enable GET /compare/{hash}/{image}/{image} endpoint option,
+// responding Hamming distance of perceptual hashes of the images
+func WithEnableCompareEndpoint(enabled bool) Option {
+	return func(app *Imagor) {
+		app.EnableCompareEndpoint = enabled
+	}
+}
+
+// WithEnableDiffEndpoint with enable GET /diff/{hash}/{image}/{image} endpoint option,
+// responding pixel difference metrics of the images
+func WithEnableDiffEndpoint(enabled bool) Option {
+	return func(app *Imagor) {
+		app.EnableDiffEndpoint = enabled
+	}
+}
+
+// WithNegativeCacheTTL with time to live option of caching not found images,
+// skipping storages and loaders lookup of the image within the duration
+func WithNegativeCacheTTL(ttl time.Duration) Option {
+	return func(app *Imagor) {
+		if ttl > 0 {
+			app.NegativeCacheTTL = ttl
+		}
+	}
+}
+
+// WithNegativeCacheSize with maximum number of not found images cached option
+func WithNegativeCacheSize(size int) Option {
+	return func(app *Imagor) {
+		if size > 0 {
+			app.NegativeCacheSize = size
+		}
+	}
+}
+
+// WithFallbackImages with fallback images option served on source errors,
+// the first matching request bucket and image path prefix is processed with the request params
+func WithFallbackImages(images ...FallbackImage) Option {
+	return func(app *Imagor) {
+		for _, image := range images {
+			if image.Image != "" {
+				app.FallbackImages = append(app.FallbackImages, image)
+			}
+		}
+	}
+}
+
+// WithFallbackCacheTTL with HTTP Cache-Control header TTL option of fallback image response
+func WithFallbackCacheTTL(ttl time.Duration) Option {
+	return func(app *Imagor) {
+		if ttl >= 0 {
+			app.FallbackCacheTTL = ttl
+		}
+	}
+}
+
+// WithPresets with named params path fragments option,
+// expanded by preset:name/ path segment or preset(name) filter
+func WithPresets(presets imagorpath.Presets) Option {
+	return func(app *Imagor) {
+		if len(presets) > 0 {
+			app.Presets = presets
+		}
+	}
+}
+
+// WithClientIP with client IP resolver option of the ip(cidr) filter, default to request remote address
+func WithClientIP(fn func(r *http.Request) string) Option {
+	return func(app *Imagor) {
+		if fn != nil {
+			app.ClientIP = fn
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package vipsprocessor
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cshum/vipsgen/vips"
+	"go.uber.org/zap"
+)
+
+// parseAutoFormats parses candidate formats of format(auto,...) filter args
+func parseAutoFormats(args []string) (formats []vips.ImageType) {
+	for _, arg := range args {
+		if imageType, ok := imageTypeMap[strings.ToLower(strings.TrimSpace(arg))]; ok {
+			imageType = supportedSaveFormat(imageType)
+			if !slices.Contains(formats, imageType) {
+				formats = append(formats, imageType)
+			}
+		}
+	}
+	if len(formats) == 0 {
+		formats = []vips.ImageType{vips.ImageTypeJpeg}
+	}
+	return
+}
+
+// isSlowEncoding indicates if image type is expensive to encode
+func isSlowEncoding(format vips.ImageType) bool {
+	switch format {
+	case vips.ImageTypeAvif, vips.ImageTypeHeif, vips.ImageTypeJxl, vips.ImageTypeJp2k:
+		return true
+	}
+	return false
+}
+
+// autoFormatCandidates returns candidate formats applicable to the image,
+// in the order of encoding cost
+func autoFormatCandidates(img *vips.Image, formats []vips.ImageType) (candidates []vips.ImageType) {
+	isAnimated := img.Height() != img.PageHeight()
+	hasAlpha := img.HasAlpha()
+	for _, format := range formats {
+		if isAnimated && !IsAnimationSupported(format) {
+			continue
+		}
+		if hasAlpha && format == vips.ImageTypeJpeg {
+			// jpeg does not support alpha, png instead
+			format = vips.ImageTypePng
+		}
+		if !slices.Contains(candidates, format) {
+			candidates = append(candidates, format)
+		}
+	}
+	if len(candidates) == 0 {
+		if hasAlpha {
+			candidates = append(candidates, vips.ImageTypePng)
+		} else {
+			candidates = append(candidates, vips.ImageTypeJpeg)
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b vips.ImageType) int {
+		switch {
+		case !isSlowEncoding(a) && isSlowEncoding(b):
+			return -1
+		case isSlowEncoding(a) && !isSlowEncoding(b):
+			return 1
+		}
+		return 0
+	})
+	return
+}
+
+// exportAuto encodes the image in each of the candidate formats and returns the smallest output.
+// Candidates are skipped once AutoFormatBudget is exceeded
+func (v *Processor) exportAuto(
+	ctx context.Context, img *vips.Image, formats []vips.ImageType, quality int,
+	export func(format vips.ImageType, quality int) ([]byte, error),
+) (buf []byte, format vips.ImageType, q int, err error) {
+	var start = time.Now()
+	for i, candidate := range autoFormatCandidates(img, formats) {
+		if i > 0 && buf != nil {
+			if ctx.Err() != nil || (v.AutoFormatBudget > 0 && time.Since(start) > v.AutoFormatBudget) {
+				if v.Debug {
+					v.withContextLogger(ctx).Debug("auto_format_budget_exceeded",
+						zap.String("skipped", string(candidate)),
+						zap.Duration("elapsed", time.Since(start)))
+				}
+				break
+			}
+		}
+		cq := quality
+		if cq == 0 && len(v.QualityTable) > 0 {
+			cq = v.QualityTable.Quality(candidate, img.Width(), img.PageHeight())
+		}
+		out, e := export(candidate, cq)
+		if e != nil {
+			// encoder may not be available, try next candidate
+			err = e
+			continue
+		}
+		if v.Debug {
+			v.withContextLogger(ctx).Debug("auto_format",
+				zap.String("format", string(candidate)),
+				zap.Int("quality", cq),
+				zap.Int("bytes", len(out)))
+		}
+		if buf == nil || len(out) < len(buf) {
+			buf, format, q = out, candidate, cq
+		}
+	}
+	if buf != nil {
+		err = nil
+	}
+	return
+}
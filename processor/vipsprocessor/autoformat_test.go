@@ -0,0 +1,16 @@
+package vipsprocessor
+
+import (
+	"testing"
+
+	"github.com/cshum/vipsgen/vips"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAutoFormats(t *testing.T) {
+	assert.Equal(t, []vips.ImageType{vips.ImageTypeAvif, vips.ImageTypeWebp, vips.ImageTypeJpeg},
+		parseAutoFormats([]string{"avif", "webp", "jpeg", "jpg"}))
+	assert.Equal(t, []vips.ImageType{vips.ImageTypePng, vips.ImageTypeJpeg},
+		parseAutoFormats([]string{" PNG", "bmp", "foo"}))
+	assert.Equal(t, []vips.ImageType{vips.ImageTypeJpeg}, parseAutoFormats(nil))
+}
@@ -0,0 +1,168 @@
+package vipsprocessor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/cshum/vipsgen/vips"
+)
+
+const (
+	// colorsSize maximum dimension of the thumbnail colors are extracted from
+	colorsSize = 64
+	// maxPaletteColors maximum number of palette colors
+	maxPaletteColors = 16
+	// paletteIterations k-means iterations refining the palette
+	paletteIterations = 4
+)
+
+// Colors image dominant color, average color and palette
+type Colors struct {
+	Dominant string         `json:"dominant,omitempty"`
+	Average  string         `json:"average,omitempty"`
+	Palette  []PaletteColor `json:"palette"`
+}
+
+// PaletteColor palette color and its weight of the image
+type PaletteColor struct {
+	Color  string  `json:"color"`
+	Weight float64 `json:"weight"`
+}
+
+// newColors extracts colors of the image with palette of n colors
+func newColors(img *vips.Image, n int) (*Colors, error) {
+	buf, err := newPixelBuffer(img, pixelOptions{Width: colorsSize, Height: colorsSize, Size: vips.SizeDown})
+	if err != nil {
+		return nil, err
+	}
+	return extractColors(buf.Pix, buf.Bands, n), nil
+}
+
+// extractColors extracts average color and palette of n colors by median cut refined by k-means,
+// from pixels of 3 or 4 bands, ignoring mostly transparent pixels
+func extractColors(pix []byte, bands, n int) *Colors {
+	var pixels [][3]byte
+	var sum [3]int
+	for i := 0; i+bands <= len(pix); i += bands {
+		if bands == 4 && pix[i+3] < 128 {
+			continue
+		}
+		c := [3]byte{pix[i], pix[i+1], pix[i+2]}
+		pixels = append(pixels, c)
+		sum[0] += int(c[0])
+		sum[1] += int(c[1])
+		sum[2] += int(c[2])
+	}
+	colors := &Colors{Palette: []PaletteColor{}}
+	if len(pixels) == 0 {
+		return colors
+	}
+	total := len(pixels)
+	colors.Average = hexColor(sum[0]/total, sum[1]/total, sum[2]/total)
+
+	boxes := [][][3]byte{pixels}
+	for len(boxes) < n {
+		// split the box of the widest channel range at median
+		idx, channel, widest := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if ch, r := widestChannel(box); r > widest {
+				idx, channel, widest = i, ch, r
+			}
+		}
+		if idx < 0 {
+			break
+		}
+		box := boxes[idx]
+		slices.SortFunc(box, func(a, b [3]byte) int {
+			return int(a[channel]) - int(b[channel])
+		})
+		mid := len(box) / 2
+		boxes[idx] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+	// refine median cut centroids by k-means, weighted by nearest pixels
+	centroids := make([][3]float64, len(boxes))
+	for i, box := range boxes {
+		for _, c := range box {
+			for j := 0; j < 3; j++ {
+				centroids[i][j] += float64(c[j])
+			}
+		}
+		for j := 0; j < 3; j++ {
+			centroids[i][j] /= float64(len(box))
+		}
+	}
+	counts := make([]int, len(centroids))
+	for iter := 0; iter < paletteIterations; iter++ {
+		sums := make([][3]float64, len(centroids))
+		clear(counts)
+		for _, c := range pixels {
+			nearest, dist := 0, -1.0
+			for i, centroid := range centroids {
+				dr := float64(c[0]) - centroid[0]
+				dg := float64(c[1]) - centroid[1]
+				db := float64(c[2]) - centroid[2]
+				if d := dr*dr + dg*dg + db*db; dist < 0 || d < dist {
+					nearest, dist = i, d
+				}
+			}
+			counts[nearest]++
+			for j := 0; j < 3; j++ {
+				sums[nearest][j] += float64(c[j])
+			}
+		}
+		for i := range centroids {
+			if counts[i] > 0 {
+				for j := 0; j < 3; j++ {
+					centroids[i][j] = sums[i][j] / float64(counts[i])
+				}
+			}
+		}
+	}
+	for i, centroid := range centroids {
+		if counts[i] == 0 {
+			continue
+		}
+		colors.Palette = append(colors.Palette, PaletteColor{
+			Color:  hexColor(int(centroid[0]+0.5), int(centroid[1]+0.5), int(centroid[2]+0.5)),
+			Weight: math.Round(float64(counts[i])/float64(total)*1000) / 1000,
+		})
+	}
+	slices.SortStableFunc(colors.Palette, func(a, b PaletteColor) int {
+		switch {
+		case a.Weight > b.Weight:
+			return -1
+		case a.Weight < b.Weight:
+			return 1
+		}
+		return 0
+	})
+	colors.Dominant = colors.Palette[0].Color
+	return colors
+}
+
+// widestChannel returns the channel of the widest range among colors and its range
+func widestChannel(colors [][3]byte) (channel, width int) {
+	lo := [3]byte{255, 255, 255}
+	var hi [3]byte
+	for _, c := range colors {
+		for i := 0; i < 3; i++ {
+			lo[i] = min(lo[i], c[i])
+			hi[i] = max(hi[i], c[i])
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if w := int(hi[i]) - int(lo[i]); w > width {
+			channel, width = i, w
+		}
+	}
+	return
+}
+
+func hexColor(r, g, b int) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
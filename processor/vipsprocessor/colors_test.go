@@ -0,0 +1,48 @@
+package vipsprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractColors(t *testing.T) {
+	pixels := func(bands int, colors ...[]byte) []byte {
+		var pix []byte
+		for _, c := range colors {
+			pix = append(pix, c[:bands]...)
+		}
+		return pix
+	}
+	repeat := func(n int, c []byte) (colors [][]byte) {
+		for i := 0; i < n; i++ {
+			colors = append(colors, c)
+		}
+		return
+	}
+	red := []byte{255, 0, 0, 255}
+	blue := []byte{0, 0, 255, 255}
+	transparent := []byte{0, 255, 0, 0}
+
+	colors := extractColors(pixels(3, repeat(10, red)...), 3, 5)
+	assert.Equal(t, "#ff0000", colors.Dominant)
+	assert.Equal(t, "#ff0000", colors.Average)
+	assert.Equal(t, []PaletteColor{{Color: "#ff0000", Weight: 1}}, colors.Palette)
+
+	colors = extractColors(pixels(3, append(repeat(30, red), repeat(10, blue)...)...), 3, 2)
+	assert.Equal(t, "#ff0000", colors.Dominant)
+	assert.Equal(t, "#bf003f", colors.Average)
+	assert.Equal(t, []PaletteColor{
+		{Color: "#ff0000", Weight: 0.75},
+		{Color: "#0000ff", Weight: 0.25},
+	}, colors.Palette)
+
+	colors = extractColors(pixels(4, append(repeat(10, transparent), repeat(5, blue)...)...), 4, 3)
+	assert.Equal(t, "#0000ff", colors.Dominant)
+	assert.Equal(t, []PaletteColor{{Color: "#0000ff", Weight: 1}}, colors.Palette)
+
+	colors = extractColors(pixels(4, repeat(4, transparent)...), 4, 3)
+	assert.Empty(t, colors.Dominant)
+	assert.Empty(t, colors.Average)
+	assert.Empty(t, colors.Palette)
+}
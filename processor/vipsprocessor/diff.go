@@ -0,0 +1,138 @@
+package vipsprocessor
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/vipsgen/vips"
+)
+
+// maxPSNR PSNR reported for identical images
+const maxPSNR = 100
+
+var errDiffPixels = errors.New("vipsprocessor: unsupported diff pixels")
+
+// Diff compares pixels of image b against image a, implements imagor.Differ.
+// Image b is resized to the dimension of image a if differs,
+// and transparent pixels are compared flattened on white.
+// Visual diff image is returned as PNG if visual
+func (v *Processor) Diff(
+	ctx context.Context, a, b *imagor.Blob, threshold float64, visual bool,
+) (*imagor.DiffResult, *imagor.Blob, error) {
+	imgA, err := v.NewImage(ctx, a, 1, 1, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer imgA.Close()
+	imgB, err := v.NewImage(ctx, b, 1, 1, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer imgB.Close()
+	if err = imgA.Autorot(); err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	if err = imgB.Autorot(); err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	width, height := imgA.Width(), imgA.Height()
+	res := &imagor.DiffResult{Width: width, Height: height}
+	if imgB.Width() != width || imgB.Height() != height {
+		res.Resized = true
+		if err = imgB.ThumbnailImage(width, &vips.ThumbnailImageOptions{
+			Height:   height,
+			Size:     vips.SizeForce,
+			NoRotate: true,
+		}); err != nil {
+			return nil, nil, WrapErr(err)
+		}
+	}
+	bufA, err := newPixelBuffer(imgA, pixelOptions{Flatten: true})
+	if err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	bufB, err := newPixelBuffer(imgB, pixelOptions{Flatten: true})
+	if err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	pixA, pixB := bufA.Pix, bufB.Pix
+	if len(pixA) != width*height*3 || len(pixB) != len(pixA) {
+		return nil, nil, errDiffPixels
+	}
+	out := diffPixels(res, pixA, pixB, threshold, visual)
+	score, err := ssim(lumaOf(pixA, width, height), lumaOf(pixB, width, height))
+	if err != nil {
+		return nil, nil, err
+	}
+	res.SSIM = math.Round(score*1e6) / 1e6
+	if !visual {
+		return res, nil, nil
+	}
+	img, err := vips.NewImageFromMemory(out, width, height, 3)
+	if err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	defer img.Close()
+	buf, err := img.PngsaveBuffer(nil)
+	if err != nil {
+		return nil, nil, WrapErr(err)
+	}
+	return res, imagor.NewBlobFromBytes(buf), nil
+}
+
+// diffPixels sets PSNR and mismatch of RGB pixels b against a on the result,
+// pixels of which any channel differs by more than threshold of the range are mismatched.
+// Returns the visual diff pixels if visual, mismatched pixels highlighted in red
+// over a faded grayscale of image a
+func diffPixels(res *imagor.DiffResult, a, b []byte, threshold float64, visual bool) (out []byte) {
+	if visual {
+		out = make([]byte, len(a))
+	}
+	limit := int(math.Round(threshold * 255))
+	var sse float64
+	for i := 0; i+2 < len(a); i += 3 {
+		var delta int
+		for c := 0; c < 3; c++ {
+			d := int(a[i+c]) - int(b[i+c])
+			sse += float64(d * d)
+			if d < 0 {
+				d = -d
+			}
+			delta = max(delta, d)
+		}
+		mismatched := delta > limit
+		if mismatched {
+			res.MismatchPixels++
+		}
+		if visual {
+			if mismatched {
+				out[i], out[i+1], out[i+2] = 255, 0, 0
+			} else {
+				// luma blended 10% over white
+				y := (299*int(a[i]) + 587*int(a[i+1]) + 114*int(a[i+2])) / 1000
+				g := byte(255 - (255-y)/10)
+				out[i], out[i+1], out[i+2] = g, g, g
+			}
+		}
+	}
+	if n := len(a) / 3; n > 0 {
+		res.Mismatch = math.Round(float64(res.MismatchPixels)*100/float64(n)*1000) / 1000
+	}
+	res.PSNR = maxPSNR
+	if mse := sse / float64(len(a)); mse > 0 {
+		res.PSNR = min(math.Round(10*math.Log10(255*255/mse)*1000)/1000, maxPSNR)
+	}
+	return
+}
+
+// lumaOf returns luminance plane of RGB pixels
+func lumaOf(pix []byte, width, height int) *pixelBuffer {
+	luma := make([]byte, width*height)
+	for i := range luma {
+		p := pix[i*3 : i*3+3]
+		luma[i] = byte((299*int(p[0]) + 587*int(p[1]) + 114*int(p[2]) + 500) / 1000)
+	}
+	return &pixelBuffer{Pix: luma, Width: width, Height: height, Bands: 1}
+}
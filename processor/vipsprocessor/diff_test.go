@@ -0,0 +1,48 @@
+package vipsprocessor
+
+import (
+	"testing"
+
+	"github.com/cshum/imagor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPixels(t *testing.T) {
+	fill := func(n int, r, g, b byte) []byte {
+		pix := make([]byte, 0, n*3)
+		for i := 0; i < n; i++ {
+			pix = append(pix, r, g, b)
+		}
+		return pix
+	}
+	a := fill(100, 200, 100, 50)
+	res := &imagor.DiffResult{}
+	assert.Nil(t, diffPixels(res, a, a, 0.1, false))
+	assert.Equal(t, &imagor.DiffResult{PSNR: maxPSNR}, res)
+
+	// uniform error of 16 levels within threshold
+	res = &imagor.DiffResult{}
+	diffPixels(res, a, fill(100, 216, 116, 66), 0.1, false)
+	assert.Equal(t, 24.048, res.PSNR)
+	assert.Zero(t, res.MismatchPixels)
+	assert.Zero(t, res.Mismatch)
+
+	b := append(fill(75, 200, 100, 50), fill(25, 200, 100, 150)...)
+	res = &imagor.DiffResult{}
+	out := diffPixels(res, a, b, 0.1, true)
+	assert.Equal(t, 25, res.MismatchPixels)
+	assert.Equal(t, float64(25), res.Mismatch)
+	assert.Equal(t, []byte{255, 0, 0}, out[len(out)-3:])
+	assert.Equal(t, []byte{242, 242, 242}, out[:3])
+
+	res = &imagor.DiffResult{}
+	diffPixels(res, a, b, 0.5, false)
+	assert.Zero(t, res.MismatchPixels)
+}
+
+func TestLumaOf(t *testing.T) {
+	plane := lumaOf([]byte{255, 255, 255, 255, 0, 0, 0, 0, 0, 0, 255, 0}, 2, 2)
+	assert.Equal(t, []byte{255, 76, 0, 150}, plane.Pix)
+	assert.Equal(t, 2, plane.Width)
+	assert.Equal(t, 2, plane.Height)
+}
@@ -0,0 +1,56 @@
+package vipsprocessor
+
+// #cgo pkg-config: vips
+// #include <stdlib.h>
+// #include <vips/vips.h>
+import "C"
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+
+	"github.com/cshum/vipsgen/vips"
+)
+
+var errFields = errors.New("vipsprocessor: metadata fields not accessible")
+
+// vipsImage returns the VipsImage of the image for metadata operations not exposed by vipsgen,
+// nil if not accessible
+func vipsImage(img *vips.Image) *C.VipsImage {
+	v := reflect.ValueOf(img).Elem().FieldByName("image")
+	if !v.IsValid() || v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil
+	}
+	return (*C.VipsImage)(v.UnsafePointer())
+}
+
+// removeFields removes metadata fields of the image in place.
+// The image must not be shared e.g. a copy
+func removeFields(img *vips.Image, fields ...string) error {
+	in := vipsImage(img)
+	if in == nil {
+		return errFields
+	}
+	for _, field := range fields {
+		name := C.CString(field)
+		C.vips_image_remove(in, name)
+		C.free(unsafe.Pointer(name))
+	}
+	return nil
+}
+
+// setBlob sets blob metadata field of the image in place, removes the field if empty.
+// The image must not be shared e.g. a copy
+func setBlob(img *vips.Image, field string, data []byte) error {
+	if len(data) == 0 {
+		return removeFields(img, field)
+	}
+	in := vipsImage(img)
+	if in == nil {
+		return errFields
+	}
+	name := C.CString(field)
+	defer C.free(unsafe.Pointer(name))
+	C.vips_image_set_blob_copy(in, name, unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	return nil
+}
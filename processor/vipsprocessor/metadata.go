@@ -0,0 +1,479 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/vipsgen/vips"
+)
+
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xmlNS = "http://www.w3.org/XML/1998/namespace"
+)
+
+// ExtendedMetadata extended image attributes of the extended_meta() filter
+type ExtendedMetadata struct {
+	FileSize   int64          `json:"file_size,omitempty"`
+	HasAlpha   bool           `json:"has_alpha"`
+	BitDepth   int            `json:"bit_depth"`
+	ColorSpace string         `json:"color_space"`
+	ICC        *ICCProfile    `json:"icc,omitempty"`
+	XMP        map[string]any `json:"xmp,omitempty"`
+	IPTC       map[string]any `json:"iptc,omitempty"`
+	GPS        *GPS           `json:"gps,omitempty"`
+	Delays     []int          `json:"delays,omitempty"`
+	Loop       *int           `json:"loop,omitempty"`
+}
+
+// ICCProfile embedded ICC profile attributes
+type ICCProfile struct {
+	Description string `json:"description,omitempty"`
+	ColorSpace  string `json:"color_space"`
+	Version     string `json:"version"`
+	Size        int    `json:"size"`
+}
+
+// GPS image location parsed from Exif GPS tags
+type GPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+var interpretationNames = map[vips.Interpretation]string{
+	vips.InterpretationMultiband: "multiband",
+	vips.InterpretationBW:        "b-w",
+	vips.InterpretationHistogram: "histogram",
+	vips.InterpretationXyz:       "xyz",
+	vips.InterpretationLab:       "lab",
+	vips.InterpretationCmyk:      "cmyk",
+	vips.InterpretationLabq:      "labq",
+	vips.InterpretationRgb:       "rgb",
+	vips.InterpretationCmc:       "cmc",
+	vips.InterpretationLch:       "lch",
+	vips.InterpretationLabs:      "labs",
+	vips.InterpretationSrgb:      "srgb",
+	vips.InterpretationYxy:       "yxy",
+	vips.InterpretationFourier:   "fourier",
+	vips.InterpretationRgb16:     "rgb16",
+	vips.InterpretationGrey16:    "grey16",
+	vips.InterpretationMatrix:    "matrix",
+	vips.InterpretationScrgb:     "scrgb",
+	vips.InterpretationHsv:       "hsv",
+}
+
+// iptcDatasets IPTC IIM application record datasets and if repeatable
+var iptcDatasets = map[byte]struct {
+	Name       string
+	Repeatable bool
+}{
+	5:   {"ObjectName", false},
+	7:   {"EditStatus", false},
+	10:  {"Urgency", false},
+	12:  {"SubjectReference", true},
+	15:  {"Category", false},
+	20:  {"SupplementalCategories", true},
+	25:  {"Keywords", true},
+	40:  {"SpecialInstructions", false},
+	55:  {"DateCreated", false},
+	60:  {"TimeCreated", false},
+	65:  {"OriginatingProgram", false},
+	80:  {"Byline", true},
+	85:  {"BylineTitle", true},
+	90:  {"City", false},
+	92:  {"Sublocation", false},
+	95:  {"ProvinceState", false},
+	100: {"CountryCode", false},
+	101: {"Country", false},
+	103: {"OriginalTransmissionReference", false},
+	105: {"Headline", false},
+	110: {"Credit", false},
+	115: {"Source", false},
+	116: {"CopyrightNotice", false},
+	118: {"Contact", true},
+	120: {"Caption", false},
+	122: {"WriterEditor", true},
+}
+
+// extendedMetadata extracts extended attributes of the image and its source blob,
+// omitting metadata not kept by the policy
+func extendedMetadata(img *vips.Image, blob *imagor.Blob, format vips.ImageType, policy MetadataPolicy) *ExtendedMetadata {
+	meta := &ExtendedMetadata{
+		HasAlpha:   img.HasAlpha(),
+		BitDepth:   bitDepth(img),
+		ColorSpace: interpretationNames[img.Interpretation()],
+	}
+	if blob != nil {
+		meta.FileSize = blob.Size()
+	}
+	if policy&MetadataICC != 0 {
+		if icc, ok := img.GetICCProfile(); ok {
+			meta.ICC = parseICCProfile(icc)
+		}
+	}
+	if policy&MetadataXMP != 0 && img.HasField("xmp-data") {
+		if data, err := img.GetBlob("xmp-data"); err == nil {
+			ok := true
+			if policy&MetadataGPS == 0 {
+				data, ok = removeXMPLocation(data)
+			}
+			if ok {
+				meta.XMP = parseXMP(data)
+			}
+		}
+	}
+	if policy&MetadataIPTC != 0 && img.HasField("iptc-data") {
+		if data, err := img.GetBlob("iptc-data"); err == nil {
+			ok := true
+			if policy&MetadataGPS == 0 {
+				data, ok = removeIPTCLocation(data)
+			}
+			if ok {
+				meta.IPTC = parseIPTC(data)
+			}
+		}
+	}
+	if policy&MetadataGPS != 0 {
+		meta.GPS = parseGPS(img.Exif())
+	}
+	if IsAnimationSupported(format) && img.Height() > img.PageHeight() {
+		if delays, err := img.PageDelay(); err == nil && len(delays) > 0 {
+			meta.Delays = delays
+		}
+		if img.HasField("loop") {
+			if loop, err := img.GetInt("loop"); err == nil {
+				meta.Loop = &loop
+			}
+		}
+	}
+	return meta
+}
+
+// bitDepth returns bits per sample of the image
+func bitDepth(img *vips.Image) int {
+	if img.HasField("bits-per-sample") {
+		if bits, err := img.GetInt("bits-per-sample"); err == nil && bits > 0 {
+			return bits
+		}
+	}
+	switch img.BandFormat() {
+	case vips.BandFormatUchar, vips.BandFormatChar:
+		return 8
+	case vips.BandFormatUshort, vips.BandFormatShort:
+		return 16
+	case vips.BandFormatUint, vips.BandFormatInt, vips.BandFormatFloat, vips.BandFormatComplex:
+		return 32
+	case vips.BandFormatDouble, vips.BandFormatDpcomplex:
+		return 64
+	}
+	return 0
+}
+
+// parseICCProfile parses header and description tag of ICC profile
+// https://www.color.org/specification/ICC.1-2022-05.pdf
+func parseICCProfile(data []byte) *ICCProfile {
+	if len(data) < 132 {
+		return nil
+	}
+	icc := &ICCProfile{
+		ColorSpace: strings.TrimSpace(string(data[16:20])),
+		Version:    fmt.Sprintf("%d.%d", data[8], data[9]>>4),
+		Size:       len(data),
+	}
+	count := int(binary.BigEndian.Uint32(data[128:132]))
+	for i := 0; i < count; i++ {
+		entry := 132 + i*12
+		if entry+12 > len(data) {
+			break
+		}
+		if string(data[entry:entry+4]) != "desc" {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+4:]))
+		size := int(binary.BigEndian.Uint32(data[entry+8:]))
+		if offset < 0 || size < 12 || offset+size > len(data) {
+			break
+		}
+		icc.Description = iccText(data[offset : offset+size])
+		break
+	}
+	return icc
+}
+
+// iccText decodes ICC text description or multi localized unicode tag
+func iccText(tag []byte) string {
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(binary.BigEndian.Uint32(tag[8:12]))
+		if n > len(tag)-12 {
+			n = len(tag) - 12
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00 ")
+	case "mluc":
+		if len(tag) < 28 {
+			return ""
+		}
+		// first localized record
+		n := int(binary.BigEndian.Uint32(tag[20:24]))
+		offset := int(binary.BigEndian.Uint32(tag[24:28]))
+		if offset+n > len(tag) {
+			return ""
+		}
+		units := make([]uint16, 0, n/2)
+		for i := offset; i+1 < offset+n; i += 2 {
+			units = append(units, binary.BigEndian.Uint16(tag[i:]))
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00 ")
+	}
+	return ""
+}
+
+// parseXMP parses properties of XMP packet into map keyed by prefixed property name,
+// array values into slices and structure values into maps
+func parseXMP(data []byte) map[string]any {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	prefixes := map[string]string{}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			addXMPPrefixes(prefixes, start)
+			if start.Name.Space == rdfNS && start.Name.Local == "RDF" {
+				if fields, ok := xmpValue(d, start, prefixes).(map[string]any); ok {
+					return fields
+				}
+				return nil
+			}
+		}
+	}
+}
+
+func addXMPPrefixes(prefixes map[string]string, start xml.StartElement) {
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" {
+			prefixes[attr.Value] = attr.Name.Local
+		}
+	}
+}
+
+func xmpName(prefixes map[string]string, name xml.Name) string {
+	if prefix, ok := prefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Local
+}
+
+// xmpValue decodes XMP value until the end of start element,
+// with rdf containers and descriptions being transparent
+func xmpValue(d *xml.Decoder, start xml.StartElement, prefixes map[string]string) any {
+	var (
+		text   strings.Builder
+		items  []any
+		fields = map[string]any{}
+		isAlt  bool
+		depth  int
+	)
+	addAttrs := func(start xml.StartElement) {
+		for _, attr := range start.Attr {
+			switch {
+			case attr.Name.Space == rdfNS && attr.Name.Local == "resource":
+				text.WriteString(attr.Value)
+			case attr.Name.Space == "xmlns", attr.Name.Space == rdfNS, attr.Name.Space == xmlNS,
+				attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			default:
+				fields[xmpName(prefixes, attr.Name)] = attr.Value
+			}
+		}
+	}
+	addAttrs(start)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			addXMPPrefixes(prefixes, t)
+			switch {
+			case t.Name.Space == rdfNS && t.Name.Local == "li":
+				items = append(items, xmpValue(d, t, prefixes))
+			case t.Name.Space == rdfNS:
+				// Seq, Bag, Alt and Description
+				isAlt = isAlt || t.Name.Local == "Alt"
+				addAttrs(t)
+				depth++
+			default:
+				fields[xmpName(prefixes, t.Name)] = xmpValue(d, t, prefixes)
+			}
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			switch {
+			case len(items) > 0 && isAlt:
+				return items[0]
+			case len(items) > 0:
+				return items
+			case len(fields) > 0:
+				return fields
+			}
+			return strings.TrimSpace(text.String())
+		case xml.CharData:
+			text.Write(t)
+		}
+	}
+	return nil
+}
+
+// parseIPTC parses application record datasets of IPTC IIM data,
+// either raw or wrapped in Photoshop image resource blocks
+func parseIPTC(data []byte) map[string]any {
+	iim := data
+	if len(data) > 0 && data[0] != 0x1c {
+		iim = nil
+		if start, end := iptcIIMRange(data); start >= 0 {
+			iim = data[start:end]
+		}
+	}
+	iptc := map[string]any{}
+	for i := 0; i+5 <= len(iim) && iim[i] == 0x1c; {
+		record, dataset := iim[i+1], iim[i+2]
+		size := int(binary.BigEndian.Uint16(iim[i+3:]))
+		i += 5
+		if size&0x8000 != 0 || i+size > len(iim) {
+			// extended dataset not supported
+			break
+		}
+		value := iptcString(iim[i : i+size])
+		i += size
+		ds, ok := iptcDatasets[dataset]
+		if record != 2 || !ok || value == "" {
+			continue
+		}
+		if ds.Repeatable {
+			values, _ := iptc[ds.Name].([]string)
+			iptc[ds.Name] = append(values, value)
+		} else {
+			iptc[ds.Name] = value
+		}
+	}
+	if len(iptc) == 0 {
+		return nil
+	}
+	return iptc
+}
+
+// iptcIIMRange returns offsets of IPTC IIM data in Photoshop image resource blocks,
+// -1 if not found
+func iptcIIMRange(data []byte) (int, int) {
+	i := bytes.Index(data, []byte("8BIM"))
+	for i >= 0 && i+8 <= len(data) && string(data[i:i+4]) == "8BIM" {
+		id := binary.BigEndian.Uint16(data[i+4:])
+		// pascal string name padded to even length
+		n := int(data[i+6]) + 1
+		n += n % 2
+		j := i + 6 + n
+		if j+4 > len(data) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(data[j:]))
+		j += 4
+		if size < 0 || j+size > len(data) {
+			break
+		}
+		if id == 0x0404 {
+			return j, j + size
+		}
+		i = j + size + size%2
+	}
+	return -1, -1
+}
+
+// iptcString decodes IPTC value as UTF-8, or Latin-1 if not valid UTF-8
+func iptcString(b []byte) string {
+	if utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+// parseGPS parses GPS coordinates from libvips Exif fields
+func parseGPS(exif map[string]string) *GPS {
+	lat, ok := gpsCoordinate(exif["exif-ifd3-GPSLatitude"], exif["exif-ifd3-GPSLatitudeRef"], "S")
+	if !ok {
+		return nil
+	}
+	lng, ok := gpsCoordinate(exif["exif-ifd3-GPSLongitude"], exif["exif-ifd3-GPSLongitudeRef"], "W")
+	if !ok {
+		return nil
+	}
+	gps := &GPS{Latitude: lat, Longitude: lng}
+	if alt, ok := exifRationals(exif["exif-ifd3-GPSAltitude"]); ok && len(alt) == 1 {
+		altitude := alt[0]
+		if ref := strings.ToLower(exifStringShort(exif["exif-ifd3-GPSAltitudeRef"])); ref == "1" || strings.Contains(ref, "below") {
+			altitude = -altitude
+		}
+		gps.Altitude = &altitude
+	}
+	return gps
+}
+
+// gpsCoordinate converts degrees, minutes and seconds to decimal degrees,
+// negative if ref is the negative reference
+func gpsCoordinate(value, ref, negative string) (float64, bool) {
+	dms, ok := exifRationals(value)
+	if !ok {
+		return 0, false
+	}
+	var deg float64
+	for i, v := range dms {
+		if i < 3 {
+			deg += v / math.Pow(60, float64(i))
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(exifStringShort(ref)), negative) {
+		deg = -deg
+	}
+	return math.Round(deg*1e7) / 1e7, true
+}
+
+// exifRationals parses rational values of libvips Exif string e.g. "51/1 30/1 4012/100 (51, 30, 40.12, ...)"
+func exifRationals(value string) (values []float64, ok bool) {
+	fields := strings.Fields(exifStringShort(value))
+	if len(fields) == 0 {
+		return nil, false
+	}
+	for _, field := range fields {
+		num, den, isRational := strings.Cut(field, "/")
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, false
+		}
+		if isRational {
+			d, err := strconv.ParseFloat(den, 64)
+			if err != nil || d == 0 {
+				return nil, false
+			}
+			n /= d
+		}
+		values = append(values, n)
+	}
+	return values, true
+}
@@ -0,0 +1,133 @@
+package vipsprocessor
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseICCProfile(t *testing.T) {
+	profile := func(version byte, colorSpace string, tag []byte) []byte {
+		data := make([]byte, 144, 144+len(tag))
+		data[8], data[9] = version, 0x30
+		copy(data[16:20], colorSpace)
+		binary.BigEndian.PutUint32(data[128:], 1)
+		copy(data[132:136], "desc")
+		binary.BigEndian.PutUint32(data[136:], 144)
+		binary.BigEndian.PutUint32(data[140:], uint32(len(tag)))
+		return append(data, tag...)
+	}
+	desc := []byte("desc\x00\x00\x00\x00\x00\x00\x00\x0dsRGB IEC61966\x00")
+	assert.Equal(t, &ICCProfile{
+		Description: "sRGB IEC61966",
+		ColorSpace:  "RGB",
+		Version:     "2.3",
+		Size:        144 + len(desc),
+	}, parseICCProfile(profile(2, "RGB ", desc)))
+
+	name := utf16.Encode([]rune("Display P3"))
+	mluc := make([]byte, 28, 28+len(name)*2)
+	copy(mluc, "mluc")
+	binary.BigEndian.PutUint32(mluc[8:], 1)
+	binary.BigEndian.PutUint32(mluc[12:], 12)
+	copy(mluc[16:20], "enUS")
+	binary.BigEndian.PutUint32(mluc[20:], uint32(len(name)*2))
+	binary.BigEndian.PutUint32(mluc[24:], 28)
+	for _, u := range name {
+		mluc = binary.BigEndian.AppendUint16(mluc, u)
+	}
+	icc := parseICCProfile(profile(4, "RGB ", mluc))
+	assert.Equal(t, "Display P3", icc.Description)
+	assert.Equal(t, "4.3", icc.Version)
+
+	assert.Nil(t, parseICCProfile([]byte("foo")))
+	assert.Equal(t, "CMYK", parseICCProfile(profile(2, "CMYK", []byte("bar"))).ColorSpace)
+}
+
+func TestParseXMP(t *testing.T) {
+	xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:Iptc4xmpCore="http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/"
+    xmp:CreatorTool="imagor">
+   <dc:creator><rdf:Seq><rdf:li>Jane Doe</rdf:li></rdf:Seq></dc:creator>
+   <dc:subject><rdf:Bag><rdf:li>gopher</rdf:li><rdf:li>mascot</rdf:li></rdf:Bag></dc:subject>
+   <dc:rights><rdf:Alt><rdf:li xml:lang="x-default">(c) Jane Doe</rdf:li></rdf:Alt></dc:rights>
+   <Iptc4xmpCore:CreatorContactInfo rdf:parseType="Resource">
+    <Iptc4xmpCore:CiAdrCity>Hong Kong</Iptc4xmpCore:CiAdrCity>
+   </Iptc4xmpCore:CreatorContactInfo>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+	assert.Equal(t, map[string]any{
+		"xmp:CreatorTool": "imagor",
+		"dc:creator":      []any{"Jane Doe"},
+		"dc:subject":      []any{"gopher", "mascot"},
+		"dc:rights":       "(c) Jane Doe",
+		"Iptc4xmpCore:CreatorContactInfo": map[string]any{
+			"Iptc4xmpCore:CiAdrCity": "Hong Kong",
+		},
+	}, parseXMP([]byte(xmp)))
+	assert.Nil(t, parseXMP([]byte("not xmp")))
+}
+
+func TestParseIPTC(t *testing.T) {
+	dataset := func(record, dataset byte, value string) []byte {
+		b := []byte{0x1c, record, dataset, 0, 0}
+		binary.BigEndian.PutUint16(b[3:], uint16(len(value)))
+		return append(b, value...)
+	}
+	var iim []byte
+	iim = append(iim, dataset(1, 90, "\x1b%G")...)
+	iim = append(iim, dataset(2, 5, "Gopher")...)
+	iim = append(iim, dataset(2, 25, "go")...)
+	iim = append(iim, dataset(2, 25, "mascot")...)
+	iim = append(iim, dataset(2, 116, "(c) Jane Doe")...)
+	iim = append(iim, dataset(2, 90, "Z\xfcrich")...)
+	expected := map[string]any{
+		"ObjectName":      "Gopher",
+		"Keywords":        []string{"go", "mascot"},
+		"CopyrightNotice": "(c) Jane Doe",
+		"City":            "Zürich",
+	}
+	assert.Equal(t, expected, parseIPTC(iim))
+
+	// Photoshop image resource blocks
+	var psd []byte
+	psd = append(psd, "Photoshop 3.0\x00"...)
+	psd = append(psd, "8BIM\x03\xed\x00\x00\x00\x00\x00\x02ab"...)
+	psd = append(psd, "8BIM\x04\x04\x00\x00"...)
+	psd = binary.BigEndian.AppendUint32(psd, uint32(len(iim)))
+	psd = append(psd, iim...)
+	assert.Equal(t, expected, parseIPTC(psd))
+
+	assert.Nil(t, parseIPTC([]byte("foo")))
+}
+
+func TestParseGPS(t *testing.T) {
+	assert.Equal(t, &GPS{Latitude: 22.3192083, Longitude: -114.1693611}, parseGPS(map[string]string{
+		"exif-ifd3-GPSLatitude":     "22/1 19/1 915/100 (22, 19, 9.15, Rational, 3 components, 24 bytes)",
+		"exif-ifd3-GPSLatitudeRef":  "N (N, ASCII, 2 components, 2 bytes)",
+		"exif-ifd3-GPSLongitude":    "114/1 10/1 970/100 (114, 10, 9.70, Rational, 3 components, 24 bytes)",
+		"exif-ifd3-GPSLongitudeRef": "W (W, ASCII, 2 components, 2 bytes)",
+	}))
+	altitude := -12.5
+	assert.Equal(t, &GPS{Latitude: -33.8688, Longitude: 151.2093, Altitude: &altitude}, parseGPS(map[string]string{
+		"exif-ifd3-GPSLatitude":     "33/1 52/1 768/100 (33, 52, 7.68, Rational, 3 components, 24 bytes)",
+		"exif-ifd3-GPSLatitudeRef":  "S (S, ASCII, 2 components, 2 bytes)",
+		"exif-ifd3-GPSLongitude":    "151/1 12/1 3348/100 (151, 12, 33.48, Rational, 3 components, 24 bytes)",
+		"exif-ifd3-GPSLongitudeRef": "E (E, ASCII, 2 components, 2 bytes)",
+		"exif-ifd3-GPSAltitude":     "25/2 (12.50, Rational, 1 components, 8 bytes)",
+		"exif-ifd3-GPSAltitudeRef":  "1 (Below sea level, Byte, 1 components, 1 bytes)",
+	}))
+	assert.Nil(t, parseGPS(map[string]string{
+		"exif-ifd3-GPSLatitude": "22/1 19/1 915/100 (22, 19, 9.15, Rational, 3 components, 24 bytes)",
+	}))
+	assert.Nil(t, parseGPS(map[string]string{}))
+}
@@ -0,0 +1,277 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/cshum/vipsgen/vips"
+)
+
+// MetadataPolicy set of metadata categories kept on export
+type MetadataPolicy uint16
+
+// MetadataPolicy categories
+const (
+	// MetadataICC ICC color profile
+	MetadataICC MetadataPolicy = 1 << iota
+	// MetadataExif Exif tags other than GPS, copyright and orientation
+	MetadataExif
+	// MetadataGPS Exif GPS location tags
+	MetadataGPS
+	// MetadataCopyright Exif Copyright and Artist tags
+	MetadataCopyright
+	// MetadataOrientation Exif orientation
+	MetadataOrientation
+	// MetadataXMP XMP packet
+	MetadataXMP
+	// MetadataIPTC IPTC data
+	MetadataIPTC
+	// MetadataOther other metadata such as PNG text chunks and comments
+	MetadataOther
+
+	// MetadataNone strips all metadata
+	MetadataNone MetadataPolicy = 0
+	// MetadataAll keeps all metadata
+	MetadataAll = MetadataICC | MetadataExifAll | MetadataXMP | MetadataIPTC | MetadataOther
+	// MetadataExifAll all Exif tags
+	MetadataExifAll = MetadataExif | MetadataGPS | MetadataCopyright | MetadataOrientation
+)
+
+var metadataCategories = map[string]MetadataPolicy{
+	"icc":         MetadataICC,
+	"exif":        MetadataExifAll,
+	"gps":         MetadataGPS,
+	"copyright":   MetadataCopyright,
+	"orientation": MetadataOrientation,
+	"xmp":         MetadataXMP,
+	"iptc":        MetadataIPTC,
+	"other":       MetadataOther,
+	"all":         MetadataAll,
+}
+
+// ParseMetadataPolicy parses comma separated metadata categories
+// icc, exif, gps, copyright, orientation, xmp, iptc, other and all.
+// Unknown categories are ignored
+func ParseMetadataPolicy(categories ...string) (policy MetadataPolicy) {
+	for _, raw := range categories {
+		for _, name := range strings.Split(raw, ",") {
+			policy |= metadataCategories[strings.ToLower(strings.TrimSpace(name))]
+		}
+	}
+	return
+}
+
+// exifCategory returns metadata category of libvips Exif field
+func exifCategory(field string) MetadataPolicy {
+	switch {
+	case strings.HasPrefix(field, "exif-ifd3-"):
+		return MetadataGPS
+	case field == "exif-ifd0-Copyright", field == "exif-ifd0-Artist":
+		return MetadataCopyright
+	case field == "exif-ifd0-Orientation":
+		return MetadataOrientation
+	}
+	return MetadataExif
+}
+
+// keepExif returns libvips Exif fields kept by the policy
+func keepExif(fields map[string]string, policy MetadataPolicy) map[string]string {
+	if policy&MetadataExifAll == MetadataExifAll {
+		return fields
+	}
+	kept := make(map[string]string, len(fields))
+	for field, value := range fields {
+		if policy&exifCategory(field) != 0 {
+			kept[field] = value
+		}
+	}
+	return kept
+}
+
+// xmpLocation reports if the XMP property carries location,
+// of Exif GPS, Photoshop and IPTC location properties
+func xmpLocation(name xml.Name) bool {
+	switch name.Space {
+	case "http://ns.adobe.com/exif/1.0/":
+		return strings.HasPrefix(name.Local, "GPS")
+	case "http://ns.adobe.com/photoshop/1.0/":
+		return name.Local == "City" || name.Local == "State" || name.Local == "Country"
+	case "http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/":
+		return name.Local == "Location" || name.Local == "CountryCode"
+	case "http://iptc.org/std/Iptc4xmpExt/2008-02-29/":
+		return name.Local == "LocationCreated" || name.Local == "LocationShown"
+	}
+	return false
+}
+
+var xmpAttrRegex = regexp.MustCompile(`\s+[^\s=/>]+\s*=\s*("[^"]*"|'[^']*')`)
+
+// removeXMPLocation returns the XMP packet without location properties,
+// of both property elements and attributes. Returns false if the packet cannot be parsed
+func removeXMPLocation(data []byte) ([]byte, bool) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var out []byte
+	var last int64
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if xmpLocation(start.Name) {
+			if err := d.Skip(); err != nil {
+				return nil, false
+			}
+			out = append(out, data[last:offset]...)
+			last = d.InputOffset()
+			continue
+		}
+		// attributes of the start tag in order of the decoded attributes
+		attrs := xmpAttrRegex.FindAllIndex(data[offset:d.InputOffset()], -1)
+		if len(attrs) != len(start.Attr) {
+			return nil, false
+		}
+		for i, attr := range start.Attr {
+			if xmpLocation(attr.Name) {
+				out = append(out, data[last:offset+int64(attrs[i][0])]...)
+				last = offset + int64(attrs[i][1])
+			}
+		}
+	}
+	return append(out, data[last:]...), true
+}
+
+// iptcLocationDatasets IPTC application record datasets of location
+var iptcLocationDatasets = map[byte]bool{
+	26:  true, // ContentLocationCode
+	27:  true, // ContentLocationName
+	90:  true, // City
+	92:  true, // Sublocation
+	95:  true, // ProvinceState
+	100: true, // CountryCode
+	101: true, // Country
+}
+
+// removeIPTCLocation returns IPTC data without location datasets,
+// either raw or wrapped in Photoshop image resource blocks.
+// Returns false if the data cannot be parsed
+func removeIPTCLocation(data []byte) ([]byte, bool) {
+	start, end := 0, len(data)
+	wrapped := len(data) > 0 && data[0] != 0x1c
+	if wrapped {
+		if start, end = iptcIIMRange(data); start < 0 {
+			return data, true
+		}
+	}
+	iim := data[start:end]
+	kept := make([]byte, 0, len(iim))
+	i := 0
+	for i+5 <= len(iim) && iim[i] == 0x1c {
+		size := int(binary.BigEndian.Uint16(iim[i+3:]))
+		if size&0x8000 != 0 || i+5+size > len(iim) {
+			// extended dataset not supported
+			return nil, false
+		}
+		if iim[i+1] != 2 || !iptcLocationDatasets[iim[i+2]] {
+			kept = append(kept, iim[i:i+5+size]...)
+		}
+		i += 5 + size
+	}
+	kept = append(kept, iim[i:]...)
+	if !wrapped {
+		return kept, true
+	}
+	// rewrite the resource size, with data padded to even length
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:start-4]...)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(kept)))
+	out = append(out, kept...)
+	if len(kept)%2 != 0 {
+		out = append(out, 0)
+	}
+	if next := end + (end-start)%2; next < len(data) {
+		out = append(out, data[next:]...)
+	}
+	return out, true
+}
+
+// applyMetadataPolicy removes metadata of the image not kept by the policy,
+// and returns the keep option of the export. The image must not be shared e.g. a copy
+func applyMetadataPolicy(img *vips.Image, policy MetadataPolicy) (vips.Keep, error) {
+	if policy&MetadataGPS == 0 && policy&MetadataXMP != 0 && img.HasField("xmp-data") {
+		if data, err := img.GetBlob("xmp-data"); err != nil {
+			return vips.KeepNone, err
+		} else if data, ok := removeXMPLocation(data); !ok {
+			// location cannot be removed from malformed packet
+			policy &^= MetadataXMP
+		} else if err = setBlob(img, "xmp-data", data); err != nil {
+			return vips.KeepNone, err
+		}
+	}
+	if policy&MetadataGPS == 0 && policy&MetadataIPTC != 0 && img.HasField("iptc-data") {
+		if data, err := img.GetBlob("iptc-data"); err != nil {
+			return vips.KeepNone, err
+		} else if data, ok := removeIPTCLocation(data); !ok {
+			policy &^= MetadataIPTC
+		} else if err = setBlob(img, "iptc-data", data); err != nil {
+			return vips.KeepNone, err
+		}
+	}
+	exif := policy & MetadataExifAll
+	if exif != MetadataNone && exif != MetadataExifAll {
+		// Exif tags of removed fields are removed from exif-data on export
+		var fields []string
+		for field := range img.Exif() {
+			if strings.HasPrefix(field, "exif-ifd") && policy&exifCategory(field) == 0 {
+				fields = append(fields, field)
+			}
+		}
+		if err := removeFields(img, fields...); err != nil {
+			return vips.KeepNone, err
+		}
+	}
+	if policy&MetadataOrientation == 0 && img.HasField("orientation") {
+		if err := img.RemoveOrientation(); err != nil {
+			return vips.KeepNone, err
+		}
+	}
+	keep := vips.KeepNone
+	if exif != MetadataNone {
+		keep |= vips.KeepExif
+	}
+	if policy&MetadataICC != 0 {
+		keep |= vips.KeepIcc
+	}
+	if policy&MetadataXMP != 0 {
+		keep |= vips.KeepXmp
+	}
+	if policy&MetadataIPTC != 0 {
+		keep |= vips.KeepIptc
+	}
+	if policy&MetadataOther != 0 {
+		keep |= vips.KeepOther
+	}
+	if keep == vips.KeepNone {
+		// keep none is not distinguished from unset by export options,
+		// remove metadata from the image instead
+		if err := img.RemoveExif(); err != nil {
+			return keep, err
+		}
+		if img.HasICCProfile() {
+			if err := img.RemoveICCProfile(); err != nil {
+				return keep, err
+			}
+		}
+	}
+	return keep, nil
+}
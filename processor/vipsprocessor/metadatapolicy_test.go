@@ -0,0 +1,117 @@
+package vipsprocessor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMetadataPolicy(t *testing.T) {
+	assert.Equal(t, MetadataNone, ParseMetadataPolicy())
+	assert.Equal(t, MetadataNone, ParseMetadataPolicy("", "foo"))
+	assert.Equal(t, MetadataICC|MetadataCopyright|MetadataOrientation, ParseMetadataPolicy("icc, Copyright,orientation"))
+	assert.Equal(t, MetadataExifAll|MetadataXMP, ParseMetadataPolicy("exif", "xmp"))
+	assert.Equal(t, MetadataAll, ParseMetadataPolicy("all"))
+	assert.Equal(t, MetadataAll&^MetadataGPS&^MetadataXMP, MetadataAll&^ParseMetadataPolicy("gps,xmp"))
+
+	assert.Equal(t, MetadataGPS, exifCategory("exif-ifd3-GPSLatitude"))
+	assert.Equal(t, MetadataCopyright, exifCategory("exif-ifd0-Copyright"))
+	assert.Equal(t, MetadataCopyright, exifCategory("exif-ifd0-Artist"))
+	assert.Equal(t, MetadataOrientation, exifCategory("exif-ifd0-Orientation"))
+	assert.Equal(t, MetadataExif, exifCategory("exif-ifd0-Make"))
+	assert.Equal(t, MetadataExif, exifCategory("exif-ifd2-ExposureTime"))
+}
+
+func TestKeepExif(t *testing.T) {
+	fields := map[string]string{
+		"exif-ifd0-Make":         "Canon",
+		"exif-ifd0-Artist":       "Gopher",
+		"exif-ifd0-Orientation":  "1",
+		"exif-ifd3-GPSLatitude":  "22/1 16/1 0/1",
+		"exif-ifd2-ExposureTime": "1/160",
+	}
+	assert.Equal(t, fields, keepExif(fields, MetadataAll))
+	assert.Empty(t, keepExif(fields, MetadataNone))
+	assert.Empty(t, keepExif(fields, MetadataICC|MetadataXMP))
+	assert.Equal(t, map[string]string{
+		"exif-ifd0-Make":         "Canon",
+		"exif-ifd0-Artist":       "Gopher",
+		"exif-ifd0-Orientation":  "1",
+		"exif-ifd2-ExposureTime": "1/160",
+	}, keepExif(fields, MetadataAll&^MetadataGPS))
+	assert.Equal(t, map[string]string{
+		"exif-ifd0-Artist": "Gopher",
+	}, keepExif(fields, MetadataCopyright))
+}
+
+func TestRemoveXMPLocation(t *testing.T) {
+	xmp := `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:exif="http://ns.adobe.com/exif/1.0/"
+ xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/" xmlns:Iptc4xmpCore="http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/"
+ exif:GPSLatitude="22,16.0N" exif:GPSDestLatitude='22,16.0N' photoshop:City="Hong Kong" exif:ExposureTime="1/160">
+<dc:creator><rdf:Seq><rdf:li>Gopher</rdf:li></rdf:Seq></dc:creator>
+<Iptc4xmpCore:Location>Central</Iptc4xmpCore:Location>
+<photoshop:Country/>
+<exif:GPSLongitude>114,10.0E</exif:GPSLongitude>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+	data, ok := removeXMPLocation([]byte(xmp))
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{
+		"dc:creator":        []any{"Gopher"},
+		"exif:ExposureTime": "1/160",
+	}, parseXMP(data))
+	assert.Contains(t, string(data), `<?xpacket end="w"?>`)
+	for _, name := range []string{"GPS", "City", "Country", "Location"} {
+		assert.NotContains(t, string(data), name)
+	}
+
+	data, ok = removeXMPLocation([]byte(`<rdf:Description dc:creator="Gopher"/>`))
+	assert.True(t, ok)
+	assert.Equal(t, `<rdf:Description dc:creator="Gopher"/>`, string(data))
+
+	_, ok = removeXMPLocation([]byte(`<rdf:Description exif:GPSLatitude="22,16.0N">`))
+	assert.False(t, ok)
+}
+
+func TestRemoveIPTCLocation(t *testing.T) {
+	dataset := func(id byte, value string) []byte {
+		return append([]byte{0x1c, 2, id, 0, byte(len(value))}, value...)
+	}
+	iim := bytes.Join([][]byte{
+		dataset(80, "Gopher"),
+		dataset(90, "Hong Kong"),
+		dataset(116, "imagor"),
+		dataset(101, "China"),
+	}, nil)
+	data, ok := removeIPTCLocation(iim)
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"Byline": []string{"Gopher"}, "CopyrightNotice": "imagor"}, parseIPTC(data))
+
+	// wrapped in Photoshop image resource blocks
+	resource := func(id uint16, data []byte) []byte {
+		b := append([]byte("8BIM"), byte(id>>8), byte(id), 0, 0)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+		b = append(b, data...)
+		if len(data)%2 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	irb := append([]byte("Photoshop 3.0\x00"), resource(0x0404, iim)...)
+	irb = append(irb, resource(0x040c, []byte("thumbnail"))...)
+	data, ok = removeIPTCLocation(irb)
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"Byline": []string{"Gopher"}, "CopyrightNotice": "imagor"}, parseIPTC(data))
+	assert.True(t, bytes.HasSuffix(data, resource(0x040c, []byte("thumbnail"))))
+
+	_, ok = removeIPTCLocation(dataset(90, "Hong Kong")[:7])
+	assert.False(t, ok)
+}
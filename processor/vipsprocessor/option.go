@@ -2,6 +2,7 @@ package vipsprocessor
 
 import (
 	"strings"
+	"time"
 
 	"github.com/cshum/imagor/metrics/instrumentation"
 	"go.uber.org/zap"
@@ -53,6 +54,50 @@ func WithStripMetadata(enabled bool) Option {
 	}
 }
 
+// WithKeepMetadata with metadata categories kept on export option, by csv e.g. icc,copyright,orientation.
+// Categories not listed are stripped regardless of the keep_metadata filter
+func WithKeepMetadata(categories ...string) Option {
+	return func(v *Processor) {
+		if strings.TrimSpace(strings.Join(categories, "")) != "" {
+			v.MetadataPolicy &= ParseMetadataPolicy(categories...)
+		}
+	}
+}
+
+// WithStripMetadataCategories with metadata categories stripped on export option, by csv e.g. gps,xmp
+func WithStripMetadataCategories(categories ...string) Option {
+	return func(v *Processor) {
+		v.MetadataPolicy &^= ParseMetadataPolicy(categories...)
+	}
+}
+
+// WithQualityTable with format aware quality table option,
+// applies when no quality or quality(auto) is requested
+func WithQualityTable(table QualityTable) Option {
+	return func(v *Processor) {
+		v.QualityTable = append(v.QualityTable, table...)
+	}
+}
+
+// WithMaxSSIMIterations with maximum number of encodes of target_ssim quality search option
+func WithMaxSSIMIterations(n int) Option {
+	return func(v *Processor) {
+		if n >= 0 {
+			v.MaxSSIMIterations = n
+		}
+	}
+}
+
+// WithAutoFormatBudget with time budget of format(auto) encoding option,
+// candidate formats are skipped once exceeded
+func WithAutoFormatBudget(budget time.Duration) Option {
+	return func(v *Processor) {
+		if budget >= 0 {
+			v.AutoFormatBudget = budget
+		}
+	}
+}
+
 // WithAvifSpeed with avif speed option
 func WithAvifSpeed(avifSpeed int) Option {
 	return func(v *Processor) {
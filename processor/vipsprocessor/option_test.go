@@ -4,6 +4,7 @@ import (
 	"context"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/cshum/imagor"
 	"github.com/cshum/vipsgen/vips"
@@ -23,6 +24,9 @@ func TestWithOption(t *testing.T) {
 			WithMaxResolution(1666667),
 			WithMozJPEG(true),
 			WithAvifSpeed(9),
+			WithMaxSSIMIterations(4),
+			WithAutoFormatBudget(time.Second),
+			WithQualityTable(QualityTable{{Format: vips.ImageTypeAvif, Quality: 50}}),
 			WithStripMetadata(true),
 			WithDebug(true),
 			WithMaxAnimationFrames(3),
@@ -44,12 +48,27 @@ func TestWithOption(t *testing.T) {
 		assert.Equal(t, 3, v.MaxAnimationFrames)
 		assert.Equal(t, true, v.MozJPEG)
 		assert.Equal(t, true, v.StripMetadata)
+		assert.Equal(t, MetadataNone, v.MetadataPolicy)
 		assert.Equal(t, true, v.Unlimited)
 		assert.Equal(t, 9, v.AvifSpeed)
+		assert.Equal(t, 4, v.MaxSSIMIterations)
+		assert.Equal(t, time.Second, v.AutoFormatBudget)
+		assert.Equal(t, QualityTable{{Format: vips.ImageTypeAvif, Quality: 50}}, v.QualityTable)
 		assert.Equal(t, []string{"rgb", "fill", "watermark"}, v.DisableFilters)
 		assert.NotNil(t, v.FallbackFunc)
 
 	})
+	t.Run("metadata policy options", func(t *testing.T) {
+		v := NewProcessor()
+		assert.Equal(t, MetadataAll, v.MetadataPolicy)
+		v = NewProcessor(WithKeepMetadata(""), WithStripMetadataCategories(""))
+		assert.Equal(t, MetadataAll, v.MetadataPolicy)
+		v = NewProcessor(
+			WithKeepMetadata("icc,exif", "xmp"),
+			WithStripMetadataCategories("gps, foo"),
+		)
+		assert.Equal(t, MetadataICC|MetadataExif|MetadataCopyright|MetadataOrientation|MetadataXMP, v.MetadataPolicy)
+	})
 	t.Run("edge options", func(t *testing.T) {
 		v := NewProcessor(
 			WithConcurrency(-1),
@@ -0,0 +1,114 @@
+package vipsprocessor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/vipsgen/vips"
+)
+
+const (
+	// pHashSize dimension of the grayscale thumbnail pHash is computed from
+	pHashSize = 32
+	// pHashLowFreq dimension of the low frequency DCT coefficients of pHash
+	pHashLowFreq = 8
+)
+
+// PerceptualHash 64-bit perceptual hashes of the image in hexadecimal
+type PerceptualHash struct {
+	PHash string `json:"phash,omitempty"`
+	DHash string `json:"dhash,omitempty"`
+}
+
+// newPerceptualHash computes pHash if isPHash and dHash if isDHash of the image
+func newPerceptualHash(img *vips.Image, isPHash, isDHash bool) (h *PerceptualHash, err error) {
+	h = &PerceptualHash{}
+	if isPHash {
+		buf, err := newPixelBuffer(img, pixelOptions{Width: pHashSize, Height: pHashSize, Size: vips.SizeForce, Gray: true})
+		if err != nil {
+			return nil, err
+		}
+		h.PHash = fmt.Sprintf("%016x", pHash(buf.Pix))
+	}
+	if isDHash {
+		buf, err := newPixelBuffer(img, pixelOptions{Width: 9, Height: 8, Size: vips.SizeForce, Gray: true})
+		if err != nil {
+			return nil, err
+		}
+		h.DHash = fmt.Sprintf("%016x", dHash(buf.Pix))
+	}
+	return
+}
+
+// Blob returns the perceptual hash as text, or as JSON if both pHash and dHash
+func (h *PerceptualHash) Blob() *imagor.Blob {
+	if h.PHash != "" && h.DHash != "" {
+		return imagor.NewBlobFromJsonMarshal(h)
+	}
+	blob := imagor.NewBlobFromBytes([]byte(h.PHash + h.DHash))
+	blob.SetContentType("text/plain; charset=utf-8")
+	return blob
+}
+
+// pHash computes DCT based perceptual hash of 32x32 grayscale pixels,
+// bits of the 8x8 low frequency coefficients above their median
+func pHash(pix []byte) uint64 {
+	const n = pHashSize
+	// DCT-II basis
+	var basis [pHashLowFreq][n]float64
+	for u := 0; u < pHashLowFreq; u++ {
+		for x := 0; x < n; x++ {
+			basis[u][x] = math.Cos(math.Pi / n * (float64(x) + 0.5) * float64(u))
+		}
+	}
+	// DCT of rows, then columns of the low frequencies
+	var rows [n][pHashLowFreq]float64
+	for y := 0; y < n; y++ {
+		for u := 0; u < pHashLowFreq; u++ {
+			var sum float64
+			for x := 0; x < n; x++ {
+				sum += float64(pix[y*n+x]) * basis[u][x]
+			}
+			rows[y][u] = sum
+		}
+	}
+	coeffs := make([]float64, 0, pHashLowFreq*pHashLowFreq)
+	for v := 0; v < pHashLowFreq; v++ {
+		for u := 0; u < pHashLowFreq; u++ {
+			var sum float64
+			for y := 0; y < n; y++ {
+				sum += rows[y][u] * basis[v][y]
+			}
+			// rounded off floating point noise of zero coefficients
+			coeffs = append(coeffs, math.Round(sum*1e6)/1e6)
+		}
+	}
+	sorted := slices.Clone(coeffs)
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+	var hash uint64
+	for _, c := range coeffs {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// dHash computes difference hash of 9x8 grayscale pixels,
+// bits of each pixel brighter than its left neighbour
+func dHash(pix []byte) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pix[y*9+x+1] > pix[y*9+x] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
@@ -0,0 +1,34 @@
+package vipsprocessor
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerceptualHash(t *testing.T) {
+	gradient := func(w, h int, fn func(x, y int) int) []byte {
+		pix := make([]byte, 0, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				pix = append(pix, byte(fn(x, y)))
+			}
+		}
+		return pix
+	}
+	assert.Equal(t, uint64(0), dHash(gradient(9, 8, func(x, y int) int { return 128 })))
+	assert.Equal(t, ^uint64(0), dHash(gradient(9, 8, func(x, y int) int { return x * 20 })))
+	assert.Equal(t, uint64(0), dHash(gradient(9, 8, func(x, y int) int { return 200 - x*20 })))
+
+	// constant image has the DC coefficient only
+	assert.Equal(t, uint64(1)<<63, pHash(gradient(32, 32, func(x, y int) int { return 128 })))
+
+	horizontal := pHash(gradient(32, 32, func(x, y int) int { return 255 - x*8 }))
+	vertical := pHash(gradient(32, 32, func(x, y int) int { return 255 - y*8 }))
+	assert.Equal(t, uint64(0xd5)<<56, horizontal)
+	assert.Greater(t, bits.OnesCount64(horizontal^vertical), 6)
+	// brightness and contrast changes are near duplicates
+	brighter := pHash(gradient(32, 32, func(x, y int) int { return 235 - x*6 }))
+	assert.LessOrEqual(t, bits.OnesCount64(horizontal^brighter), 2)
+}
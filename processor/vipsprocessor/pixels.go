@@ -0,0 +1,87 @@
+package vipsprocessor
+
+import (
+	"errors"
+
+	"github.com/cshum/vipsgen/vips"
+)
+
+var errPixels = errors.New("vipsprocessor: unsupported pixels")
+
+// pixelOptions options of extracting pixels from image
+type pixelOptions struct {
+	// Width and Height resize the image if positive, by Size
+	Width  int
+	Height int
+	// Size vips.SizeDown downscales to fit in, vips.SizeForce resizes to exactly Width and Height
+	Size vips.Size
+	// Gray extracts 1 band luminance instead of sRGB
+	Gray bool
+	// Flatten flattens alpha on white, otherwise sRGB with alpha is of 4 bands
+	Flatten bool
+}
+
+// pixelBuffer 8-bit pixels of an image, of Bands interleaved
+type pixelBuffer struct {
+	Pix    []byte
+	Width  int
+	Height int
+	Bands  int
+}
+
+// newPixelBuffer returns 8-bit pixels of the image by the options,
+// 1 band if Gray, otherwise sRGB of 3 bands, or 4 bands with alpha unless Flatten
+func newPixelBuffer(img *vips.Image, opts pixelOptions) (*pixelBuffer, error) {
+	cp, err := img.Copy(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cp.Close()
+	if opts.Width > 0 && opts.Height > 0 {
+		if err = cp.ThumbnailImage(opts.Width, &vips.ThumbnailImageOptions{
+			Height:   opts.Height,
+			Size:     opts.Size,
+			NoRotate: true,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if cp.Interpretation() != vips.InterpretationSrgb {
+		if err = cp.Colourspace(vips.InterpretationSrgb, nil); err != nil {
+			return nil, err
+		}
+	}
+	if cp.HasAlpha() && (opts.Flatten || opts.Gray) {
+		if err = cp.Flatten(&vips.FlattenOptions{Background: []float64{255, 255, 255}}); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Gray {
+		if err = cp.Colourspace(vips.InterpretationBW, nil); err != nil {
+			return nil, err
+		}
+		if cp.Bands() > 1 {
+			if err = cp.ExtractBand(0, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cp.BandFormat() != vips.BandFormatUchar {
+		if err = cp.Cast(vips.BandFormatUchar, nil); err != nil {
+			return nil, err
+		}
+	}
+	pix, err := cp.RawsaveBuffer(nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := &pixelBuffer{Pix: pix, Width: cp.Width(), Height: cp.Height(), Bands: cp.Bands()}
+	if opts.Gray && buf.Bands != 1 || !opts.Gray && buf.Bands != 3 && buf.Bands != 4 ||
+		len(pix) != buf.Width*buf.Height*buf.Bands {
+		return nil, errPixels
+	}
+	if opts.Size == vips.SizeForce && (buf.Width != opts.Width || buf.Height != opts.Height) {
+		return nil, errPixels
+	}
+	return buf, nil
+}
@@ -0,0 +1,284 @@
+package vipsprocessor
+
+import (
+	"encoding/base64"
+	"math"
+	"strings"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/vipsgen/vips"
+)
+
+const (
+	// blurHashSize maximum dimension of the thumbnail BlurHash is computed from
+	blurHashSize = 32
+	// thumbHashSize maximum dimension of the thumbnail ThumbHash is computed from
+	thumbHashSize = 100
+)
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Placeholder image placeholder hashes
+type Placeholder struct {
+	BlurHash  string `json:"blurhash,omitempty"`
+	ThumbHash string `json:"thumbhash,omitempty"`
+}
+
+// newPlaceholder computes placeholder hashes of the image,
+// BlurHash of blurHashX and blurHashY components if positive, ThumbHash if isThumbHash
+func newPlaceholder(img *vips.Image, blurHashX, blurHashY int, isThumbHash bool) (ph *Placeholder, err error) {
+	ph = &Placeholder{}
+	if blurHashX > 0 && blurHashY > 0 {
+		if ph.BlurHash, err = blurHash(img, blurHashX, blurHashY); err != nil {
+			return nil, err
+		}
+	}
+	if isThumbHash {
+		if ph.ThumbHash, err = thumbHash(img); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Blob returns the placeholder hash as text, or as JSON if both BlurHash and ThumbHash
+func (ph *Placeholder) Blob() *imagor.Blob {
+	if ph.BlurHash != "" && ph.ThumbHash != "" {
+		return imagor.NewBlobFromJsonMarshal(ph)
+	}
+	blob := imagor.NewBlobFromBytes([]byte(ph.BlurHash + ph.ThumbHash))
+	blob.SetContentType("text/plain; charset=utf-8")
+	return blob
+}
+
+// blurHash computes BlurHash of the image with x and y components
+func blurHash(img *vips.Image, xComp, yComp int) (string, error) {
+	buf, err := newPixelBuffer(img, pixelOptions{Width: blurHashSize, Height: blurHashSize, Size: vips.SizeDown})
+	if err != nil {
+		return "", err
+	}
+	return encodeBlurHash(buf.Pix, buf.Width, buf.Height, buf.Bands, xComp, yComp), nil
+}
+
+// thumbHash computes base64 encoded ThumbHash of the image
+func thumbHash(img *vips.Image) (string, error) {
+	buf, err := newPixelBuffer(img, pixelOptions{Width: thumbHashSize, Height: thumbHashSize, Size: vips.SizeDown})
+	if err != nil {
+		return "", err
+	}
+	pix, w, h, bands := buf.Pix, buf.Width, buf.Height, buf.Bands
+	rgba := pix
+	if bands != 4 {
+		rgba = make([]byte, w*h*4)
+		for i, j := 0, 0; i < w*h; i, j = i+1, j+bands {
+			copy(rgba[i*4:i*4+3], pix[j:j+3])
+			rgba[i*4+3] = 255
+		}
+	}
+	return base64.StdEncoding.EncodeToString(encodeThumbHash(w, h, rgba)), nil
+}
+
+// encodeBlurHash encodes pixels of 3 or 4 bands into BlurHash
+// https://github.com/woltapp/blurhash/blob/master/Algorithm.md
+func encodeBlurHash(pix []byte, width, height, bands, xComp, yComp int) string {
+	xComp = min(max(xComp, 1), 9)
+	yComp = min(max(yComp, 1), 9)
+	factors := make([][3]float64, 0, xComp*yComp)
+	for j := 0; j < yComp; j++ {
+		for i := 0; i < xComp; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var r, g, b float64
+			for y := 0; y < height; y++ {
+				fy := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := normalisation * fy * math.Cos(math.Pi*float64(i)*float64(x)/float64(width))
+					idx := (y*width + x) * bands
+					r += basis * sRGBToLinear(pix[idx])
+					g += basis * sRGBToLinear(pix[idx+1])
+					b += basis * sRGBToLinear(pix[idx+2])
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{r * scale, g * scale, b * scale})
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(encode83((xComp-1)+(yComp-1)*9, 1))
+	maximumValue := 1.0
+	if len(factors) > 1 {
+		var actualMax float64
+		for _, f := range factors[1:] {
+			actualMax = max(actualMax, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantisedMax := int(max(0, min(82, math.Floor(actualMax*166-0.5))))
+		maximumValue = float64(quantisedMax+1) / 166
+		sb.WriteString(encode83(quantisedMax, 1))
+	} else {
+		sb.WriteString(encode83(0, 1))
+	}
+	dc := factors[0]
+	sb.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(max(0, min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		sb.WriteString(encode83(quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2))
+	}
+	return sb.String()
+}
+
+func encode83(value, length int) string {
+	buf := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		buf[i-1] = base83Chars[digit]
+	}
+	return string(buf)
+}
+
+func sRGBToLinear(value byte) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := max(0, min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// encodeThumbHash encodes RGBA pixels of at most 100x100 into ThumbHash
+// https://github.com/evanw/thumbhash
+func encodeThumbHash(w, h int, rgba []byte) []byte {
+	round := func(v float64) int {
+		return int(math.Floor(v + 0.5))
+	}
+	// average color
+	var avgR, avgG, avgB, avgA float64
+	for i, j := 0, 0; i < w*h; i, j = i+1, j+4 {
+		alpha := float64(rgba[j+3]) / 255
+		avgR += alpha / 255 * float64(rgba[j])
+		avgG += alpha / 255 * float64(rgba[j+1])
+		avgB += alpha / 255 * float64(rgba[j+2])
+		avgA += alpha
+	}
+	if avgA > 0 {
+		avgR /= avgA
+		avgG /= avgA
+		avgB /= avgA
+	}
+	hasAlpha := avgA < float64(w*h)
+	lLimit := 7.0
+	if hasAlpha {
+		lLimit = 5 // fewer luminance bits if there's alpha
+	}
+	maxWH := float64(max(w, h))
+	lx := max(1, round(lLimit*float64(w)/maxWH))
+	ly := max(1, round(lLimit*float64(h)/maxWH))
+
+	// RGBA to LPQA, composite atop the average color
+	l := make([]float64, w*h)
+	p := make([]float64, w*h)
+	q := make([]float64, w*h)
+	a := make([]float64, w*h)
+	for i, j := 0, 0; i < w*h; i, j = i+1, j+4 {
+		alpha := float64(rgba[j+3]) / 255
+		r := avgR*(1-alpha) + alpha/255*float64(rgba[j])
+		g := avgG*(1-alpha) + alpha/255*float64(rgba[j+1])
+		b := avgB*(1-alpha) + alpha/255*float64(rgba[j+2])
+		l[i] = (r + g + b) / 3
+		p[i] = (r+g)/2 - b
+		q[i] = r - g
+		a[i] = alpha
+	}
+
+	// DCT into DC and normalized AC terms
+	encodeChannel := func(channel []float64, nx, ny int) (dc float64, ac []float64, scale float64) {
+		fx := make([]float64, w)
+		for cy := 0; cy < ny; cy++ {
+			for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+				var f float64
+				for x := 0; x < w; x++ {
+					fx[x] = math.Cos(math.Pi / float64(w) * float64(cx) * (float64(x) + 0.5))
+				}
+				for y := 0; y < h; y++ {
+					fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+					for x := 0; x < w; x++ {
+						f += channel[x+y*w] * fx[x] * fy
+					}
+				}
+				f /= float64(w * h)
+				if cx > 0 || cy > 0 {
+					ac = append(ac, f)
+					scale = max(scale, math.Abs(f))
+				} else {
+					dc = f
+				}
+			}
+		}
+		if scale > 0 {
+			for i := range ac {
+				ac[i] = 0.5 + 0.5/scale*ac[i]
+			}
+		}
+		return
+	}
+	lDC, lAC, lScale := encodeChannel(l, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := encodeChannel(p, 3, 3)
+	qDC, qAC, qScale := encodeChannel(q, 3, 3)
+	var aDC, aScale float64
+	var aAC []float64
+	if hasAlpha {
+		aDC, aAC, aScale = encodeChannel(a, 5, 5)
+	}
+
+	// constants
+	isLandscape := w > h
+	header24 := round(63*lDC) | round(31.5+31.5*pDC)<<6 | round(31.5+31.5*qDC)<<12 | round(31*lScale)<<18
+	if hasAlpha {
+		header24 |= 1 << 23
+	}
+	header16 := round(63*pScale)<<3 | round(63*qScale)<<9
+	if isLandscape {
+		header16 |= ly | 1<<15
+	} else {
+		header16 |= lx
+	}
+	hash := []byte{
+		byte(header24 & 255), byte(header24 >> 8 & 255), byte(header24 >> 16),
+		byte(header16 & 255), byte(header16 >> 8),
+	}
+	acStart := 5
+	acs := [][]float64{lAC, pAC, qAC}
+	if hasAlpha {
+		hash = append(hash, byte(round(15*aDC)|round(15*aScale)<<4))
+		acStart = 6
+		acs = append(acs, aAC)
+	}
+
+	// varying factors
+	var acIndex int
+	for _, ac := range acs {
+		for _, f := range ac {
+			idx := acStart + acIndex>>1
+			for len(hash) <= idx {
+				hash = append(hash, 0)
+			}
+			hash[idx] |= byte(round(15*f) << ((acIndex & 1) << 2))
+			acIndex++
+		}
+	}
+	return hash
+}
@@ -0,0 +1,68 @@
+package vipsprocessor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBlurHash(t *testing.T) {
+	solid := func(w, h, bands int, c ...byte) []byte {
+		pix := make([]byte, 0, w*h*bands)
+		for i := 0; i < w*h; i++ {
+			pix = append(pix, c[:bands]...)
+		}
+		return pix
+	}
+	assert.Equal(t, "L00000"+strings.Repeat("fQ", 11), encodeBlurHash(solid(8, 6, 3, 0, 0, 0), 8, 6, 3, 4, 3))
+	assert.Equal(t, "00TSUA", encodeBlurHash(solid(8, 6, 4, 255, 255, 255, 255), 8, 6, 4, 1, 1))
+
+	gradient := make([]byte, 0, 32*32*3)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			gradient = append(gradient, byte(x*8), byte(y*8), 128)
+		}
+	}
+	hash := encodeBlurHash(gradient, 32, 32, 3, 9, 9)
+	assert.Len(t, hash, 4+2*9*9)
+	assert.Equal(t, "|", hash[:1])
+	assert.NotEqual(t, "fQ", hash[6:8])
+}
+
+func TestEncodeThumbHash(t *testing.T) {
+	// average color of ThumbHash header
+	averageRGBA := func(hash []byte) (r, g, b, a float64) {
+		header := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+		l := float64(header&63) / 63
+		p := float64(header>>6&63)/31.5 - 1
+		q := float64(header>>12&63)/31.5 - 1
+		a = 1
+		if header>>23 != 0 {
+			a = float64(hash[5]&15) / 15
+		}
+		b = l - 2.0/3*p
+		r = (3*l - b + q) / 2
+		g = r - q
+		return
+	}
+	rgba := make([]byte, 0, 40*20*4)
+	for i := 0; i < 40*20; i++ {
+		rgba = append(rgba, 255, 0, 0, 255)
+	}
+	hash := encodeThumbHash(40, 20, rgba)
+	// 7x4 luminance, 3x3 p and q components
+	assert.Len(t, hash, 5+(18+5+5)/2)
+	r, g, b, a := averageRGBA(hash)
+	assert.InDelta(t, 1, r, 0.05)
+	assert.InDelta(t, 0, g, 0.05)
+	assert.InDelta(t, 0, b, 0.05)
+	assert.Equal(t, 1.0, a)
+
+	for i := 3; i < len(rgba); i += 8 {
+		rgba[i] = 0
+	}
+	hash = encodeThumbHash(40, 20, rgba)
+	_, _, _, a = averageRGBA(hash)
+	assert.InDelta(t, 0.5, a, 0.1)
+}
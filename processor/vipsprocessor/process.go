@@ -3,6 +3,7 @@ package vipsprocessor
 import (
 	"context"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +30,16 @@ var imageTypeMap = map[string]vips.ImageType{
 	"jxl":  vips.ImageTypeJxl,
 }
 
+// output mode filters responding data of the image in place of export
+const (
+	outputColors = 1 << iota
+	outputPlaceholder
+	outputPerceptualHash
+)
+
+// outputThumbnailSize maximum dimension of the shrink-on-load image that output modes are computed from
+const outputThumbnailSize = 256
+
 // IsAnimationSupported indicates if image type supports animation
 func IsAnimationSupported(imageType vips.ImageType) bool {
 	return imageType == vips.ImageTypeGif || imageType == vips.ImageTypeWebp
@@ -53,15 +64,18 @@ func (v *Processor) Process(
 		stretch               = p.Stretch
 		thumbnail             = false
 		stripExif             bool
-		stripMetadata         = v.StripMetadata
+		extendedMeta          bool
+		metadataPolicy        = v.MetadataPolicy
 		orient                int
 		img                   *vips.Image
 		format                = vips.ImageTypeUnknown
+		autoFormats           []vips.ImageType
 		maxN                  = v.MaxAnimationFrames
 		maxBytes              int
 		page                  = 1
 		dpi                   = 0
 		focalRects            []focal
+		outputs               int
 		err                   error
 	)
 	if p.Trim {
@@ -94,7 +108,13 @@ func (v *Processor) Process(
 		}
 		switch p.Name {
 		case "format":
-			if imageType, ok := imageTypeMap[p.Args]; ok {
+			if args := strings.Split(p.Args, ","); args[0] == "auto" {
+				// format(auto,...) smallest output of candidate formats
+				autoFormats = parseAutoFormats(args[1:])
+				if !slices.ContainsFunc(autoFormats, IsAnimationSupported) {
+					maxN = 1
+				}
+			} else if imageType, ok := imageTypeMap[p.Args]; ok {
 				format = supportedSaveFormat(imageType)
 				if !IsAnimationSupported(format) {
 					// no frames if export format not support animation
@@ -148,11 +168,39 @@ func (v *Processor) Process(
 			break
 		case "strip_exif":
 			stripExif = true
+		case "extended_meta":
+			extendedMeta = true
+			break
 		case "strip_metadata":
-			stripMetadata = true
+			if p.Args == "" {
+				metadataPolicy = MetadataNone
+			} else {
+				metadataPolicy &^= ParseMetadataPolicy(p.Args)
+			}
+			break
+		case "keep_metadata":
+			metadataPolicy &= ParseMetadataPolicy(p.Args)
+			break
+		case "palette_json":
+			outputs |= outputColors
+			break
+		case "blurhash", "thumbhash":
+			outputs |= outputPlaceholder
+			break
+		case "phash", "dhash":
+			outputs |= outputPerceptualHash
 			break
 		}
 	}
+	if outputs != 0 && !p.Meta {
+		if outputs&(outputs-1) != 0 {
+			// output modes are exclusive of each other, combined only by meta
+			return nil, imagor.ErrInvalid
+		}
+		// output computed from downscaled image, apply shrink-on-load
+		maxWidth = min(maxWidth, outputThumbnailSize)
+		maxHeight = min(maxHeight, outputThumbnailSize)
+	}
 
 	if !thumbnailNotSupported &&
 		p.CropBottom == 0.0 && p.CropTop == 0.0 && p.CropLeft == 0.0 && p.CropRight == 0.0 {
@@ -346,6 +394,13 @@ func (v *Processor) Process(
 
 	var (
 		quality     int
+		targetSSIM  float64
+		blurHashX   int
+		blurHashY   int
+		isThumbHash bool
+		paletteN    int
+		isPHash     bool
+		isDHash     bool
 		bitdepth    int
 		compression int
 		palette     bool
@@ -374,6 +429,37 @@ func (v *Processor) Process(
 		case "quality":
 			quality, _ = strconv.Atoi(p.Args)
 			break
+		case "blurhash":
+			blurHashX, blurHashY = 4, 3
+			if args := strings.Split(p.Args, ","); len(args) == 2 {
+				if x, _ := strconv.Atoi(args[0]); x >= 1 && x <= 9 {
+					blurHashX = x
+				}
+				if y, _ := strconv.Atoi(args[1]); y >= 1 && y <= 9 {
+					blurHashY = y
+				}
+			}
+			break
+		case "thumbhash":
+			isThumbHash = true
+			break
+		case "phash":
+			isPHash = true
+			break
+		case "dhash":
+			isDHash = true
+			break
+		case "palette_json":
+			paletteN = 5
+			if n, _ := strconv.Atoi(p.Args); n >= 1 && n <= maxPaletteColors {
+				paletteN = n
+			}
+			break
+		case "target_ssim":
+			if f, _ := strconv.ParseFloat(p.Args, 64); f > 0 && f <= 1 {
+				targetSSIM = f
+			}
+			break
 		case "autojpg":
 			format = vips.ImageTypeJpeg
 			break
@@ -422,16 +508,84 @@ func (v *Processor) Process(
 	if err := v.process(ctx, img, p, load, thumbnail, stretch, upscale, focalRects); err != nil {
 		return nil, WrapErr(err)
 	}
+	var placeholder *Placeholder
+	if blurHashX > 0 || isThumbHash {
+		if placeholder, err = newPlaceholder(img, blurHashX, blurHashY, isThumbHash); err != nil {
+			return nil, WrapErr(err)
+		}
+	}
+	var colors *Colors
+	if paletteN > 0 {
+		if colors, err = newColors(img, paletteN); err != nil {
+			return nil, WrapErr(err)
+		}
+	}
+	var perceptualHash *PerceptualHash
+	if isPHash || isDHash {
+		if perceptualHash, err = newPerceptualHash(img, isPHash, isDHash); err != nil {
+			return nil, WrapErr(err)
+		}
+	}
 	if p.Meta {
 		// metadata without export
-		return imagor.NewBlobFromJsonMarshal(metadata(img, format, stripExif)), nil
+		policy := metadataPolicy
+		if stripExif {
+			policy &^= MetadataExifAll
+		}
+		meta := metadata(img, format, policy)
+		if placeholder != nil {
+			meta.BlurHash = placeholder.BlurHash
+			meta.ThumbHash = placeholder.ThumbHash
+		}
+		if perceptualHash != nil {
+			meta.PHash = perceptualHash.PHash
+			meta.DHash = perceptualHash.DHash
+		}
+		meta.Colors = colors
+		if extendedMeta {
+			meta.ExtendedMetadata = extendedMetadata(img, blob, format, policy)
+		}
+		return imagor.NewBlobFromJsonMarshal(meta), nil
+	}
+	if colors != nil {
+		// palette json without export
+		return imagor.NewBlobFromJsonMarshal(colors), nil
+	}
+	if placeholder != nil {
+		// placeholder hash without export
+		return placeholder.Blob(), nil
+	}
+	if perceptualHash != nil {
+		// perceptual hash without export
+		return perceptualHash.Blob(), nil
 	}
 	format = supportedSaveFormat(format) // convert to supported export format
-	for {
-		buf, err := v.export(img, format, compression, quality, palette, bitdepth, stripMetadata)
-		if err != nil {
+	var buf []byte
+	if len(autoFormats) > 0 {
+		if buf, format, quality, err = v.exportAuto(ctx, img, autoFormats, quality, func(f vips.ImageType, q int) ([]byte, error) {
+			return v.export(img, f, compression, q, palette, bitdepth, metadataPolicy)
+		}); err != nil {
 			return nil, WrapErr(err)
 		}
+	} else {
+		if quality == 0 && len(v.QualityTable) > 0 {
+			// no quality or quality(auto) requested
+			quality = v.QualityTable.Quality(format, img.Width(), img.PageHeight())
+		}
+		if targetSSIM > 0 && v.MaxSSIMIterations > 0 && isLossyFormat(format) && img.Height() == img.PageHeight() {
+			if buf, quality, err = v.searchQuality(ctx, img, targetSSIM, func(q int) ([]byte, error) {
+				return v.export(img, format, compression, q, palette, bitdepth, metadataPolicy)
+			}); err != nil {
+				return nil, WrapErr(err)
+			}
+		}
+	}
+	for {
+		if buf == nil {
+			if buf, err = v.export(img, format, compression, quality, palette, bitdepth, metadataPolicy); err != nil {
+				return nil, WrapErr(err)
+			}
+		}
 		if maxBytes > 0 && (quality > 10 || quality == 0) && format != vips.ImageTypePng {
 			ln := len(buf)
 			if v.Debug {
@@ -456,6 +610,7 @@ func (v *Processor) Process(
 				if err := ctx.Err(); err != nil {
 					return nil, WrapErr(err)
 				}
+				buf = nil
 				continue
 			}
 		}
@@ -655,9 +810,16 @@ type Metadata struct {
 	Pages       int               `json:"pages"`
 	Bands       int               `json:"bands"`
 	Exif        map[string]string `json:"exif"`
+	BlurHash    string            `json:"blurhash,omitempty"`
+	ThumbHash   string            `json:"thumbhash,omitempty"`
+	PHash       string            `json:"phash,omitempty"`
+	DHash       string            `json:"dhash,omitempty"`
+	Colors      *Colors           `json:"colors,omitempty"`
+
+	*ExtendedMetadata
 }
 
-func metadata(img *vips.Image, format vips.ImageType, stripExif bool) *Metadata {
+func metadata(img *vips.Image, format vips.ImageType, policy MetadataPolicy) *Metadata {
 	pages := 1
 	if IsAnimationSupported(format) {
 		pages = img.Height() / img.PageHeight()
@@ -665,10 +827,7 @@ func metadata(img *vips.Image, format vips.ImageType, stripExif bool) *Metadata
 	if format == vips.ImageTypePdf {
 		pages = img.Pages()
 	}
-	exif := map[string]string{}
-	if !stripExif {
-		exif = extractExif(img.Exif())
-	}
+	exif := extractExif(keepExif(img.Exif(), policy))
 	mimeType, _ := format.MimeType()
 	return &Metadata{
 		Format:      string(format),
@@ -691,12 +850,25 @@ func supportedSaveFormat(format vips.ImageType) vips.ImageType {
 }
 
 func (v *Processor) export(
-	image *vips.Image, format vips.ImageType, compression int, quality int, palette bool, bitdepth int, stripMetadata bool,
+	image *vips.Image, format vips.ImageType, compression int, quality int, palette bool, bitdepth int, metadataPolicy MetadataPolicy,
 ) ([]byte, error) {
 	// check resolution before export
 	if _, err := v.CheckResolution(image, nil); err != nil {
 		return nil, err
 	}
+	keep := vips.KeepAll
+	if metadataPolicy != MetadataAll {
+		// metadata removed from a copy, not to modify the image shared by cached operations
+		copied, err := image.Copy(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer copied.Close()
+		image = copied
+		if keep, err = applyMetadataPolicy(image, metadataPolicy); err != nil {
+			return nil, err
+		}
+	}
 	switch format {
 	case vips.ImageTypePng:
 		opts := &vips.PngsaveBufferOptions{
@@ -705,38 +877,38 @@ func (v *Processor) export(
 			Bitdepth:    bitdepth,
 			Compression: compression,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.PngsaveBuffer(opts)
 	case vips.ImageTypeWebp:
 		opts := &vips.WebpsaveBufferOptions{
 			Q: quality,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.WebpsaveBuffer(opts)
 	case vips.ImageTypeJxl:
 		opts := &vips.JxlsaveBufferOptions{
 			Q: quality,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.JxlsaveBuffer(opts)
 	case vips.ImageTypeTiff:
 		opts := &vips.TiffsaveBufferOptions{
 			Q: quality,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.TiffsaveBuffer(opts)
 	case vips.ImageTypeGif:
 		opts := &vips.GifsaveBufferOptions{}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.GifsaveBuffer(opts)
 	case vips.ImageTypeAvif:
@@ -744,8 +916,8 @@ func (v *Processor) export(
 			Q:           quality,
 			Compression: vips.HeifCompressionAv1,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		opts.Effort = 9 - v.AvifSpeed
 		return image.HeifsaveBuffer(opts)
@@ -753,16 +925,16 @@ func (v *Processor) export(
 		opts := &vips.HeifsaveBufferOptions{
 			Q: quality,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.HeifsaveBuffer(opts)
 	case vips.ImageTypeJp2k:
 		opts := &vips.Jp2ksaveBufferOptions{
 			Q: quality,
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.Jp2ksaveBuffer(opts)
 	default:
@@ -779,8 +951,8 @@ func (v *Processor) export(
 		if quality > 0 {
 			opts.Q = quality
 		}
-		if stripMetadata {
-			opts.Keep = vips.KeepNone
+		if metadataPolicy != MetadataAll {
+			opts.Keep = keep
 		}
 		return image.JpegsaveBuffer(opts)
 	}
@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cshum/imagor"
 	"github.com/cshum/imagor/metrics/instrumentation"
@@ -77,7 +78,11 @@ type Processor struct {
 	MaxAnimationFrames int
 	MozJPEG            bool
 	StripMetadata      bool
+	MetadataPolicy     MetadataPolicy
 	AvifSpeed          int
+	QualityTable       QualityTable
+	MaxSSIMIterations  int
+	AutoFormatBudget   time.Duration
 	Unlimited          bool
 	Debug              bool
 	PNGBufferThreshold int64 // Threshold for loading PNG files into buffer to avoid streaming issues
@@ -95,6 +100,9 @@ func NewProcessor(options ...Option) *Processor {
 		Concurrency:        1,
 		MaxFilterOps:       -1,
 		MaxAnimationFrames: -1,
+		MaxSSIMIterations:  6,
+		AutoFormatBudget:   time.Second * 2,
+		MetadataPolicy:     MetadataAll,
 		PNGBufferThreshold: 1024 * 1024, // 1MB default threshold for large PNGs
 		Logger:             zap.NewNop(),
 		disableFilters:     map[string]bool{},
@@ -123,6 +131,9 @@ func NewProcessor(options ...Option) *Processor {
 	for _, option := range options {
 		option(v)
 	}
+	if v.StripMetadata {
+		v.MetadataPolicy = MetadataNone
+	}
 	if v.DisableBlur {
 		v.DisableFilters = append(v.DisableFilters, "blur", "sharpen")
 	}
@@ -2,6 +2,7 @@ package vipsprocessor
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,6 +22,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 var testDataDir string
@@ -113,6 +116,20 @@ func TestProcessor(t *testing.T) {
 			{name: "export jxl", path: "filters:format(jxl):quality(70)/gopher-front.png", checkTypeOnly: true},
 			{name: "export avif", path: "filters:format(avif):quality(70)/gopher-front.png", checkTypeOnly: true},
 			{name: "export heif", path: "filters:format(heif):quality(70)/gopher-front.png", checkTypeOnly: true},
+			{name: "target_ssim jpeg", path: "fit-in/200x200/filters:target_ssim(0.98):format(jpeg):fill(white)/gopher.png", checkTypeOnly: true},
+			{name: "target_ssim webp", path: "fit-in/200x200/filters:target_ssim(0.95):format(webp)/gopher-front.png", checkTypeOnly: true},
+			{name: "format auto", path: "fit-in/100x100/filters:format(auto)/demo1.jpg", checkTypeOnly: true},
+			{name: "format auto alpha", path: "fit-in/100x100/filters:format(auto,webp,jpeg)/gopher-front.png", checkTypeOnly: true},
+			{name: "format auto animated", path: "fit-in/100x100/filters:format(auto,avif,webp,jpeg)/dancing-banana.gif", checkTypeOnly: true},
+			{name: "blurhash", path: "fit-in/100x100/filters:blurhash(4,3)/demo1.jpg"},
+			{name: "blurhash alpha", path: "filters:blurhash(5,5)/gopher-front.png"},
+			{name: "thumbhash", path: "fit-in/100x100/filters:thumbhash()/demo1.jpg"},
+			{name: "thumbhash alpha", path: "filters:thumbhash()/gopher-front.png"},
+			{name: "blurhash thumbhash", path: "fit-in/100x100/filters:blurhash():thumbhash()/demo1.jpg"},
+			{name: "palette_json", path: "fit-in/100x100/filters:palette_json(5)/demo1.jpg"},
+			{name: "palette_json alpha", path: "filters:palette_json(3)/gopher-front.png"},
+			{name: "phash", path: "fit-in/100x100/filters:phash()/demo1.jpg"},
+			{name: "dhash alpha", path: "filters:dhash()/gopher-front.png"},
 		}, WithDebug(true), WithLogger(zap.NewExample()))
 	})
 	t.Run("meta", func(t *testing.T) {
@@ -128,6 +145,12 @@ func TestProcessor(t *testing.T) {
 			{name: "meta format no animate", path: "meta/fit-in/100x100/filters:format(jpg)/dancing-banana.gif"},
 			{name: "meta exif", path: "meta/Canon_40D.jpg"},
 			{name: "meta strip exif", path: "meta/filters:strip_exif()/Canon_40D.jpg"},
+			{name: "meta placeholder", path: "meta/fit-in/100x100/filters:blurhash(4,3):thumbhash()/demo1.jpg"},
+			{name: "meta colors", path: "meta/fit-in/100x100/filters:palette_json()/demo1.jpg"},
+			{name: "meta extended", path: "meta/filters:extended_meta()/Canon_40D.jpg"},
+			{name: "meta extended gif", path: "meta/fit-in/100x100/filters:extended_meta()/dancing-banana.gif"},
+			{name: "meta extended alpha", path: "meta/filters:extended_meta()/gopher-front.png"},
+			{name: "meta phash", path: "meta/filters:phash():dhash()/demo1.jpg"},
 		}, WithDebug(true), WithLogger(zap.NewExample()))
 	})
 	t.Run("vips strip metadata config", func(t *testing.T) {
@@ -150,6 +173,9 @@ func TestProcessor(t *testing.T) {
 			{name: "tiff", path: "fit-in/67x67/filters:strip_metadata()/gopher.tiff"},
 			{name: "gif", path: "fit-in/67x67/filters:strip_metadata()/dancing-banana.gif", arm64Golden: true},
 			{name: "avif", path: "fit-in/67x67/filters:strip_metadata()/gopher-front.avif", checkTypeOnly: true},
+			{name: "strip gps", path: "fit-in/67x67/filters:strip_metadata(gps,xmp)/Canon_40D.jpg"},
+			{name: "keep icc copyright", path: "fit-in/67x67/filters:keep_metadata(icc,copyright,orientation)/Canon_40D.jpg"},
+			{name: "keep icc png", path: "fit-in/67x67/filters:keep_metadata(icc)/gopher-front.png"},
 		}, WithDebug(true), WithLogger(zap.NewExample()))
 	})
 	t.Run("vips operations", func(t *testing.T) {
@@ -460,6 +486,178 @@ func TestProcessor(t *testing.T) {
 			http.MethodGet, "/unsafe/dancing-banana.gif", nil))
 		assert.Equal(t, 422, w.Code)
 	})
+	t.Run("metadata policy", func(t *testing.T) {
+		ctx := context.Background()
+		p := NewProcessor(WithDebug(true))
+		exif := func(filters ...imagorpath.Filter) map[string]string {
+			blob := imagor.NewBlobFromFile(filepath.Join(testDataDir, "Canon_40D.jpg"))
+			out, err := p.Process(ctx, blob, imagorpath.Params{Filters: filters}, nil)
+			require.NoError(t, err)
+			buf, err := out.ReadAll()
+			require.NoError(t, err)
+			img, err := vips.NewImageFromBuffer(buf, nil)
+			require.NoError(t, err)
+			defer img.Close()
+			return img.Exif()
+		}
+		fields := exif(imagorpath.Filter{Name: "strip_metadata", Args: "gps"})
+		assert.Contains(t, fields, "exif-ifd0-Make")
+		for field := range fields {
+			assert.NotContains(t, field, "exif-ifd3-")
+		}
+		fields = exif(imagorpath.Filter{Name: "keep_metadata", Args: "icc,copyright"})
+		assert.NotContains(t, fields, "exif-ifd0-Make")
+		assert.NotContains(t, fields, "exif-ifd0-Model")
+		fields = exif(imagorpath.Filter{Name: "strip_metadata"})
+		assert.NotContains(t, fields, "exif-ifd0-Make")
+
+		// XMP kept along with partial Exif, without location if gps stripped
+		src, err := vips.NewImageFromFile(filepath.Join(testDataDir, "Canon_40D.jpg"), nil)
+		require.NoError(t, err)
+		defer src.Close()
+		src.SetString("exif-ifd0-Copyright", "Gopher")
+		require.NoError(t, setBlob(src, "xmp-data", []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/">`+
+			`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`+
+			`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" `+
+			`xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="22,16.0N">`+
+			`<dc:creator><rdf:Seq><rdf:li>Gopher</rdf:li></rdf:Seq></dc:creator>`+
+			`</rdf:Description></rdf:RDF></x:xmpmeta>`)))
+		buf, err := src.JpegsaveBuffer(nil)
+		require.NoError(t, err)
+		out, err := p.Process(ctx, imagor.NewBlobFromBytes(buf), imagorpath.Params{Filters: imagorpath.Filters{
+			{Name: "keep_metadata", Args: "copyright,xmp"},
+		}}, nil)
+		require.NoError(t, err)
+		buf, err = out.ReadAll()
+		require.NoError(t, err)
+		img, err := vips.NewImageFromBuffer(buf, nil)
+		require.NoError(t, err)
+		defer img.Close()
+		fields = img.Exif()
+		assert.Contains(t, fields["exif-ifd0-Copyright"], "Gopher")
+		assert.NotContains(t, fields, "exif-ifd0-Make")
+		require.True(t, img.HasField("xmp-data"))
+		xmp, err := img.GetBlob("xmp-data")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"dc:creator": []any{"Gopher"}}, parseXMP(xmp))
+	})
+	t.Run("diff", func(t *testing.T) {
+		ctx := context.Background()
+		p := NewProcessor(WithDebug(true))
+		src := imagor.NewBlobFromFile(filepath.Join(testDataDir, "demo1.jpg"))
+		res, blob, err := p.Diff(ctx, src, src, 0.1, false)
+		require.NoError(t, err)
+		assert.Nil(t, blob)
+		assert.Equal(t, float64(maxPSNR), res.PSNR)
+		assert.Equal(t, float64(1), res.SSIM)
+		assert.Zero(t, res.MismatchPixels)
+
+		lossy, err := p.Process(ctx, src, imagorpath.Params{
+			Filters: imagorpath.Filters{{Name: "quality", Args: "10"}},
+		}, nil)
+		require.NoError(t, err)
+		res, blob, err = p.Diff(ctx, src, lossy, 0.1, true)
+		require.NoError(t, err)
+		assert.False(t, res.Resized)
+		assert.Less(t, res.PSNR, float64(maxPSNR))
+		assert.Less(t, res.SSIM, float64(1))
+		assert.Equal(t, imagor.BlobTypePNG, blob.BlobType())
+
+		thumb, err := p.Process(ctx, src, imagorpath.Params{Width: 100, Height: 100}, nil)
+		require.NoError(t, err)
+		res, _, err = p.Diff(ctx, thumb, src, 0.1, false)
+		require.NoError(t, err)
+		assert.True(t, res.Resized)
+		assert.Equal(t, 100, res.Width)
+		assert.Equal(t, 100, res.Height)
+	})
+	t.Run("meta metadata policy", func(t *testing.T) {
+		ctx := context.Background()
+		meta := func(p *Processor, filters ...imagorpath.Filter) *Metadata {
+			src := imagor.NewBlobFromFile(filepath.Join(testDataDir, "Canon_40D.jpg"))
+			filters = append(filters, imagorpath.Filter{Name: "extended_meta"})
+			blob, err := p.Process(ctx, src, imagorpath.Params{Meta: true, Filters: filters}, nil)
+			require.NoError(t, err)
+			buf, err := blob.ReadAll()
+			require.NoError(t, err)
+			m := &Metadata{}
+			require.NoError(t, json.Unmarshal(buf, m))
+			return m
+		}
+		m := meta(NewProcessor())
+		assert.NotEmpty(t, m.Exif)
+		assert.NotNil(t, m.ExtendedMetadata)
+
+		m = meta(NewProcessor(), imagorpath.Filter{Name: "strip_metadata", Args: "gps,xmp"})
+		assert.NotEmpty(t, m.Exif)
+		for name := range m.Exif {
+			assert.False(t, strings.HasPrefix(name, "GPS"), name)
+		}
+		assert.Nil(t, m.GPS)
+		assert.Nil(t, m.XMP)
+
+		m = meta(NewProcessor(), imagorpath.Filter{Name: "keep_metadata", Args: "copyright"})
+		for name := range m.Exif {
+			assert.Contains(t, []string{"Copyright", "Artist"}, name)
+		}
+		assert.Nil(t, m.GPS)
+		assert.Nil(t, m.XMP)
+		assert.Nil(t, m.IPTC)
+		assert.Nil(t, m.ICC)
+
+		m = meta(NewProcessor(WithStripMetadata(true)))
+		assert.Empty(t, m.Exif)
+		assert.Nil(t, m.GPS)
+		assert.Nil(t, m.XMP)
+		assert.Nil(t, m.IPTC)
+	})
+	t.Run("output modes", func(t *testing.T) {
+		ctx := context.Background()
+		p := NewProcessor(WithDebug(true))
+		process := func(filters ...imagorpath.Filter) (*imagor.Blob, error) {
+			src := imagor.NewBlobFromFile(filepath.Join(testDataDir, "demo1.jpg"))
+			return p.Process(ctx, src, imagorpath.Params{Filters: filters}, nil)
+		}
+		blob, err := process(imagorpath.Filter{Name: "phash"}, imagorpath.Filter{Name: "dhash"})
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", blob.ContentType())
+		_, err = process(imagorpath.Filter{Name: "phash"}, imagorpath.Filter{Name: "blurhash"})
+		assert.Equal(t, imagor.ErrInvalid, err)
+		_, err = process(imagorpath.Filter{Name: "palette_json"}, imagorpath.Filter{Name: "thumbhash"})
+		assert.Equal(t, imagor.ErrInvalid, err)
+
+		// combined by meta
+		src := imagor.NewBlobFromFile(filepath.Join(testDataDir, "demo1.jpg"))
+		blob, err = p.Process(ctx, src, imagorpath.Params{Meta: true, Filters: imagorpath.Filters{
+			{Name: "phash"}, {Name: "blurhash"}, {Name: "palette_json"},
+		}}, nil)
+		require.NoError(t, err)
+		buf, err := blob.ReadAll()
+		require.NoError(t, err)
+		assert.Contains(t, string(buf), `"phash"`)
+		assert.Contains(t, string(buf), `"blurhash"`)
+		assert.Contains(t, string(buf), `"colors"`)
+	})
+	t.Run("target ssim not reached", func(t *testing.T) {
+		ctx := context.Background()
+		core, logs := observer.New(zapcore.WarnLevel)
+		p := NewProcessor(WithMaxSSIMIterations(3), WithLogger(zap.New(core)))
+		process := func(filters ...imagorpath.Filter) []byte {
+			src := imagor.NewBlobFromFile(filepath.Join(testDataDir, "demo1.jpg"))
+			out, err := p.Process(ctx, src, imagorpath.Params{
+				Width: 100, Height: 100, FitIn: true,
+				Filters: append(filters, imagorpath.Filter{Name: "format", Args: "jpeg"}),
+			}, nil)
+			require.NoError(t, err)
+			buf, err := out.ReadAll()
+			require.NoError(t, err)
+			return buf
+		}
+		// qualities 52, 74 and 85 searched, the most similar 85 returned
+		buf := process(imagorpath.Filter{Name: "target_ssim", Args: "0.99999"})
+		assert.Equal(t, process(imagorpath.Filter{Name: "quality", Args: "85"}), buf)
+		assert.Equal(t, 1, logs.FilterMessage("target_ssim").Len())
+	})
 	t.Run("invalid BMP", func(t *testing.T) {
 		ctx := context.Background()
 		blob := imagor.NewBlobFromBytes([]byte("BMabcdasdfasdfasdfasdfasdfasdfasdfasdfasdfasdf"))
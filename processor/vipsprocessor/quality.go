@@ -0,0 +1,72 @@
+package vipsprocessor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cshum/vipsgen/vips"
+)
+
+// QualityRule output quality of an image format,
+// optionally bounded by the size of the output image
+type QualityRule struct {
+	Format vips.ImageType
+	// MaxSize maximum of output width and height the rule applies to, 0 for any size
+	MaxSize int
+	Quality int
+}
+
+// QualityTable format aware quality mapping,
+// applies when no quality or quality(auto) is requested
+type QualityTable []QualityRule
+
+// ParseQualityTable parses quality table of comma separated FORMAT[@MAXSIZE]:QUALITY
+// e.g. jpeg:80,webp:75,avif:50,avif@320:60
+func ParseQualityTable(value string) (QualityTable, error) {
+	var table QualityTable
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, q, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("vipsprocessor: invalid quality rule %q", entry)
+		}
+		var rule QualityRule
+		var err error
+		name, size, hasSize := strings.Cut(name, "@")
+		if hasSize {
+			if rule.MaxSize, err = strconv.Atoi(size); err != nil || rule.MaxSize <= 0 {
+				return nil, fmt.Errorf("vipsprocessor: invalid quality rule size %q", entry)
+			}
+		}
+		if rule.Format, ok = imageTypeMap[strings.ToLower(strings.TrimSpace(name))]; !ok {
+			return nil, fmt.Errorf("vipsprocessor: invalid quality rule format %q", entry)
+		}
+		if rule.Quality, err = strconv.Atoi(strings.TrimSpace(q)); err != nil || rule.Quality < 1 || rule.Quality > 100 {
+			return nil, fmt.Errorf("vipsprocessor: invalid quality rule quality %q", q)
+		}
+		table = append(table, rule)
+	}
+	return table, nil
+}
+
+// Quality returns the quality of the output format and dimensions, 0 if no rule applies.
+// The rule of the smallest size bucket fitting the dimensions takes precedence
+func (t QualityTable) Quality(format vips.ImageType, width, height int) int {
+	size := max(width, height)
+	var match *QualityRule
+	for i, rule := range t {
+		if rule.Format != format || (rule.MaxSize > 0 && size > rule.MaxSize) {
+			continue
+		}
+		if match == nil || (rule.MaxSize > 0 && (match.MaxSize == 0 || rule.MaxSize < match.MaxSize)) {
+			match = &t[i]
+		}
+	}
+	if match == nil {
+		return 0
+	}
+	return match.Quality
+}
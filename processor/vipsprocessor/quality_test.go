@@ -0,0 +1,37 @@
+package vipsprocessor
+
+import (
+	"testing"
+
+	"github.com/cshum/vipsgen/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQualityTable(t *testing.T) {
+	table, err := ParseQualityTable("jpeg:80, webp:75,avif:50,avif@320:60,avif@640:55")
+	require.NoError(t, err)
+	assert.Equal(t, QualityTable{
+		{Format: vips.ImageTypeJpeg, Quality: 80},
+		{Format: vips.ImageTypeWebp, Quality: 75},
+		{Format: vips.ImageTypeAvif, Quality: 50},
+		{Format: vips.ImageTypeAvif, MaxSize: 320, Quality: 60},
+		{Format: vips.ImageTypeAvif, MaxSize: 640, Quality: 55},
+	}, table)
+
+	assert.Equal(t, 80, table.Quality(vips.ImageTypeJpeg, 1000, 1000))
+	assert.Equal(t, 75, table.Quality(vips.ImageTypeWebp, 100, 100))
+	assert.Equal(t, 60, table.Quality(vips.ImageTypeAvif, 320, 100))
+	assert.Equal(t, 55, table.Quality(vips.ImageTypeAvif, 100, 500))
+	assert.Equal(t, 50, table.Quality(vips.ImageTypeAvif, 1500, 100))
+	assert.Equal(t, 0, table.Quality(vips.ImageTypePng, 100, 100))
+
+	table, err = ParseQualityTable("")
+	assert.NoError(t, err)
+	assert.Empty(t, table)
+
+	for _, value := range []string{"jpeg", "foo:80", "jpeg:0", "jpeg:101", "jpeg@x:80", "jpeg@0:80"} {
+		_, err = ParseQualityTable(value)
+		assert.Error(t, err, value)
+	}
+}
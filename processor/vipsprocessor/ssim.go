@@ -0,0 +1,153 @@
+package vipsprocessor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cshum/vipsgen/vips"
+	"go.uber.org/zap"
+)
+
+const (
+	// ssimSize maximum dimension of the downscaled copies compared by SSIM
+	ssimSize = 256
+	// ssimWindow SSIM window size and stride
+	ssimWindow = 8
+	ssimStride = 4
+
+	ssimMinQuality = 10
+	ssimMaxQuality = 95
+)
+
+var (
+	errSSIMDimensions = errors.New("vipsprocessor: ssim dimensions mismatch")
+	errSSIMTarget     = errors.New("vipsprocessor: target ssim not reached within iterations")
+)
+
+// isLossyFormat indicates if image type is encoded with lossy quality
+func isLossyFormat(format vips.ImageType) bool {
+	switch format {
+	case vips.ImageTypeJpeg, vips.ImageTypeWebp, vips.ImageTypeAvif,
+		vips.ImageTypeHeif, vips.ImageTypeJxl, vips.ImageTypeJp2k:
+		return true
+	}
+	return false
+}
+
+// ssimPixelOptions luminance of the image downscaled to fit in ssimSize
+var ssimPixelOptions = pixelOptions{Width: ssimSize, Height: ssimSize, Size: vips.SizeDown, Gray: true}
+
+// ssim mean structural similarity of 1 band luminance pixels a and b,
+// over sliding windows of ssimWindow size
+func ssim(a, b *pixelBuffer) (float64, error) {
+	if a.Width != b.Width || a.Height != b.Height {
+		return 0, errSSIMDimensions
+	}
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	width, height := a.Width, a.Height
+	win := ssimWindow
+	if width < win || height < win {
+		win = min(width, height)
+	}
+	if win == 0 {
+		return 0, errSSIMDimensions
+	}
+	var sum float64
+	var count int
+	for y := 0; y+win <= height; y += ssimStride {
+		for x := 0; x+win <= width; x += ssimStride {
+			var sa, sb, saa, sbb, sab float64
+			for j := 0; j < win; j++ {
+				row := (y+j)*width + x
+				for i := 0; i < win; i++ {
+					pa, pb := float64(a.Pix[row+i]), float64(b.Pix[row+i])
+					sa += pa
+					sb += pb
+					saa += pa * pa
+					sbb += pb * pb
+					sab += pa * pb
+				}
+			}
+			cnt := float64(win * win)
+			ma, mb := sa/cnt, sb/cnt
+			va := saa/cnt - ma*ma
+			vb := sbb/cnt - mb*mb
+			cov := sab/cnt - ma*mb
+			sum += ((2*ma*mb + c1) * (2*cov + c2)) /
+				((ma*ma + mb*mb + c1) * (va + vb + c2))
+			count++
+		}
+	}
+	return sum / float64(count), nil
+}
+
+// searchQuality binary searches the lowest encoder quality of which the output
+// is perceptually similar to the image by the target SSIM,
+// bounded by MaxSSIMIterations and the context.
+// Returns the most similar output found if the target is not reached within iterations
+func (v *Processor) searchQuality(
+	ctx context.Context, img *vips.Image, target float64,
+	export func(quality int) ([]byte, error),
+) (buf []byte, quality int, err error) {
+	ref, err := newPixelBuffer(img, ssimPixelOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	var out, best []byte
+	var score, bestScore float64
+	var bestQuality int
+	lo, hi := ssimMinQuality, ssimMaxQuality
+	for i := 0; i < v.MaxSSIMIterations && lo <= hi; i++ {
+		if err = ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		q := (lo + hi) / 2
+		if out, err = export(q); err != nil {
+			return nil, 0, err
+		}
+		if score, err = ssimOf(ref, out); err != nil {
+			return nil, 0, err
+		}
+		if v.Debug {
+			v.withContextLogger(ctx).Debug("target_ssim",
+				zap.Int("quality", q),
+				zap.Float64("ssim", score),
+				zap.Int("bytes", len(out)))
+		}
+		if score >= target {
+			buf, quality = out, q
+			hi = q - 1
+		} else {
+			lo = q + 1
+			if best == nil || score > bestScore {
+				best, bestScore, bestQuality = out, score, q
+			}
+		}
+	}
+	if buf == nil && best != nil {
+		v.withContextLogger(ctx).Warn("target_ssim",
+			zap.Float64("target", target),
+			zap.Float64("ssim", bestScore),
+			zap.Int("quality", bestQuality),
+			zap.Error(errSSIMTarget))
+		buf, quality = best, bestQuality
+	}
+	return buf, quality, nil
+}
+
+// ssimOf SSIM of the encoded image buffer against the reference luminance
+func ssimOf(ref *pixelBuffer, buf []byte) (float64, error) {
+	img, err := vips.NewImageFromBuffer(buf, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer img.Close()
+	plane, err := newPixelBuffer(img, ssimPixelOptions)
+	if err != nil {
+		return 0, err
+	}
+	return ssim(ref, plane)
+}
@@ -0,0 +1,42 @@
+package vipsprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSIM(t *testing.T) {
+	newPlane := func(w, h int, fn func(x, y int) byte) *pixelBuffer {
+		p := &pixelBuffer{Pix: make([]byte, w*h), Width: w, Height: h, Bands: 1}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				p.Pix[y*w+x] = fn(x, y)
+			}
+		}
+		return p
+	}
+	gradient := newPlane(64, 48, func(x, y int) byte { return byte(x*3 + y) })
+	noisy := newPlane(64, 48, func(x, y int) byte { return byte(x*3+y) ^ byte((x*7+y*13)%8) })
+	flat := newPlane(64, 48, func(x, y int) byte { return 128 })
+
+	score, err := ssim(gradient, gradient)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, score, 1e-9)
+
+	noisyScore, err := ssim(gradient, noisy)
+	assert.NoError(t, err)
+	assert.Less(t, noisyScore, 1.0)
+
+	flatScore, err := ssim(gradient, flat)
+	assert.NoError(t, err)
+	assert.Less(t, flatScore, noisyScore)
+
+	small := newPlane(5, 3, func(x, y int) byte { return byte(x + y) })
+	score, err = ssim(small, small)
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, score, 1e-9)
+
+	_, err = ssim(gradient, small)
+	assert.ErrorIs(t, err, errSSIMDimensions)
+}
@@ -0,0 +1,223 @@
+package imagor
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cshum/imagor/imagorpath"
+	"go.uber.org/zap"
+)
+
+// resultIndexPrefix key prefix of the source to results index in result storages
+const resultIndexPrefix = "_imagor-index/"
+
+// Lister optional Storage interface for listing keys by prefix, required for purging results
+type Lister interface {
+	// List keys with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// PurgeResult keys removed by purge of the source image
+type PurgeResult struct {
+	Image    string   `json:"image"`
+	Storages []string `json:"storages"`
+	Results  []string `json:"results"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// Purge deletes the source image from Storages and every result derived from it from ResultStorages.
+// Results are located by listing the key prefix of a imagorpath.ResultStoragePrefixer path style,
+// or from the result index if enabled.
+// Nothing is deleted if any of the ResultStorages does not support purge
+func (app *Imagor) Purge(ctx context.Context, image string) (*PurgeResult, error) {
+	res := &PurgeResult{
+		Image:    image,
+		Storages: []string{},
+		Results:  []string{},
+	}
+	if image == "" {
+		return res, ErrInvalid
+	}
+	for _, storage := range app.ResultStorages {
+		if err := app.checkPurgeSupport(storage); err != nil {
+			res.Errors = append(res.Errors, err.Error())
+			return res, err
+		}
+	}
+	var errs []error
+	var storageKey = image
+	if app.StoragePathStyle != nil {
+		storageKey = app.StoragePathStyle.Hash(image)
+	}
+	if app.notFound != nil {
+		app.notFound.Delete(app.negativeCacheKey(ctx, storageKey))
+	}
+	for _, storage := range app.Storages {
+		if _, err := storage.Stat(ctx, storageKey); err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if err := storage.Delete(ctx, storageKey); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res.Storages = appendUnique(res.Storages, storageKey)
+	}
+	for _, storage := range app.ResultStorages {
+		keys, err := app.purgeResults(ctx, storage, image)
+		for _, key := range keys {
+			res.Results = appendUnique(res.Results, key)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		for _, e := range errs {
+			res.Errors = append(res.Errors, e.Error())
+		}
+		app.withContextLogger(ctx).Warn("purge",
+			zap.String("image", image),
+			zap.Error(err))
+	} else if app.Debug {
+		app.withContextLogger(ctx).Debug("purged",
+			zap.String("image", image),
+			zap.Strings("storages", res.Storages),
+			zap.Strings("results", res.Results))
+	}
+	return res, err
+}
+
+// checkPurgeSupport returns error if results of the result storage cannot be located for purge
+func (app *Imagor) checkPurgeSupport(storage Storage) error {
+	_, isLister := storage.(Lister)
+	_, isPrefixer := app.ResultStoragePathStyle.(imagorpath.ResultStoragePrefixer)
+	if !isLister || (!isPrefixer && !app.ResultIndex) {
+		return fmt.Errorf("imagor: result storage %s does not support purge", getType(storage))
+	}
+	return nil
+}
+
+// purgeResults deletes results of the image from the result storage, returning the deleted keys
+func (app *Imagor) purgeResults(ctx context.Context, storage Storage, image string) (keys []string, err error) {
+	if err = app.checkPurgeSupport(storage); err != nil {
+		return
+	}
+	lister := storage.(Lister)
+	prefixer, isPrefixer := app.ResultStoragePathStyle.(imagorpath.ResultStoragePrefixer)
+	var errs []error
+	var deleted = map[string]bool{}
+	del := func(key string) {
+		if deleted[key] {
+			return
+		}
+		deleted[key] = true
+		if e := storage.Delete(ctx, key); e != nil && !errors.Is(e, ErrNotFound) {
+			errs = append(errs, e)
+			return
+		}
+		keys = append(keys, key)
+	}
+	if isPrefixer {
+		listed, e := lister.List(ctx, prefixer.ResultPrefix(image))
+		if e != nil {
+			errs = append(errs, e)
+		}
+		for _, key := range listed {
+			if prefixer.MatchResult(image, key) {
+				del(key)
+			}
+		}
+	}
+	if app.ResultIndex {
+		markers, e := lister.List(ctx, resultIndexKey(image, ""))
+		if e != nil {
+			errs = append(errs, e)
+		}
+		r, _ := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+		for _, marker := range markers {
+			blob, e := checkBlob(storage.Get(r, marker))
+			if e == nil {
+				var buf []byte
+				if buf, e = blob.ReadAll(); e == nil && len(buf) > 0 {
+					del(string(buf))
+				}
+			}
+			if e != nil && !errors.Is(e, ErrNotFound) {
+				errs = append(errs, e)
+				continue
+			}
+			if e = storage.Delete(ctx, marker); e != nil && !errors.Is(e, ErrNotFound) {
+				errs = append(errs, e)
+			}
+		}
+	}
+	return keys, errors.Join(errs...)
+}
+
+// saveResultIndex saves the result key to the result index of the image
+func (app *Imagor) saveResultIndex(ctx context.Context, image, resultKey string) {
+	blob := NewBlobFromBytes([]byte(resultKey))
+	blob.SetContentType("text/plain")
+	app.save(ctx, app.ResultStorages, resultIndexKey(image, resultKey), blob)
+}
+
+// resultIndexKey returns the result index key of the image and result key,
+// or the index prefix of the image if result key is empty
+func resultIndexKey(image, resultKey string) string {
+	digest := sha1.Sum([]byte(image))
+	key := resultIndexPrefix + hex.EncodeToString(digest[:]) + "/"
+	if resultKey != "" {
+		digest = sha1.Sum([]byte(resultKey))
+		key += hex.EncodeToString(digest[:])
+	}
+	return key
+}
+
+// handlePurgeRequest handles DELETE /{hash}/purge/{image} requests,
+// signed with the purge endpoint signature of the image. Refused in unsafe mode
+func (app *Imagor) handlePurgeRequest(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	hash, path, _ := strings.Cut(path, "/")
+	path, ok := strings.CutPrefix(path, "purge/")
+	if !ok || path == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if app.Unsafe {
+		app.handleJSONError(w, r, ErrMethodNotAllowed)
+		return
+	}
+	if !app.verifyEndpoint(r, "purge", path, hash) {
+		app.handleJSONError(w, r, ErrSignatureMismatch)
+		return
+	}
+	image, err := url.PathUnescape(path)
+	if err != nil {
+		app.handleJSONError(w, r, ErrInvalid)
+		return
+	}
+	res, err := app.Purge(r.Context(), image)
+	if err != nil {
+		w.WriteHeader(WrapError(err).Code)
+	}
+	writeJSON(w, r, res)
+}
+
+func appendUnique(keys []string, key string) []string {
+	for _, k := range keys {
+		if k == key {
+			return keys
+		}
+	}
+	return append(keys, key)
+}
@@ -0,0 +1,73 @@
+package imagor
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// isRefererAllowed checks if request Origin, or Referer host if no Origin,
+// matches any of the comma separated hosts. Wildcard *.example.com matches subdomains
+func isRefererAllowed(r *http.Request, hosts string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		origin = r.Header.Get("Referer")
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range strings.Split(hosts, ",") {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == "" {
+			continue
+		}
+		if allowed == host {
+			return true
+		}
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isClientIPAllowed checks if client IP of the request is within any of the comma separated CIDR or IP
+func (app *Imagor) isClientIPAllowed(r *http.Request, ranges string) bool {
+	var clientIP string
+	if app.ClientIP != nil {
+		clientIP = app.ClientIP(r)
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		clientIP = host
+	} else {
+		clientIP = r.RemoteAddr
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range strings.Split(ranges, ",") {
+		allowed = strings.TrimSpace(allowed)
+		if !strings.Contains(allowed, "/") {
+			if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(allowed); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAccessError returns if error denies access of the URL,
+// in which case the original image must not be served in place
+func isAccessError(err error) bool {
+	return errors.Is(err, ErrSignatureMismatch) ||
+		errors.Is(err, ErrExpired) ||
+		errors.Is(err, ErrScopeMismatch)
+}
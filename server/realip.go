@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -79,3 +80,65 @@ func RealIP(r *http.Request) string {
 	// If nothing succeed, return X-Real-IP
 	return xRealIP
 }
+
+// ParseTrustedProxies parses comma separated CIDR or IP of trusted proxies
+func ParseTrustedProxies(value string) (proxies []*net.IPNet, err error) {
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, errors.New("server: invalid trusted proxy " + proxy)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, errors.New("server: invalid trusted proxy " + proxy)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return
+}
+
+// TrustedProxyIP returns client IP resolver of the trusted proxies.
+// If the remote address is a trusted proxy, returns the rightmost X-Forwarded-For address
+// that is not a trusted proxy, as addresses left of it can be forged by the client.
+// Otherwise returns the remote address
+func TrustedProxyIP(proxies []*net.IPNet) func(r *http.Request) string {
+	isTrusted := func(ip net.IP) bool {
+		for _, proxy := range proxies {
+			if proxy.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(r *http.Request) string {
+		remoteIP := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			remoteIP = host
+		}
+		if ip := net.ParseIP(remoteIP); ip == nil || !isTrusted(ip) {
+			return remoteIP
+		}
+		addresses := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := strings.TrimSpace(addresses[i])
+			ip := net.ParseIP(address)
+			if ip == nil {
+				break
+			}
+			if !isTrusted(ip) {
+				return address
+			}
+		}
+		return remoteIP
+	}
+}
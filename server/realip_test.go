@@ -1,7 +1,11 @@
 package server
 
 import (
+	"net/http/httptest"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestIsPrivateIP(t *testing.T) {
@@ -18,3 +22,32 @@ func TestIsPrivateIP(t *testing.T) {
 		t.Error("should error for invalid address")
 	}
 }
+
+func TestTrustedProxyIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	require.NoError(t, err)
+	clientIP := TrustedProxyIP(proxies)
+	request := func(remoteAddr string, xff ...string) string {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remoteAddr
+		for _, v := range xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		return clientIP(r)
+	}
+	// untrusted remote address
+	assert.Equal(t, "1.2.3.4", request("1.2.3.4:1234", "5.6.7.8"))
+	// rightmost untrusted address, forged addresses on the left ignored
+	assert.Equal(t, "5.6.7.8", request("10.0.0.1:1234", "9.9.9.9, 5.6.7.8"))
+	assert.Equal(t, "5.6.7.8", request("192.168.1.1:1234", "9.9.9.9", "5.6.7.8, 10.1.1.1"))
+	// fallback to remote address
+	assert.Equal(t, "10.0.0.1", request("10.0.0.1:1234"))
+	assert.Equal(t, "10.0.0.1", request("10.0.0.1:1234", "10.0.0.2"))
+	assert.Equal(t, "10.0.0.1", request("10.0.0.1:1234", "5.6.7.8, unknown"))
+	// not trusted without proxies
+	clientIP = TrustedProxyIP(nil)
+	assert.Equal(t, "10.0.0.1", request("10.0.0.1:1234", "5.6.7.8"))
+
+	_, err = ParseTrustedProxies("10.0.0.0/8,foo")
+	assert.Error(t, err)
+}
@@ -2,12 +2,17 @@ package filestorage
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cshum/imagor"
@@ -27,7 +32,22 @@ type FileStorage struct {
 	SafeChars       string
 	Expiration      time.Duration
 
+	// MaxSize maximum total bytes of files, least recently accessed files are evicted beyond by the janitor
+	MaxSize int64
+
+	// JanitorInterval interval of the janitor evicting expired and least recently accessed files
+	JanitorInterval time.Duration
+
+	// ShardLevels number of hashed directory levels prepended to file paths
+	ShardLevels int
+
 	safeChars imagorpath.SafeChars
+
+	mu       sync.Mutex
+	accessed map[string]time.Time
+	closed   chan struct{}
+	started  sync.Once
+	once     sync.Once
 }
 
 // New creates FileStorage
@@ -38,6 +58,9 @@ func New(baseDir string, options ...Option) *FileStorage {
 		Blacklists:      []*regexp.Regexp{dotFileRegex},
 		MkdirPermission: 0755,
 		WritePermission: 0666,
+		JanitorInterval: time.Minute,
+		accessed:        map[string]time.Time{},
+		closed:          make(chan struct{}),
 	}
 	for _, option := range options {
 		option(s)
@@ -57,7 +80,22 @@ func (s *FileStorage) Path(image string) (string, bool) {
 	if !strings.HasPrefix(image, s.PathPrefix) {
 		return "", false
 	}
-	return filepath.Join(s.BaseDir, strings.TrimPrefix(image, s.PathPrefix)), true
+	key := strings.TrimPrefix(image, s.PathPrefix)
+	return filepath.Join(s.BaseDir, s.shard(key), key), true
+}
+
+// shard returns hashed directory levels of the key if ShardLevels set
+func (s *FileStorage) shard(key string) string {
+	if s.ShardLevels <= 0 {
+		return ""
+	}
+	sum := sha1.Sum([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+	dirs := make([]string, s.ShardLevels)
+	for i := range dirs {
+		dirs[i] = digest[i*2 : i*2+2]
+	}
+	return filepath.Join(dirs...)
 }
 
 // Get implements imagor.Storage interface
@@ -72,15 +110,24 @@ func (s *FileStorage) Get(_ *http.Request, image string) (*imagor.Blob, error) {
 		}
 		return nil
 	})
+	if s.MaxSize > 0 && blob.Err() == nil {
+		s.touch(image)
+	}
 	return blob, blob.Err()
 }
 
-// Put implements imagor.Storage interface
+// Put implements imagor.Storage interface,
+// writing to a temp file renamed in place so that partial files are never read
 func (s *FileStorage) Put(_ context.Context, image string, blob *imagor.Blob) (err error) {
 	image, ok := s.Path(image)
 	if !ok {
 		return imagor.ErrInvalid
 	}
+	if s.SaveErrIfExists {
+		if _, err = os.Stat(image); err == nil {
+			return os.ErrExist
+		}
+	}
 	if err = os.MkdirAll(filepath.Dir(image), s.MkdirPermission); err != nil {
 		return
 	}
@@ -91,19 +138,19 @@ func (s *FileStorage) Put(_ context.Context, image string, blob *imagor.Blob) (e
 	defer func() {
 		_ = reader.Close()
 	}()
-	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
-	if s.SaveErrIfExists {
-		flag = os.O_RDWR | os.O_CREATE | os.O_EXCL
+	w, err := os.CreateTemp(filepath.Dir(image), tmpPattern)
+	if os.IsNotExist(err) {
+		// empty dir removed by the janitor in between
+		if err = os.MkdirAll(filepath.Dir(image), s.MkdirPermission); err == nil {
+			w, err = os.CreateTemp(filepath.Dir(image), tmpPattern)
+		}
 	}
-	w, err := os.OpenFile(image, flag, s.WritePermission)
 	if err != nil {
 		return
 	}
 	defer func() {
 		_ = w.Close()
-		if err != nil {
-			_ = os.Remove(w.Name())
-		}
+		_ = os.Remove(w.Name())
 	}()
 	if _, err = io.Copy(w, reader); err != nil {
 		return
@@ -111,6 +158,19 @@ func (s *FileStorage) Put(_ context.Context, image string, blob *imagor.Blob) (e
 	if err = w.Sync(); err != nil {
 		return
 	}
+	if err = w.Chmod(s.WritePermission); err != nil {
+		return
+	}
+	if s.SaveErrIfExists {
+		// link fails if exists, the temp file is removed on return
+		return os.Link(w.Name(), image)
+	}
+	if err = os.Rename(w.Name(), image); err != nil {
+		return
+	}
+	if s.MaxSize > 0 {
+		s.touch(image)
+	}
 	return
 }
 
@@ -120,6 +180,9 @@ func (s *FileStorage) Delete(_ context.Context, image string) error {
 	if !ok {
 		return imagor.ErrInvalid
 	}
+	s.mu.Lock()
+	delete(s.accessed, image)
+	s.mu.Unlock()
 	return os.Remove(image)
 }
 
@@ -143,3 +206,62 @@ func (s *FileStorage) Stat(_ context.Context, image string) (stat *imagor.Stat,
 		ModifiedTime: modTime,
 	}, nil
 }
+
+// List implements imagor.Lister interface
+func (s *FileStorage) List(_ context.Context, prefix string) (keys []string, err error) {
+	if _, ok := s.Path(prefix); !ok {
+		return nil, imagor.ErrInvalid
+	}
+	var roots = []string{s.BaseDir}
+	if s.ShardLevels > 0 {
+		var pattern = []string{s.BaseDir}
+		for i := 0; i < s.ShardLevels; i++ {
+			pattern = append(pattern, "??")
+		}
+		if roots, err = filepath.Glob(filepath.Join(pattern...)); err != nil {
+			return
+		}
+	}
+	key := strings.TrimPrefix("/"+imagorpath.Normalize(prefix, s.safeChars), s.PathPrefix)
+	for _, root := range roots {
+		if err = s.list(filepath.Join(root, key), prefix, &keys); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *FileStorage) list(prefixPath, prefix string, keys *[]string) error {
+	if strings.HasSuffix(prefix, "/") {
+		prefixPath += string(filepath.Separator)
+	}
+	return filepath.WalkDir(filepath.Dir(prefixPath), func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			// walk only directories along or under the prefix
+			if dir := name + string(filepath.Separator); !strings.HasPrefix(dir, prefixPath) &&
+				!strings.HasPrefix(prefixPath, dir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefixPath) {
+			return nil
+		}
+		suffix := filepath.ToSlash(name[len(prefixPath):])
+		if s.safeChars.ShouldEscape('%') {
+			if suffix, err = url.QueryUnescape(suffix); err != nil {
+				return nil
+			}
+		}
+		if _, ok := s.Path(prefix + suffix); ok {
+			*keys = append(*keys, prefix+suffix)
+		}
+		return nil
+	})
+}
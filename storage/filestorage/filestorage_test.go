@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -217,6 +218,134 @@ func TestFileStorage_Load_Save(t *testing.T) {
 	})
 }
 
+func TestFileStorage_List(t *testing.T) {
+	ctx := context.Background()
+	s := New(t.TempDir(), WithPathPrefix("/foo"))
+	for _, key := range []string{
+		"foo/abc/def.jpg",
+		"foo/abc/def.1234567890abcdef1234.webp",
+		"foo/abc/def.1234567890abcdef1234_100x100.jpg",
+		"foo/abc/def/ghi.jpg",
+		"foo/abc/def ghi.jpg",
+		"foo/abc/xyz.jpg",
+	} {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes([]byte("foo"))))
+	}
+	keys, err := s.List(ctx, "foo/abc/def.")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"foo/abc/def.jpg",
+		"foo/abc/def.1234567890abcdef1234.webp",
+		"foo/abc/def.1234567890abcdef1234_100x100.jpg",
+	}, keys)
+
+	keys, err = s.List(ctx, "foo/abc/def")
+	require.NoError(t, err)
+	assert.Len(t, keys, 5)
+	assert.Contains(t, keys, "foo/abc/def ghi.jpg")
+
+	keys, err = s.List(ctx, "foo/abc/def/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo/abc/def/ghi.jpg"}, keys)
+
+	keys, err = s.List(ctx, "foo/none/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = s.List(ctx, "bar/abc")
+	assert.Equal(t, imagor.ErrInvalid, err)
+}
+
+func TestFileStorage_ShardLevels(t *testing.T) {
+	ctx := context.Background()
+	r := (&http.Request{}).WithContext(ctx)
+	dir := t.TempDir()
+	s := New(dir, WithShardLevels(2))
+
+	p, ok := s.Path("/foo/abc/def.jpg")
+	require.True(t, ok)
+	rel, err := filepath.Rel(dir, p)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{2}/[0-9a-f]{2}/foo/abc/def\.jpg$`, filepath.ToSlash(rel))
+
+	for _, key := range []string{"foo/abc/def.jpg", "foo/abc/def.webp", "foo/xyz.jpg"} {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes([]byte("foo"))))
+	}
+	b, err := checkBlob(s.Get(r, "foo/abc/def.jpg"))
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	keys, err := s.List(ctx, "foo/abc/")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo/abc/def.jpg", "foo/abc/def.webp"}, keys)
+
+	// no temp files left behind
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(p), ".imagor-*"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestFileStorage_Evict(t *testing.T) {
+	ctx := context.Background()
+	r := (&http.Request{}).WithContext(ctx)
+	dir := t.TempDir()
+	s := New(dir, WithMaxSize(10), WithShardLevels(1))
+
+	past := time.Now().Add(-time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes([]byte("1234"))))
+		p, _ := s.Path(key)
+		require.NoError(t, os.Chtimes(p, past, past))
+	}
+	// abandoned temp file
+	tmp := filepath.Join(dir, ".imagor-123.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("1234"), 0666))
+	require.NoError(t, os.Chtimes(tmp, past.Add(-tmpExpiration), past.Add(-tmpExpiration)))
+
+	// a most recently accessed
+	_, err := checkBlob(s.Get(r, "a"))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Evict())
+	_, err = checkBlob(s.Get(r, "a"))
+	assert.NoError(t, err)
+	_, err = checkBlob(s.Get(r, "b"))
+	assert.Equal(t, imagor.ErrNotFound, err)
+	_, err = checkBlob(s.Get(r, "c"))
+	assert.NoError(t, err)
+	_, err = os.Stat(tmp)
+	assert.True(t, os.IsNotExist(err))
+
+	// empty shard dir of evicted file removed
+	p, _ := s.Path("b")
+	_, err = os.Stat(filepath.Dir(p))
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, s.Put(ctx, "b", imagor.NewBlobFromBytes([]byte("1234"))))
+}
+
+func TestFileStorage_Janitor(t *testing.T) {
+	ctx := context.Background()
+	s := New(t.TempDir(), WithMaxSize(10), WithJanitorInterval(time.Millisecond))
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes([]byte("1234"))))
+	}
+	require.NoError(t, s.Startup(ctx))
+	defer func() {
+		require.NoError(t, s.Shutdown(ctx))
+	}()
+	assert.Eventually(t, func() bool {
+		var n int
+		for _, key := range []string{"a", "b", "c"} {
+			if _, err := s.Stat(ctx, key); err == nil {
+				n++
+			}
+		}
+		return n == 2
+	}, time.Second, time.Millisecond)
+}
+
 func checkBlob(blob *imagor.Blob, err error) (*imagor.Blob, error) {
 	if blob != nil && err == nil {
 		err = blob.Err()
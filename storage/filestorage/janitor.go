@@ -0,0 +1,140 @@
+package filestorage
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tmpPattern temp file name pattern of writes in progress,
+// dot prefixed so that blacklisted from being served or listed
+const tmpPattern = ".imagor-*.tmp"
+
+// tmpExpiration age of temp files considered abandoned by the janitor
+const tmpExpiration = time.Hour
+
+type file struct {
+	path     string
+	size     int64
+	accessed time.Time
+}
+
+// touch records access time of file path for eviction
+func (s *FileStorage) touch(path string) {
+	s.mu.Lock()
+	s.accessed[path] = time.Now()
+	s.mu.Unlock()
+}
+
+// Startup starts the janitor if MaxSize and JanitorInterval set, implements imagor.Lifecycle
+func (s *FileStorage) Startup(_ context.Context) error {
+	if s.MaxSize > 0 && s.JanitorInterval > 0 {
+		s.started.Do(func() {
+			go s.janitor()
+		})
+	}
+	return nil
+}
+
+// Shutdown stops the janitor, implements imagor.Lifecycle
+func (s *FileStorage) Shutdown(_ context.Context) error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+func (s *FileStorage) janitor() {
+	ticker := time.NewTicker(s.JanitorInterval)
+	defer ticker.Stop()
+	for {
+		_ = s.Evict()
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evict removes expired and abandoned temp files,
+// then least recently accessed files until total size within MaxSize, and empty dirs.
+// Access time falls back to modified time for files not accessed since startup
+func (s *FileStorage) Evict() error {
+	var (
+		files []file
+		dirs  []string
+		size  int64
+		now   = time.Now()
+	)
+	s.mu.Lock()
+	accessed := make(map[string]time.Time, len(s.accessed))
+	for path, t := range s.accessed {
+		accessed[path] = t
+	}
+	s.mu.Unlock()
+	err := filepath.WalkDir(s.BaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != s.BaseDir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".imagor-") && strings.HasSuffix(d.Name(), ".tmp") {
+			if now.Sub(info.ModTime()) > tmpExpiration {
+				_ = os.Remove(path)
+			}
+			return nil
+		}
+		if s.Expiration > 0 && now.Sub(info.ModTime()) > s.Expiration {
+			s.remove(path)
+			return nil
+		}
+		f := file{path: path, size: info.Size(), accessed: info.ModTime()}
+		if t, ok := accessed[path]; ok && t.After(f.accessed) {
+			f.accessed = t
+		}
+		files = append(files, f)
+		size += f.size
+		return nil
+	})
+	if err == nil && s.MaxSize > 0 && size > s.MaxSize {
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].accessed.Before(files[j].accessed)
+		})
+		for _, f := range files {
+			if size <= s.MaxSize {
+				break
+			}
+			s.remove(f.path)
+			size -= f.size
+		}
+	}
+	// walked parent first, remove deepest first e.g. shard dirs of evicted files.
+	// Non empty dirs fail to remove
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i])
+	}
+	return err
+}
+
+func (s *FileStorage) remove(path string) {
+	_ = os.Remove(path)
+	s.mu.Lock()
+	delete(s.accessed, path)
+	s.mu.Unlock()
+}
@@ -79,3 +79,30 @@ func WithExpiration(exp time.Duration) Option {
 		}
 	}
 }
+
+// WithMaxSize with maximum total bytes option, least recently accessed files are evicted beyond
+func WithMaxSize(size int64) Option {
+	return func(h *FileStorage) {
+		if size > 0 {
+			h.MaxSize = size
+		}
+	}
+}
+
+// WithJanitorInterval with janitor eviction interval option
+func WithJanitorInterval(interval time.Duration) Option {
+	return func(h *FileStorage) {
+		if interval > 0 {
+			h.JanitorInterval = interval
+		}
+	}
+}
+
+// WithShardLevels with hashed directory levels option
+func WithShardLevels(levels int) Option {
+	return func(h *FileStorage) {
+		if levels > 0 && levels <= 4 {
+			h.ShardLevels = levels
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package memorystorage
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+)
+
+// TenantResolver resolves the tenant bucket of the request, e.g. s3storage.S3Storage
+type TenantResolver interface {
+	TenantBucket(ctx context.Context) (string, error)
+}
+
+type item struct {
+	key         string
+	buf         []byte
+	contentType string
+	stat        imagor.Stat
+	expires     time.Time
+}
+
+// MemoryStorage in-memory LRU Storage bounded by bytes, implements imagor.Storage interface
+type MemoryStorage struct {
+	// Storage wrapped storage if set, read through on miss and write through on put
+	Storage imagor.Storage
+
+	// MaxSize maximum total bytes of items, least recently used items are evicted beyond
+	MaxSize int64
+
+	// MaxItemSize maximum bytes of an item, larger blobs are not stored in memory
+	MaxItemSize int64
+
+	// TTL time to live of items, no expiration if not positive
+	TTL time.Duration
+
+	// Resolver tenant resolver if set, items are keyed by the tenant bucket and image key.
+	// Default to the wrapped storage if implements TenantResolver
+	Resolver TenantResolver
+
+	// Name labels metrics of the storage, default "memory"
+	Name string
+
+	// Instrumentation records hits, misses, evictions and size of the storage if set
+	Instrumentation *instrumentation.Instrumentation
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// New creates MemoryStorage
+func New(options ...Option) *MemoryStorage {
+	s := &MemoryStorage{
+		MaxSize:     1 << 28, // 256MB
+		MaxItemSize: 1 << 20, // 1MB
+		TTL:         time.Hour,
+		Name:        "memory",
+		ll:          list.New(),
+		items:       map[string]*list.Element{},
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.Resolver == nil {
+		s.Resolver, _ = s.Storage.(TenantResolver)
+	}
+	return s
+}
+
+// Get implements imagor.Storage interface
+func (s *MemoryStorage) Get(r *http.Request, image string) (*imagor.Blob, error) {
+	key, err := s.key(r.Context(), image)
+	if err != nil {
+		return nil, err
+	}
+	if it := s.get(key); it != nil {
+		s.record("hit")
+		return newBlob(it), nil
+	}
+	s.record("miss")
+	if s.Storage == nil {
+		return nil, imagor.ErrNotFound
+	}
+	blob, err := s.Storage.Get(r, image)
+	if blob != nil && err == nil {
+		err = blob.Err()
+	}
+	if err != nil || blob == nil || blob.IsEmpty() {
+		return blob, err
+	}
+	var stat imagor.Stat
+	if blob.Stat != nil {
+		stat = *blob.Stat
+	}
+	if it := s.admit(key, blob, stat); it != nil {
+		return newBlob(it), nil
+	}
+	return blob, nil
+}
+
+// Put implements imagor.Storage interface
+func (s *MemoryStorage) Put(ctx context.Context, image string, blob *imagor.Blob) error {
+	key, err := s.key(ctx, image)
+	if err != nil {
+		return err
+	}
+	if s.Storage != nil {
+		if err := s.Storage.Put(ctx, image, blob); err != nil {
+			s.remove(key)
+			return err
+		}
+	}
+	if s.admit(key, blob, imagor.Stat{ModifiedTime: time.Now()}) == nil {
+		// invalidate previous item of the key not admitted
+		s.remove(key)
+	}
+	return nil
+}
+
+// Delete implements imagor.Storage interface
+func (s *MemoryStorage) Delete(ctx context.Context, image string) error {
+	key, err := s.key(ctx, image)
+	if err != nil {
+		return err
+	}
+	s.remove(key)
+	if s.Storage != nil {
+		return s.Storage.Delete(ctx, image)
+	}
+	return nil
+}
+
+// Stat implements imagor.Storage interface
+func (s *MemoryStorage) Stat(ctx context.Context, image string) (*imagor.Stat, error) {
+	key, err := s.key(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if it := s.get(key); it != nil {
+		stat := it.stat
+		return &stat, nil
+	}
+	if s.Storage != nil {
+		return s.Storage.Stat(ctx, image)
+	}
+	return nil, imagor.ErrNotFound
+}
+
+// List implements imagor.Lister interface, including keys of the wrapped storage if supported
+func (s *MemoryStorage) List(ctx context.Context, prefix string) (keys []string, err error) {
+	base, err := s.key(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var seen = map[string]bool{}
+	s.mu.Lock()
+	for key := range s.items {
+		if strings.HasPrefix(key, base+prefix) {
+			key = key[len(base):]
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+	if lister, ok := s.Storage.(imagor.Lister); ok {
+		listed, err := lister.List(ctx, prefix)
+		for _, key := range listed {
+			if !seen[key] {
+				keys = append(keys, key)
+			}
+		}
+		return keys, err
+	}
+	return keys, nil
+}
+
+// Startup starts the wrapped storage if implements imagor.Lifecycle
+func (s *MemoryStorage) Startup(ctx context.Context) error {
+	if lifecycle, ok := s.Storage.(imagor.Lifecycle); ok {
+		return lifecycle.Startup(ctx)
+	}
+	return nil
+}
+
+// Shutdown shuts down the wrapped storage if implements imagor.Lifecycle
+func (s *MemoryStorage) Shutdown(ctx context.Context) error {
+	if lifecycle, ok := s.Storage.(imagor.Lifecycle); ok {
+		return lifecycle.Shutdown(ctx)
+	}
+	return nil
+}
+
+// Len returns number of items in memory
+func (s *MemoryStorage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// Size returns total bytes of items in memory
+func (s *MemoryStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// key returns item key of the image, prefixed by the request tenant bucket if Resolver set
+func (s *MemoryStorage) key(ctx context.Context, image string) (string, error) {
+	if s.Resolver == nil {
+		return image, nil
+	}
+	bucket, err := s.Resolver.TenantBucket(ctx)
+	if err != nil {
+		return "", err
+	}
+	// bucket names do not contain slash
+	return bucket + "/" + image, nil
+}
+
+func (s *MemoryStorage) get(key string) *item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	it := el.Value.(*item)
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		s.removeElement(el)
+		return nil
+	}
+	s.ll.MoveToFront(el)
+	return it
+}
+
+// admit stores blob in memory if within MaxItemSize, returns nil if not admitted
+func (s *MemoryStorage) admit(key string, blob *imagor.Blob, stat imagor.Stat) *item {
+	limit := min(s.MaxItemSize, s.MaxSize)
+	if blob == nil || blob.Size() > limit {
+		return nil
+	}
+	buf, err := blob.ReadAll()
+	if err != nil || int64(len(buf)) > limit {
+		return nil
+	}
+	stat.Size = int64(len(buf))
+	it := &item{
+		key:         key,
+		buf:         buf,
+		contentType: blob.ContentType(),
+		stat:        stat,
+	}
+	if s.TTL > 0 {
+		it.expires = time.Now().Add(s.TTL)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.removeElement(el)
+	}
+	s.items[key] = s.ll.PushFront(it)
+	s.size += stat.Size
+	for s.size > s.MaxSize {
+		if el := s.ll.Back(); el != nil {
+			s.removeElement(el)
+			if s.Instrumentation != nil {
+				s.Instrumentation.RecordMemoryStorageEviction(s.Name)
+			}
+		}
+	}
+	s.recordSize()
+	return it
+}
+
+func (s *MemoryStorage) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.removeElement(el)
+	}
+}
+
+func (s *MemoryStorage) removeElement(el *list.Element) {
+	it := el.Value.(*item)
+	s.ll.Remove(el)
+	delete(s.items, it.key)
+	s.size -= it.stat.Size
+	s.recordSize()
+}
+
+func (s *MemoryStorage) record(status string) {
+	if s.Instrumentation != nil {
+		s.Instrumentation.RecordMemoryStorage(s.Name, status)
+	}
+}
+
+// recordSize records size of the storage, called with lock held
+func (s *MemoryStorage) recordSize() {
+	if s.Instrumentation != nil {
+		s.Instrumentation.RecordMemoryStorageSize(s.Name, s.size)
+	}
+}
+
+func newBlob(it *item) *imagor.Blob {
+	blob := imagor.NewBlobFromBytes(it.buf)
+	if it.contentType != "" {
+		blob.SetContentType(it.contentType)
+	}
+	stat := it.stat
+	blob.Stat = &stat
+	return blob
+}
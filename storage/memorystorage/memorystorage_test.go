@@ -0,0 +1,181 @@
+package memorystorage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+	"github.com/cshum/imagor/storage/filestorage"
+	"github.com/cshum/imagor/storage/s3storage"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s imagor.Storage, key string) (string, error) {
+	b, err := s.Get(httptest.NewRequest(http.MethodGet, "/", nil), key)
+	if err != nil {
+		return "", err
+	}
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	return string(buf), nil
+}
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	s := New(WithMaxSize(10), WithMaxItemSize(5),
+		WithName("test"), WithInstrumentation(instrumentation.New(nil)))
+
+	_, err := get(t, s, "a")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	_, err = s.Stat(ctx, "a")
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	hits := testutil.ToFloat64(instrumentation.MemoryStorageCounter.WithLabelValues("test", "hit"))
+	require.NoError(t, s.Put(ctx, "a", imagor.NewBlobFromBytes([]byte("aaaa"))))
+	buf, err := get(t, s, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", buf)
+	assert.Equal(t, hits+1, testutil.ToFloat64(instrumentation.MemoryStorageCounter.WithLabelValues("test", "hit")))
+	stat, err := s.Stat(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stat.Size)
+	assert.False(t, stat.ModifiedTime.IsZero())
+
+	t.Run("size admission", func(t *testing.T) {
+		require.NoError(t, s.Put(ctx, "large", imagor.NewBlobFromBytes([]byte("123456"))))
+		_, err := get(t, s, "large")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		assert.Equal(t, 1, s.Len())
+	})
+
+	t.Run("lru eviction", func(t *testing.T) {
+		evictions := testutil.ToFloat64(instrumentation.MemoryStorageEvictionCounter.WithLabelValues("test"))
+		require.NoError(t, s.Put(ctx, "b", imagor.NewBlobFromBytes([]byte("bbbb"))))
+		_, err := get(t, s, "a") // a most recently used
+		require.NoError(t, err)
+		require.NoError(t, s.Put(ctx, "c", imagor.NewBlobFromBytes([]byte("cccc"))))
+		assert.Equal(t, int64(8), s.Size())
+		assert.Equal(t, float64(8), testutil.ToFloat64(instrumentation.MemoryStorageSizeGauge.WithLabelValues("test")))
+		assert.Equal(t, evictions+1, testutil.ToFloat64(instrumentation.MemoryStorageEvictionCounter.WithLabelValues("test")))
+		_, err = get(t, s, "b")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		_, err = get(t, s, "a")
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, s.Delete(ctx, "a"))
+		_, err := get(t, s, "a")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		assert.Equal(t, int64(4), s.Size())
+		assert.Equal(t, float64(4), testutil.ToFloat64(instrumentation.MemoryStorageSizeGauge.WithLabelValues("test")))
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		s := New(WithTTL(time.Millisecond * 10))
+		require.NoError(t, s.Put(ctx, "a", imagor.NewBlobFromBytes([]byte("aaaa"))))
+		_, err := get(t, s, "a")
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond * 20)
+		_, err = get(t, s, "a")
+		assert.Equal(t, imagor.ErrNotFound, err)
+		assert.Zero(t, s.Len())
+	})
+}
+
+func TestMemoryStorageWrapped(t *testing.T) {
+	ctx := context.Background()
+	files := filestorage.New(t.TempDir())
+	s := New(WithStorage(files), WithMaxItemSize(5))
+
+	require.NoError(t, files.Put(ctx, "foo/a.jpg", imagor.NewBlobFromBytes([]byte("aaaa"))))
+	require.NoError(t, files.Put(ctx, "foo/large.jpg", imagor.NewBlobFromBytes([]byte("123456"))))
+	fileStat, err := files.Stat(ctx, "foo/a.jpg")
+	require.NoError(t, err)
+
+	// read through
+	buf, err := get(t, s, "foo/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", buf)
+	assert.Equal(t, 1, s.Len())
+	stat, err := s.Stat(ctx, "foo/a.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, fileStat.ModifiedTime, stat.ModifiedTime)
+
+	buf, err = get(t, s, "foo/large.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "123456", buf)
+	assert.Equal(t, 1, s.Len())
+
+	// write through
+	require.NoError(t, s.Put(ctx, "foo/b.jpg", imagor.NewBlobFromBytes([]byte("bbbb"))))
+	buf, err = get(t, files, "foo/b.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "bbbb", buf)
+
+	keys, err := s.List(ctx, "foo/")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo/a.jpg", "foo/b.jpg", "foo/large.jpg"}, keys)
+
+	// delete invalidates both
+	require.NoError(t, s.Delete(ctx, "foo/a.jpg"))
+	_, err = get(t, s, "foo/a.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestMemoryStorageTenants(t *testing.T) {
+	tenants, err := s3storage.NewTenants("a", s3storage.Tenant{Bucket: "b"})
+	require.NoError(t, err)
+	s := New(WithTenantResolver(s3storage.New(aws.Config{}, "a", s3storage.WithTenants(tenants))))
+
+	withBucket := func(bucket string) context.Context {
+		return context.WithValue(context.Background(), "aws-bucket", bucket)
+	}
+	getBucket := func(bucket, key string) (string, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		b, err := s.Get(r.WithContext(withBucket(bucket)), key)
+		if err != nil {
+			return "", err
+		}
+		buf, err := b.ReadAll()
+		require.NoError(t, err)
+		return string(buf), nil
+	}
+
+	require.NoError(t, s.Put(withBucket("a"), "foo.jpg", imagor.NewBlobFromBytes([]byte("aaaa"))))
+	require.NoError(t, s.Put(withBucket("b"), "foo.jpg", imagor.NewBlobFromBytes([]byte("bbbb"))))
+	assert.Equal(t, 2, s.Len())
+
+	buf, err := getBucket("a", "foo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", buf)
+	buf, err = getBucket("b", "foo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "bbbb", buf)
+	// request without bucket resolves default tenant
+	buf, err = get(t, s, "foo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", buf)
+
+	_, err = getBucket("unknown", "foo.jpg")
+	assert.Equal(t, imagor.ErrSourceNotAllowed, err)
+
+	keys, err := s.List(withBucket("b"), "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo.jpg"}, keys)
+
+	require.NoError(t, s.Delete(withBucket("b"), "foo.jpg"))
+	_, err = getBucket("b", "foo.jpg")
+	assert.Equal(t, imagor.ErrNotFound, err)
+	buf, err = getBucket("a", "foo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaa", buf)
+}
@@ -0,0 +1,66 @@
+package memorystorage
+
+import (
+	"time"
+
+	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/metrics/instrumentation"
+)
+
+// Option MemoryStorage option
+type Option func(s *MemoryStorage)
+
+// WithStorage with wrapped storage option, reading through on miss and writing through on put
+func WithStorage(storage imagor.Storage) Option {
+	return func(s *MemoryStorage) {
+		s.Storage = storage
+	}
+}
+
+// WithTenantResolver with tenant resolver option, keying items by the request tenant bucket and image key
+func WithTenantResolver(resolver TenantResolver) Option {
+	return func(s *MemoryStorage) {
+		s.Resolver = resolver
+	}
+}
+
+// WithMaxSize with maximum total bytes option
+func WithMaxSize(size int64) Option {
+	return func(s *MemoryStorage) {
+		if size > 0 {
+			s.MaxSize = size
+		}
+	}
+}
+
+// WithMaxItemSize with maximum bytes of an item option, larger blobs are not stored in memory
+func WithMaxItemSize(size int64) Option {
+	return func(s *MemoryStorage) {
+		if size > 0 {
+			s.MaxItemSize = size
+		}
+	}
+}
+
+// WithTTL with time to live option, no expiration if not positive
+func WithTTL(ttl time.Duration) Option {
+	return func(s *MemoryStorage) {
+		s.TTL = ttl
+	}
+}
+
+// WithName with name option labelling metrics of the storage
+func WithName(name string) Option {
+	return func(s *MemoryStorage) {
+		if name != "" {
+			s.Name = name
+		}
+	}
+}
+
+// WithInstrumentation with instrumentation option recording metrics of the storage
+func WithInstrumentation(instrumentation *instrumentation.Instrumentation) Option {
+	return func(s *MemoryStorage) {
+		s.Instrumentation = instrumentation
+	}
+}
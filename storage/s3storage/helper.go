@@ -2,95 +2,175 @@ package s3storage
 
 import (
 	"context"
-	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"go.uber.org/zap"
+	"github.com/cshum/imagor"
 )
 
-// getBucketFromRequest extracts the bucket name from the "AWS-BUCKET" header
-func (s *S3Storage) getBucketFromRequest(r *http.Request) string {
-	if !s.bucketFromRequest {
-		return s.Bucket
-	}
-	bucket := r.Header.Get("AWS-BUCKET")
-	if bucket == "" {
-		return s.Bucket
+// getBucketFromContext extracts the requested bucket name from the context
+func getBucketFromContext(ctx context.Context) string {
+	if bucket, ok := ctx.Value("aws-bucket").(string); ok {
+		return bucket
 	}
-	return bucket
+	return ""
 }
 
-// getBucketFromRequestForKey extracts the bucket name from the "AWS-BUCKET" header for key prefixing
-func (s *S3Storage) getBucketFromRequestForKey(r *http.Request) string {
-	if s.bucketFromRequest {
-		return ""
+// getRegionFromContext extracts the requested region from the context
+func getRegionFromContext(ctx context.Context) string {
+	if region, ok := ctx.Value("aws-region").(string); ok {
+		return region
 	}
-	return r.Header.Get("AWS-BUCKET")
+	return ""
+}
+
+// resolve resolves the bucket, key and client of the storage path by the request Tenant,
+// or by the request bucket and region without Tenants
+func (s *S3Storage) resolve(ctx context.Context, image string) (bucket, key string, client *s3.Client, err error) {
+	requested := getBucketFromContext(ctx)
+	if s.Tenants == nil {
+		return s.resolveFromRequest(ctx, requested, image)
+	}
+	tenant, ok := s.Tenants.Get(requested)
+	if !ok {
+		return "", "", nil, imagor.ErrSourceNotAllowed
+	}
+	if s.TenantBaseDir != nil {
+		if requested == "" {
+			// keys of requests without bucket stay at the root of own bucket,
+			// same as the key layout without Tenants
+			return s.Bucket, image, s.Client, nil
+		}
+		// own bucket with key nested under tenant base dir
+		return s.Bucket, joinKey(s.TenantBaseDir(tenant), image), s.Client, nil
+	}
+	if !tenant.IsAllowed(image) {
+		return "", "", nil, imagor.ErrSourceNotAllowed
+	}
+	return tenant.Bucket, image, s.getClient(tenant.Region, tenant.Endpoint), nil
 }
 
-// getBucketFromContext extracts the bucket name from the context
-func (s *S3Storage) getBucketFromContext(ctx context.Context) string {
+// resolveFromRequest resolves the bucket, key and client without Tenants.
+// Loads from the request bucket and region if bucketFromRequest and regionFromRequest,
+// otherwise nests keys under the request bucket name in own bucket
+func (s *S3Storage) resolveFromRequest(ctx context.Context, requested, image string) (bucket, key string, client *s3.Client, err error) {
+	client = s.Client
+	if s.regionFromRequest {
+		client = s.getClient(getRegionFromContext(ctx), "")
+	}
 	if !s.bucketFromRequest {
-		return s.Bucket
+		return s.Bucket, joinKey(requested, image), client, nil
 	}
-	if bucket, ok := ctx.Value("aws-bucket").(string); ok && bucket != "" {
-		return bucket
+	if requested == "" {
+		requested = s.Bucket
 	}
-	return s.Bucket
+	return requested, image, client, nil
 }
 
-// getBucketFromContextForKey extracts the bucket name from the context for key prefixing
-func (s *S3Storage) getBucketFromContextForKey(ctx context.Context) string {
-	if s.bucketFromRequest {
-		return ""
-	}
-	if bucket, ok := ctx.Value("aws-bucket").(string); ok && bucket != "" {
+// tenantBucket returns the request tenant bucket,
+// or the request bucket without Tenants, default to the storage bucket
+func (s *S3Storage) tenantBucket(ctx context.Context) string {
+	if s.Tenants != nil {
+		if tenant, ok := s.Tenants.Get(getBucketFromContext(ctx)); ok {
+			return tenant.Bucket
+		}
+	} else if bucket := getBucketFromContext(ctx); bucket != "" {
 		return bucket
 	}
-	return ""
+	return s.Bucket
 }
 
-// getRegionFromRequest extracts the AWS region from the "AWS-REGION" header
-func (s *S3Storage) getRegionFromRequest(r *http.Request) string {
-	if !s.regionFromRequest {
-		return s.baseConfig.Region
-	}
-	region := r.Header.Get("AWS-REGION")
-	if region == "" {
-		return s.baseConfig.Region
-	}
-	s.Logger.Info("AWS-REGION", zap.String("region", region))
-	return region
+// TenantBucket returns the request Tenant bucket, or the request bucket without Tenants,
+// default to the storage bucket. Returns ErrSourceNotAllowed if the request bucket is not a Tenant
+func (s *S3Storage) TenantBucket(ctx context.Context) (string, error) {
+	if s.Tenants != nil {
+		if _, ok := s.Tenants.Get(getBucketFromContext(ctx)); !ok {
+			return "", imagor.ErrSourceNotAllowed
+		}
+	}
+	return s.tenantBucket(ctx), nil
 }
 
-// getRegionFromContext extracts the AWS region from the context
-func (s *S3Storage) getRegionFromContext(ctx context.Context) string {
-	if !s.regionFromRequest {
-		return s.baseConfig.Region
-	}
-	if region, ok := ctx.Value("aws-region").(string); ok && region != "" {
-		s.Logger.Info("AWS-REGION", zap.String("region", region))
-		return region
-	}
-	return s.baseConfig.Region
+// ResolveBucket returns the request Tenant bucket, or the storage bucket without Tenants,
+// false if the request bucket is not a Tenant, or not the storage bucket without Tenants
+func (s *S3Storage) ResolveBucket(ctx context.Context) (string, bool) {
+	requested := getBucketFromContext(ctx)
+	if s.Tenants != nil {
+		tenant, ok := s.Tenants.Get(requested)
+		return tenant.Bucket, ok
+	}
+	if requested == "" || requested == s.Bucket {
+		return s.Bucket, true
+	}
+	return "", false
+}
+
+// tagging returns URL encoded object tags with {bucket} replaced by the request tenant bucket
+func (s *S3Storage) tagging(ctx context.Context) string {
+	bucket := s.tenantBucket(ctx)
+	tags := url.Values{}
+	for key, values := range s.Tags {
+		for _, value := range values {
+			tags.Add(key, strings.ReplaceAll(value, "{bucket}", bucket))
+		}
+	}
+	return tags.Encode()
+}
+
+// getMetadata returns object user metadata of the request params
+func getMetadata(ctx context.Context) map[string]string {
+	metadata := map[string]string{
+		"imagor-version": imagor.Version,
+	}
+	if p, ok := imagor.GetParams(ctx); ok {
+		if p.Image != "" {
+			metadata["imagor-source"] = url.PathEscape(p.Image)
+		}
+		if p.Path != "" {
+			metadata["imagor-params"] = url.PathEscape(p.Path)
+		}
+	}
+	return metadata
 }
 
-// getClientWithRegion creates an S3 client with the specified region
-func (s *S3Storage) getClientWithRegion(region string) *s3.Client {
+// getClient returns S3 client of the region and endpoint, cached for reuse
+func (s *S3Storage) getClient(region, endpoint string) *s3.Client {
 	if region == "" {
-		// Use default client if no region override
+		region = s.baseConfig.Region
+	}
+	if endpoint == "" {
+		endpoint = s.Endpoint
+	}
+	if region == s.baseConfig.Region && endpoint == s.Endpoint {
 		return s.Client
 	}
-
-	// Create a new client with the specified region
+	cacheKey := region + "|" + endpoint
+	s.clientsMu.RLock()
+	client, ok := s.clients[cacheKey]
+	s.clientsMu.RUnlock()
+	if ok {
+		return client
+	}
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	if client, ok = s.clients[cacheKey]; ok {
+		return client
+	}
 	cfg := s.baseConfig
 	cfg.Region = region
+	client = s.newClient(cfg, endpoint)
+	s.clients[cacheKey] = client
+	return client
+}
 
+// newClient creates S3 client with endpoint and path style options
+func (s *S3Storage) newClient(cfg aws.Config, endpoint string) *s3.Client {
 	var s3Options []func(*s3.Options)
-	if s.Endpoint != "" {
+	if endpoint != "" {
 		s3Options = append(s3Options, func(o *s3.Options) {
-			o.BaseEndpoint = aws.String(s.Endpoint)
+			o.BaseEndpoint = aws.String(endpoint)
 			o.DisableLogOutputChecksumValidationSkipped = true
 		})
 	}
@@ -99,21 +179,21 @@ func (s *S3Storage) getClientWithRegion(region string) *s3.Client {
 			o.UsePathStyle = true
 		})
 	}
-
 	return s3.NewFromConfig(cfg, s3Options...)
 }
 
-// buildKeyWithBucketPrefix builds the key with bucket prefix when bucketFromRequest is false
-func (s *S3Storage) buildKeyWithBucketPrefix(key, bucketPrefix string) string {
-	if bucketPrefix == "" {
+// joinKey joins key under base dir
+func joinKey(baseDir, key string) string {
+	baseDir = strings.Trim(baseDir, "/")
+	if baseDir == "" {
 		return key
 	}
 	// Ensure proper path separation
 	if key == "" {
-		return bucketPrefix
+		return baseDir
 	}
 	if key[0] == '/' {
-		return bucketPrefix + key
+		return baseDir + key
 	}
-	return bucketPrefix + "/" + key
+	return baseDir + "/" + key
 }
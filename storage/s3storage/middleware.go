@@ -6,19 +6,16 @@ import (
 	"strings"
 )
 
-// S3ConfigMiddleware is a middleware that extracts the AWS-BUCKET header
-// and adds it to the request context for use by S3Storage
+// S3ConfigMiddleware is a middleware that extracts the AWS-BUCKET and AWS-REGION headers
+// and adds them to the request context for use by S3Storage.
+// The bucket is only a routing hint, validated against the S3Storage Tenants if configured
 func S3ConfigMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		bucket := r.Header.Get("AWS-BUCKET")
-		region := r.Header.Get("AWS-REGION")
-		if bucket != "" {
-			bucket = strings.TrimSpace(bucket)
+		if bucket := strings.TrimSpace(r.Header.Get("AWS-BUCKET")); bucket != "" {
 			ctx := context.WithValue(r.Context(), "aws-bucket", bucket)
 			r = r.WithContext(ctx)
 		}
-		if region != "" {
-			region = strings.TrimSpace(region)
+		if region := strings.TrimSpace(r.Header.Get("AWS-REGION")); region != "" {
 			ctx := context.WithValue(r.Context(), "aws-region", region)
 			r = r.WithContext(ctx)
 		}
@@ -1,9 +1,12 @@
 package s3storage
 
 import (
+	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"go.uber.org/zap"
 )
@@ -113,32 +116,121 @@ func WithLogger(logger *zap.Logger) Option {
 	}
 }
 
-// WithBucketFromRequest with bucket from request option
+// WithBucketFromRequest with bucket from request option, applies without Tenants.
+// Loads from the AWS-BUCKET request bucket if enabled,
+// otherwise nests keys under the request bucket name
 func WithBucketFromRequest(bucketFromRequest bool) Option {
 	return func(s *S3Storage) {
 		s.bucketFromRequest = bucketFromRequest
 	}
 }
 
-// WithRegionFromRequest with region from request option
+// WithRegionFromRequest with region from AWS-REGION request header option, applies without Tenants
 func WithRegionFromRequest(regionFromRequest bool) Option {
 	return func(s *S3Storage) {
 		s.regionFromRequest = regionFromRequest
 	}
 }
 
-// WithImgixFallback with imgix fallback option
-func WithImgixFallback(enabled bool) Option {
+// WithTenants with tenant bucket routing table option
+func WithTenants(tenants *Tenants) Option {
 	return func(s *S3Storage) {
-		s.ImgixFallbackEnabled = enabled
+		if tenants != nil {
+			s.Tenants = tenants
+		}
+	}
+}
+
+// WithTenantBaseDir with tenant base dir option,
+// nesting keys under the base dir of the request Tenant instead of loading from the Tenant bucket
+func WithTenantBaseDir(baseDir func(t Tenant) string) Option {
+	return func(s *S3Storage) {
+		if baseDir != nil {
+			s.TenantBaseDir = baseDir
+		}
+	}
+}
+
+// WithPartSize with multipart upload part size option in bytes, minimum 5MB
+func WithPartSize(partSize int64) Option {
+	return func(s *S3Storage) {
+		if partSize >= manager.MinUploadPartSize {
+			s.PartSize = partSize
+		}
+	}
+}
+
+// WithUploadConcurrency with number of parts uploaded in parallel per object option
+func WithUploadConcurrency(concurrency int) Option {
+	return func(s *S3Storage) {
+		if concurrency > 0 {
+			s.UploadConcurrency = concurrency
+		}
+	}
+}
+
+// WithCacheControl with Cache-Control header option of the objects
+func WithCacheControl(cacheControl string) Option {
+	return func(s *S3Storage) {
+		s.CacheControl = cacheControl
+	}
+}
+
+// WithContentDisposition with Content-Disposition header option of the objects
+func WithContentDisposition(contentDisposition string) Option {
+	return func(s *S3Storage) {
+		s.ContentDisposition = contentDisposition
+	}
+}
+
+// WithMetadata with user metadata option,
+// setting source key, params path and imagor version of the objects
+func WithMetadata(enabled bool) Option {
+	return func(s *S3Storage) {
+		s.Metadata = enabled
+	}
+}
+
+// WithTags with object tags option, comma separated key=value e.g. kind=result,bucket={bucket}
+func WithTags(tags ...string) Option {
+	return func(s *S3Storage) {
+		for _, raw := range tags {
+			for _, tag := range strings.Split(raw, ",") {
+				if idx := strings.Index(tag, "="); idx > 0 {
+					if s.Tags == nil {
+						s.Tags = url.Values{}
+					}
+					s.Tags.Add(strings.TrimSpace(tag[:idx]), strings.TrimSpace(tag[idx+1:]))
+				}
+			}
+		}
+	}
+}
+
+var sseValuesMap = (func() map[string]bool {
+	m := map[string]bool{}
+	for _, sse := range types.ServerSideEncryption("").Values() {
+		m[string(sse)] = true
+	}
+	return m
+})()
+
+// ValidateServerSideEncryption returns error if sse is not a server-side encryption algorithm supported by S3
+func ValidateServerSideEncryption(sse string) error {
+	if sse != "" && !sseValuesMap[sse] {
+		return fmt.Errorf("s3storage: invalid server-side encryption %q", sse)
 	}
+	return nil
 }
 
-// WithImgixFallbackTimeout with imgix fallback timeout option
-func WithImgixFallbackTimeout(timeout time.Duration) Option {
+// WithServerSideEncryption with server-side encryption option e.g. AES256, aws:kms
+// with optional KMS key ID for aws:kms.
+// Unsupported algorithm is not ignored, but rejected by S3 on write, see ValidateServerSideEncryption
+func WithServerSideEncryption(sse, kmsKeyID string) Option {
 	return func(s *S3Storage) {
-		if timeout > 0 {
-			s.ImgixFallbackTimeout = timeout
+		if sse != "" {
+			s.ServerSideEncryption = sse
+			s.SSEKMSKeyID = kmsKeyID
 		}
 	}
 }
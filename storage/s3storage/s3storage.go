@@ -3,15 +3,16 @@ package s3storage
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
@@ -35,14 +36,36 @@ type S3Storage struct {
 	ForcePathStyle bool
 	Logger         *zap.Logger
 
-	// Imgix fallback configuration
-	ImgixFallbackEnabled bool
-	ImgixFallbackTimeout time.Duration
+	// CacheControl Cache-Control header of the objects
+	CacheControl string
+	// ContentDisposition Content-Disposition header of the objects
+	ContentDisposition string
+	// Metadata sets source key, params path and imagor version as user metadata of the objects
+	Metadata bool
+	// Tags object tags, {bucket} in values is replaced by the request tenant bucket
+	Tags url.Values
+	// ServerSideEncryption server-side encryption algorithm of the objects e.g. AES256, aws:kms
+	ServerSideEncryption string
+	// SSEKMSKeyID KMS key ID for aws:kms and aws:kms:dsse server-side encryption, default to the bucket AWS managed key
+	SSEKMSKeyID string
+
+	// PartSize multipart upload part size in bytes, objects within a single part are uploaded in one request
+	PartSize int64
+	// UploadConcurrency number of parts uploaded in parallel per object
+	UploadConcurrency int
+
+	// Tenants bucket routing table resolving Tenant by the request bucket
+	Tenants *Tenants
+	// TenantBaseDir nests keys under the Tenant base dir in own bucket if set,
+	// otherwise loads from the Tenant bucket
+	TenantBaseDir func(t Tenant) string
 
 	safeChars         imagorpath.SafeChars
 	bucketFromRequest bool
 	regionFromRequest bool
 	baseConfig        aws.Config
+	clients           map[string]*s3.Client
+	clientsMu         sync.RWMutex
 }
 
 // New creates S3Storage
@@ -60,25 +83,16 @@ func New(cfg aws.Config, bucket string, options ...Option) *S3Storage {
 		ACL:        "", // Default to no ACL to avoid ACL errors on modern buckets
 		Logger:     zap.NewNop(),
 		baseConfig: cfg,
+		clients:    map[string]*s3.Client{},
+
+		PartSize:          manager.DefaultUploadPartSize,
+		UploadConcurrency: manager.DefaultUploadConcurrency,
 	}
 	for _, option := range options {
 		option(s)
 	}
 
-	// Create S3 client with endpoint and path style options
-	var s3Options []func(*s3.Options)
-	if s.Endpoint != "" {
-		s3Options = append(s3Options, func(o *s3.Options) {
-			o.BaseEndpoint = aws.String(s.Endpoint)
-			o.DisableLogOutputChecksumValidationSkipped = true
-		})
-	}
-	if s.ForcePathStyle {
-		s3Options = append(s3Options, func(o *s3.Options) {
-			o.UsePathStyle = true
-		})
-	}
-	s.Client = s3.NewFromConfig(cfg, s3Options...)
+	s.Client = s.newClient(cfg, s.Endpoint)
 
 	if s.SafeChars == "--" {
 		s.safeChars = imagorpath.NewNoopSafeChars()
@@ -110,13 +124,10 @@ func (s *S3Storage) Get(r *http.Request, image string) (*imagor.Blob, error) {
 	if !ok {
 		return nil, imagor.ErrInvalid
 	}
-	bucket := s.getBucketFromRequest(r)
-	region := s.getRegionFromRequest(r)
-	client := s.getClientWithRegion(region)
-
-	// Get bucket prefix for key when bucketFromRequest is false
-	bucketPrefix := s.getBucketFromRequestForKey(r)
-	key := s.buildKeyWithBucketPrefix(image, bucketPrefix)
+	bucket, key, client, err := s.resolve(ctx, image)
+	if err != nil {
+		return nil, err
+	}
 
 	var blob *imagor.Blob
 	var once sync.Once
@@ -130,13 +141,8 @@ func (s *S3Storage) Get(r *http.Request, image string) (*imagor.Blob, error) {
 			s.Logger.Info("S3 get object error",
 				zap.String("bucket", bucket),
 				zap.String("key", key),
-				zap.String("region", region),
-				zap.String("original_image", r.URL.Path))
-
-			// If it's a not found error and imgix fallback is enabled, try imgix
-			if isNotFoundError(err) && s.ImgixFallbackEnabled {
-				return s.fetchFromImgixAndSave(ctx, r, bucket, key, image)
-			}
+				zap.String("region", client.Options().Region),
+				zap.String("original_image", image))
 
 			if isNotFoundError(err) {
 				return nil, 0, imagor.ErrNotFound
@@ -175,15 +181,12 @@ func (s *S3Storage) Put(ctx context.Context, image string, blob *imagor.Blob) er
 	if !ok {
 		return imagor.ErrInvalid
 	}
-	bucket := s.getBucketFromContext(ctx)
-	region := s.getRegionFromContext(ctx)
-	client := s.getClientWithRegion(region)
-
-	// Get bucket prefix for key when bucketFromRequest is false
-	bucketPrefix := s.getBucketFromContextForKey(ctx)
-	key := s.buildKeyWithBucketPrefix(image, bucketPrefix)
+	bucket, key, client, err := s.resolve(ctx, image)
+	if err != nil {
+		return err
+	}
 
-	reader, size, err := blob.NewReader()
+	reader, _, err := blob.NewReader()
 	if err != nil {
 		return err
 	}
@@ -191,12 +194,11 @@ func (s *S3Storage) Put(ctx context.Context, image string, blob *imagor.Blob) er
 		_ = reader.Close()
 	}()
 	input := &s3.PutObjectInput{
-		Body:          reader,
-		Bucket:        aws.String(bucket),
-		ContentType:   aws.String(blob.ContentType()),
-		ContentLength: aws.Int64(size),
-		Key:           aws.String(key),
-		StorageClass:  types.StorageClass(s.StorageClass),
+		Body:         reader,
+		Bucket:       aws.String(bucket),
+		ContentType:  aws.String(blob.ContentType()),
+		Key:          aws.String(key),
+		StorageClass: types.StorageClass(s.StorageClass),
 	}
 
 	// Only set ACL if it's explicitly configured
@@ -204,12 +206,36 @@ func (s *S3Storage) Put(ctx context.Context, image string, blob *imagor.Blob) er
 	if s.ACL != "" {
 		input.ACL = types.ObjectCannedACL(s.ACL)
 	}
-	_, err = client.PutObject(ctx, input)
+	if s.CacheControl != "" {
+		input.CacheControl = aws.String(s.CacheControl)
+	}
+	if s.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(s.ContentDisposition)
+	}
+	if s.Metadata {
+		input.Metadata = getMetadata(ctx)
+	}
+	if len(s.Tags) > 0 {
+		input.Tagging = aws.String(s.tagging(ctx))
+	}
+	if s.ServerSideEncryption != "" {
+		input.ServerSideEncryption = types.ServerSideEncryption(s.ServerSideEncryption)
+		if s.SSEKMSKeyID != "" && strings.HasPrefix(s.ServerSideEncryption, "aws:kms") {
+			input.SSEKMSKeyId = aws.String(s.SSEKMSKeyID)
+		}
+	}
+	// stream through multipart upload by parts without knowing content length,
+	// which aborts the upload on error or context cancellation
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = s.PartSize
+		u.Concurrency = s.UploadConcurrency
+	})
+	_, err = uploader.Upload(ctx, input)
 	if err != nil {
 		s.Logger.Info("S3 put object error",
 			zap.String("bucket", bucket),
 			zap.String("key", key),
-			zap.String("region", region),
+			zap.String("region", client.Options().Region),
 			zap.String("original_image", image))
 	}
 	return err
@@ -221,15 +247,12 @@ func (s *S3Storage) Delete(ctx context.Context, image string) error {
 	if !ok {
 		return imagor.ErrInvalid
 	}
-	bucket := s.getBucketFromContext(ctx)
-	region := s.getRegionFromContext(ctx)
-	client := s.getClientWithRegion(region)
-
-	// Get bucket prefix for key when bucketFromRequest is false
-	bucketPrefix := s.getBucketFromContextForKey(ctx)
-	key := s.buildKeyWithBucketPrefix(image, bucketPrefix)
+	bucket, key, client, err := s.resolve(ctx, image)
+	if err != nil {
+		return err
+	}
 
-	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
 	})
@@ -237,7 +260,7 @@ func (s *S3Storage) Delete(ctx context.Context, image string) error {
 		s.Logger.Info("S3 delete object error",
 			zap.String("bucket", bucket),
 			zap.String("key", key),
-			zap.String("region", region),
+			zap.String("region", client.Options().Region),
 			zap.String("original_image", image))
 	}
 	return err
@@ -249,13 +272,10 @@ func (s *S3Storage) Stat(ctx context.Context, image string) (stat *imagor.Stat,
 	if !ok {
 		return nil, imagor.ErrInvalid
 	}
-	bucket := s.getBucketFromContext(ctx)
-	region := s.getRegionFromContext(ctx)
-	client := s.getClientWithRegion(region)
-
-	// Get bucket prefix for key when bucketFromRequest is false
-	bucketPrefix := s.getBucketFromContextForKey(ctx)
-	key := s.buildKeyWithBucketPrefix(image, bucketPrefix)
+	bucket, key, client, err := s.resolve(ctx, image)
+	if err != nil {
+		return nil, err
+	}
 
 	input := &s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
@@ -278,90 +298,6 @@ func (s *S3Storage) Stat(ctx context.Context, image string) (stat *imagor.Stat,
 	}, nil
 }
 
-// fetchFromImgixAndSave fetches the image from imgix and saves it to S3
-func (s *S3Storage) fetchFromImgixAndSave(ctx context.Context, r *http.Request, bucket, key, image string) (io.ReadCloser, int64, error) {
-	imgixSubdomain := bucket
-	if imgixSubdomain == "mrsool-business" {
-		imgixSubdomain = "mrsool"
-	}
-	imgixURL := fmt.Sprintf("https://%s.imgix.net/%s?q=100&w=1", imgixSubdomain, image)
-
-	s.Logger.Info("Attempting imgix fallback",
-		zap.String("bucket", bucket),
-		zap.String("key", key),
-		zap.String("imgix_url", imgixURL),
-		zap.String("original_image", r.URL.Path))
-
-	// Create HTTP client with timeout
-	timeout := s.ImgixFallbackTimeout
-	if timeout == 0 {
-		timeout = 30 * time.Second // Default timeout - increased for imgix
-	}
-
-	client := &http.Client{
-		Timeout: timeout,
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", imgixURL, nil)
-	if err != nil {
-		s.Logger.Error("Failed to create imgix request", zap.Error(err))
-		return nil, 0, imagor.ErrNotFound
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		s.Logger.Error("Failed to fetch from imgix",
-			zap.Error(err),
-			zap.String("url", imgixURL),
-			zap.Duration("timeout", timeout))
-		return nil, 0, imagor.ErrNotFound
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		s.Logger.Error("Imgix returned non-200 status",
-			zap.Int("status", resp.StatusCode),
-			zap.String("url", imgixURL))
-		return nil, 0, imagor.ErrNotFound
-	}
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		s.Logger.Error("Failed to read imgix response", zap.Error(err))
-		return nil, 0, imagor.ErrNotFound
-	}
-
-	// Save to S3
-	putInput := &s3.PutObjectInput{
-		Bucket:        aws.String(bucket),
-		Key:           aws.String(key),
-		Body:          strings.NewReader(string(body)),
-		ContentType:   aws.String(resp.Header.Get("Content-Type")),
-		ContentLength: aws.Int64(int64(len(body))),
-		StorageClass:  types.StorageClass(s.StorageClass),
-	}
-
-	// Only set ACL if it's explicitly configured
-	if s.ACL != "" {
-		putInput.ACL = types.ObjectCannedACL(s.ACL)
-	}
-
-	_, err = s.getClientWithRegion(s.getRegionFromRequest(r)).PutObject(ctx, putInput)
-	if err != nil {
-		s.Logger.Error("Failed to save imgix content to S3", zap.Error(err))
-		// Still return the content even if saving failed
-		return io.NopCloser(strings.NewReader(string(body))), int64(len(body)), nil
-	}
-
-	s.Logger.Info("Successfully fetched from imgix and saved to S3",
-		zap.String("bucket", bucket),
-		zap.String("key", key),
-		zap.String("imgix_url", imgixURL))
-
-	// Return the content
-	return io.NopCloser(strings.NewReader(string(body))), int64(len(body)), nil
-}
-
 // Helper function for not found errors
 func isNotFoundError(err error) bool {
 	var nsk *types.NoSuchKey
@@ -378,3 +314,43 @@ func isNotFoundError(err error) bool {
 	}
 	return false
 }
+
+// List implements imagor.Lister interface
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]string, error) {
+	image, ok := s.Path(prefix)
+	if !ok {
+		return nil, imagor.ErrInvalid
+	}
+	if strings.HasSuffix(prefix, "/") {
+		image += "/"
+	}
+	bucket, keyPrefix, client, err := s.resolve(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(keyPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			s.Logger.Info("S3 list objects error",
+				zap.String("bucket", bucket),
+				zap.String("prefix", keyPrefix),
+				zap.Error(err))
+			return keys, err
+		}
+		for _, object := range page.Contents {
+			suffix := strings.TrimPrefix(aws.ToString(object.Key), keyPrefix)
+			if s.safeChars.ShouldEscape('%') {
+				if suffix, err = url.QueryUnescape(suffix); err != nil {
+					continue
+				}
+			}
+			keys = append(keys, prefix+suffix)
+		}
+	}
+	return keys, nil
+}
@@ -1,16 +1,22 @@
 package s3storage
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/cshum/imagor"
+	"github.com/cshum/imagor/imagorpath"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
 	"github.com/stretchr/testify/assert"
@@ -240,6 +246,39 @@ func TestCRUD(t *testing.T) {
 	require.NoError(t, s.Put(ctx, "/foo/boo/asdf", imagor.NewBlobFromBytes([]byte("bar"))))
 }
 
+func TestList(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := New(fakeS3Config(ts, "test"), "test", WithPathPrefix("/foo"), WithBaseDir("/base"),
+		WithEndpoint(ts.URL), WithForcePathStyle(true))
+	for _, key := range []string{
+		"foo/abc/def.jpg",
+		"foo/abc/def.1234567890abcdef1234.webp",
+		"foo/abc/def/ghi.jpg",
+		"foo/abc/def ghi.jpg",
+		"foo/abc/xyz.jpg",
+	} {
+		require.NoError(t, s.Put(ctx, key, imagor.NewBlobFromBytes([]byte("foo"))))
+	}
+	keys, err := s.List(ctx, "foo/abc/def.")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo/abc/def.jpg", "foo/abc/def.1234567890abcdef1234.webp"}, keys)
+
+	keys, err = s.List(ctx, "foo/abc/def")
+	require.NoError(t, err)
+	assert.Len(t, keys, 4)
+	assert.Contains(t, keys, "foo/abc/def ghi.jpg")
+
+	keys, err = s.List(ctx, "foo/abc/def/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"foo/abc/def/ghi.jpg"}, keys)
+
+	_, err = s.List(ctx, "bar/abc")
+	assert.Equal(t, imagor.ErrInvalid, err)
+}
+
 func TestExpiration(t *testing.T) {
 	ts := fakeS3Server()
 	defer ts.Close()
@@ -485,3 +524,292 @@ func TestLocalstackCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestTenants(t *testing.T) {
+	tenants, err := ParseTenants("mrsool", []byte(`[
+		{"bucket": "mrsool-business", "region": "me-south-1", "allowed_prefixes": ["/logos/", "menus/"]},
+		{"bucket": "mrsool-public", "storage_base_dir": "public", "result_storage_base_dir": "public-result"}
+	]`))
+	require.NoError(t, err)
+
+	tenant, ok := tenants.Get("")
+	assert.True(t, ok)
+	assert.Equal(t, "mrsool", tenant.Bucket)
+	assert.Equal(t, "mrsool", tenant.GetStorageBaseDir())
+	assert.Equal(t, "mrsool", tenant.GetResultStorageBaseDir())
+	assert.True(t, tenant.IsAllowed("/foo/bar.jpg"))
+
+	tenant, ok = tenants.Get("mrsool-business")
+	assert.True(t, ok)
+	assert.Equal(t, "me-south-1", tenant.Region)
+	assert.True(t, tenant.IsAllowed("logos/foo.png"))
+	assert.True(t, tenant.IsAllowed("/menus/foo.png"))
+	assert.False(t, tenant.IsAllowed("/users/foo.png"))
+
+	tenant, ok = tenants.Get("mrsool-public")
+	assert.True(t, ok)
+	assert.Equal(t, "public", tenant.GetStorageBaseDir())
+	assert.Equal(t, "public-result", tenant.GetResultStorageBaseDir())
+
+	_, ok = tenants.Get("unknown")
+	assert.False(t, ok)
+
+	_, err = ParseTenants("mrsool", []byte(`[{"bucket": ""}]`))
+	assert.Error(t, err)
+	_, err = ParseTenants("mrsool", []byte(`[{"bucket": "a"}, {"bucket": "a"}]`))
+	assert.Error(t, err)
+	_, err = ParseTenants("mrsool", []byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestTenantRouting(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	cfg := fakeS3Config(ts, "mrsool")
+	fakeS3Config(ts, "mrsool-business")
+	tenants, err := NewTenants("mrsool",
+		Tenant{Bucket: "mrsool-business", AllowedPrefixes: []string{"logos/"}},
+	)
+	require.NoError(t, err)
+
+	withBucket := func(bucket string) context.Context {
+		return context.WithValue(context.Background(), "aws-bucket", bucket)
+	}
+
+	loader := New(cfg, "mrsool", WithTenants(tenants), WithEndpoint(ts.URL), WithForcePathStyle(true))
+	storage := New(cfg, "mrsool", WithTenants(tenants), WithEndpoint(ts.URL), WithForcePathStyle(true),
+		WithTenantBaseDir(Tenant.GetStorageBaseDir))
+
+	ctx := withBucket("mrsool-business")
+	require.NoError(t, loader.Put(ctx, "logos/foo.png", imagor.NewBlobFromBytes([]byte("foo"))))
+	assert.ErrorIs(t, loader.Put(ctx, "users/foo.png", imagor.NewBlobFromBytes([]byte("foo"))), imagor.ErrSourceNotAllowed)
+
+	// loads from tenant bucket
+	b, err := loader.Get((&http.Request{}).WithContext(ctx), "logos/foo.png")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+
+	// default bucket does not see tenant object
+	b, _ = loader.Get(&http.Request{}, "logos/foo.png")
+	_, err = b.ReadAll()
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	// unknown bucket rejected
+	_, err = loader.Get((&http.Request{}).WithContext(withBucket("unknown")), "logos/foo.png")
+	assert.Equal(t, imagor.ErrSourceNotAllowed, err)
+	_, err = storage.Stat(withBucket("unknown"), "logos/foo.png")
+	assert.Equal(t, imagor.ErrSourceNotAllowed, err)
+	_, err = storage.TenantBucket(withBucket("unknown"))
+	assert.Equal(t, imagor.ErrSourceNotAllowed, err)
+
+	bucket, err := storage.TenantBucket(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "mrsool-business", bucket)
+	bucket, err = storage.TenantBucket(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "mrsool", bucket)
+	bucket, ok := loader.ResolveBucket(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "mrsool-business", bucket)
+	_, ok = loader.ResolveBucket(withBucket("unknown"))
+	assert.False(t, ok)
+
+	// storage nests tenant under own bucket
+	require.NoError(t, storage.Put(ctx, "logos/foo.png", imagor.NewBlobFromBytes([]byte("bar"))))
+	b, err = loader.Get(&http.Request{}, "mrsool-business/logos/foo.png")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(buf))
+
+	// requests without bucket keep keys at the root of own bucket
+	require.NoError(t, storage.Put(context.Background(), "users/foo.png", imagor.NewBlobFromBytes([]byte("baz"))))
+	b, err = loader.Get(&http.Request{}, "users/foo.png")
+	require.NoError(t, err)
+	buf, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "baz", string(buf))
+}
+
+func TestRequestRouting(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	cfg := fakeS3Config(ts, "mrsool")
+	fakeS3Config(ts, "mrsool-business")
+	ctx := context.WithValue(context.Background(), "aws-bucket", "mrsool-business")
+
+	loader := New(cfg, "mrsool", WithEndpoint(ts.URL), WithForcePathStyle(true),
+		WithBucketFromRequest(true), WithRegionFromRequest(true))
+	storage := New(cfg, "mrsool", WithEndpoint(ts.URL), WithForcePathStyle(true),
+		WithTenantBaseDir(Tenant.GetStorageBaseDir))
+
+	// loads from the request bucket without Tenants
+	require.NoError(t, loader.Put(ctx, "users/foo.png", imagor.NewBlobFromBytes([]byte("foo"))))
+	b, err := loader.Get((&http.Request{}).WithContext(ctx), "users/foo.png")
+	require.NoError(t, err)
+	buf, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(buf))
+	b, _ = loader.Get(&http.Request{}, "users/foo.png")
+	_, err = b.ReadAll()
+	assert.Equal(t, imagor.ErrNotFound, err)
+
+	// request bucket not resolved without Tenants
+	_, ok := loader.ResolveBucket(ctx)
+	assert.False(t, ok)
+	bucket, ok := loader.ResolveBucket(context.Background())
+	assert.True(t, ok)
+	assert.Equal(t, "mrsool", bucket)
+
+	// storage nests keys under the request bucket name
+	require.NoError(t, storage.Put(ctx, "users/foo.png", imagor.NewBlobFromBytes([]byte("bar"))))
+	require.NoError(t, storage.Put(context.Background(), "users/foo.png", imagor.NewBlobFromBytes([]byte("baz"))))
+	for key, expected := range map[string]string{
+		"mrsool-business/users/foo.png": "bar",
+		"users/foo.png":                 "baz",
+	} {
+		b, err = loader.Get(&http.Request{}, key)
+		require.NoError(t, err)
+		buf, err = b.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(buf))
+	}
+
+	ctx = context.WithValue(ctx, "aws-region", "me-south-1")
+	_, _, client, err := loader.resolve(ctx, "users/foo.png")
+	require.NoError(t, err)
+	assert.Equal(t, "me-south-1", client.Options().Region)
+	_, _, client, err = storage.resolve(ctx, "users/foo.png")
+	require.NoError(t, err)
+	assert.Same(t, storage.Client, client)
+}
+
+func TestTenantClients(t *testing.T) {
+	tenants, err := NewTenants("test", Tenant{Bucket: "other", Region: "me-south-1"})
+	require.NoError(t, err)
+	s := New(aws.Config{Region: "us-east-1"}, "test", WithTenants(tenants))
+
+	assert.Same(t, s.Client, s.getClient("", ""))
+	assert.Same(t, s.Client, s.getClient("us-east-1", ""))
+	client := s.getClient("me-south-1", "")
+	assert.NotSame(t, s.Client, client)
+	assert.Equal(t, "me-south-1", client.Options().Region)
+	assert.Same(t, client, s.getClient("me-south-1", ""))
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ts := fakeS3Server()
+	defer ts.Close()
+
+	ctx := context.Background()
+	s := New(fakeS3Config(ts, "test"), "test", WithEndpoint(ts.URL), WithForcePathStyle(true),
+		WithPartSize(5*1024*1024), WithUploadConcurrency(2))
+	assert.Equal(t, int64(5*1024*1024), s.PartSize)
+	assert.Equal(t, 2, s.UploadConcurrency)
+
+	buf := bytes.Repeat([]byte("abcdefgh"), 12*1024*1024/8)
+	// reader of unknown size e.g. fanout reader
+	blob := imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(bytes.NewReader(buf)), 0, nil
+	})
+	require.NoError(t, s.Put(ctx, "/foo/large", blob))
+
+	b, err := s.Get(&http.Request{}, "/foo/large")
+	require.NoError(t, err)
+	res, err := b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, len(buf), len(res))
+	assert.True(t, bytes.Equal(buf, res))
+
+	small := imagor.NewBlob(func() (io.ReadCloser, int64, error) {
+		return io.NopCloser(strings.NewReader("bar")), 0, nil
+	})
+	require.NoError(t, s.Put(ctx, "/foo/small", small))
+	b, err = s.Get(&http.Request{}, "/foo/small")
+	require.NoError(t, err)
+	res, err = b.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(res))
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, s.Put(cancelCtx, "/foo/cancel", imagor.NewBlobFromBytes(buf)))
+	_, err = s.Stat(ctx, "/foo/cancel")
+	assert.Equal(t, imagor.ErrNotFound, err)
+}
+
+func TestWithPartSize(t *testing.T) {
+	s := New(aws.Config{Region: "us-east-1"}, "test", WithPartSize(1024), WithUploadConcurrency(0))
+	assert.Equal(t, int64(manager.DefaultUploadPartSize), s.PartSize)
+	assert.Equal(t, manager.DefaultUploadConcurrency, s.UploadConcurrency)
+}
+
+func TestObjectAttributes(t *testing.T) {
+	var header http.Header
+	faker := gofakes3.New(s3mem.New()).Server()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			header = r.Header.Clone()
+		}
+		faker.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	tenants, err := NewTenants("test", Tenant{Bucket: "mrsool-business"})
+	require.NoError(t, err)
+	s := New(fakeS3Config(ts, "test"), "test", WithEndpoint(ts.URL), WithForcePathStyle(true),
+		WithTenants(tenants), WithTenantBaseDir(Tenant.GetResultStorageBaseDir),
+		WithCacheControl("public, max-age=31536000"),
+		WithContentDisposition("inline"),
+		WithMetadata(true),
+		WithTags("kind=result, bucket={bucket}", "invalid"),
+		WithServerSideEncryption("aws:kms", "my-key"),
+	)
+	assert.Equal(t, url.Values{"kind": {"result"}, "bucket": {"{bucket}"}}, s.Tags)
+
+	ctx := imagor.WithParams(context.Background(), imagorpath.Params{
+		Image: "foo/bar baz.jpg",
+		Path:  "fit-in/100x100/foo/bar baz.jpg",
+	})
+	assert.Equal(t, "bucket=test&kind=result", s.tagging(ctx))
+	ctx = context.WithValue(ctx, "aws-bucket", "mrsool-business")
+	assert.Equal(t, "bucket=mrsool-business&kind=result", s.tagging(ctx))
+
+	require.NoError(t, s.Put(ctx, "/fit-in/100x100/foo/bar.jpg", imagor.NewBlobFromBytes([]byte("bar"))))
+	assert.Equal(t, "public, max-age=31536000", header.Get("Cache-Control"))
+	assert.Equal(t, "bucket=mrsool-business&kind=result", header.Get("X-Amz-Tagging"))
+	assert.Equal(t, "aws:kms", header.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "my-key", header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+	head, err := s.Client.HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("mrsool-business/fit-in/100x100/foo/bar.jpg"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "inline", aws.ToString(head.ContentDisposition))
+	assert.Equal(t, imagor.Version, head.Metadata["imagor-version"])
+	assert.Equal(t, "foo%2Fbar%20baz.jpg", head.Metadata["imagor-source"])
+	assert.Equal(t, "fit-in%2F100x100%2Ffoo%2Fbar%20baz.jpg", head.Metadata["imagor-params"])
+}
+
+func TestWithServerSideEncryption(t *testing.T) {
+	cfg := aws.Config{Region: "us-east-1"}
+	s := New(cfg, "test", WithServerSideEncryption("aws:kms", "my-key"))
+	assert.Equal(t, "aws:kms", s.ServerSideEncryption)
+	assert.Equal(t, "my-key", s.SSEKMSKeyID)
+
+	s = New(cfg, "test", WithServerSideEncryption("AES256", ""))
+	assert.Equal(t, "AES256", s.ServerSideEncryption)
+
+	s = New(cfg, "test", WithServerSideEncryption("", "my-key"))
+	assert.Empty(t, s.ServerSideEncryption)
+	assert.Empty(t, s.SSEKMSKeyID)
+
+	assert.NoError(t, ValidateServerSideEncryption(""))
+	assert.NoError(t, ValidateServerSideEncryption("aws:kms:dsse"))
+	assert.Error(t, ValidateServerSideEncryption("aws:kmss"))
+}
@@ -0,0 +1,109 @@
+package s3storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// Tenant S3 bucket routing config of a tenant
+type Tenant struct {
+	// Bucket source bucket name, also the tenant identifier
+	Bucket string `json:"bucket"`
+
+	// Region AWS region of the bucket, default to S3Storage region
+	Region string `json:"region,omitempty"`
+
+	// Endpoint S3 endpoint of the bucket, default to S3Storage endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// AllowedPrefixes key prefixes allowed to load from the bucket, allow all if empty
+	AllowedPrefixes []string `json:"allowed_prefixes,omitempty"`
+
+	// StorageBaseDir base dir for the tenant under Storage, default to bucket name
+	StorageBaseDir string `json:"storage_base_dir,omitempty"`
+
+	// ResultStorageBaseDir base dir for the tenant under Result Storage, default to bucket name
+	ResultStorageBaseDir string `json:"result_storage_base_dir,omitempty"`
+}
+
+// IsAllowed checks if key is allowed by the tenant allowed prefixes
+func (t Tenant) IsAllowed(key string) bool {
+	if len(t.AllowedPrefixes) == 0 {
+		return true
+	}
+	key = strings.TrimPrefix(key, "/")
+	for _, prefix := range t.AllowedPrefixes {
+		if strings.HasPrefix(key, strings.TrimPrefix(prefix, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStorageBaseDir returns base dir of the tenant under Storage
+func (t Tenant) GetStorageBaseDir() string {
+	if t.StorageBaseDir != "" {
+		return t.StorageBaseDir
+	}
+	return t.Bucket
+}
+
+// GetResultStorageBaseDir returns base dir of the tenant under Result Storage
+func (t Tenant) GetResultStorageBaseDir() string {
+	if t.ResultStorageBaseDir != "" {
+		return t.ResultStorageBaseDir
+	}
+	return t.Bucket
+}
+
+// Tenants S3 bucket routing table
+type Tenants struct {
+	// Default bucket of the tenant when request does not specify bucket
+	Default string
+
+	tenants map[string]Tenant
+}
+
+// NewTenants creates Tenants routing table with default bucket
+func NewTenants(defaultBucket string, tenants ...Tenant) (*Tenants, error) {
+	t := &Tenants{
+		Default: defaultBucket,
+		tenants: map[string]Tenant{},
+	}
+	for _, tenant := range tenants {
+		tenant.Bucket = strings.TrimSpace(tenant.Bucket)
+		if tenant.Bucket == "" {
+			return nil, errors.New("s3storage: tenant bucket is required")
+		}
+		if _, ok := t.tenants[tenant.Bucket]; ok {
+			return nil, errors.New("s3storage: duplicated tenant bucket " + tenant.Bucket)
+		}
+		t.tenants[tenant.Bucket] = tenant
+	}
+	if t.Default != "" {
+		if _, ok := t.tenants[t.Default]; !ok {
+			// default bucket is always routable
+			t.tenants[t.Default] = Tenant{Bucket: t.Default}
+		}
+	}
+	return t, nil
+}
+
+// ParseTenants parses Tenants routing table from JSON array of Tenant
+func ParseTenants(defaultBucket string, data []byte) (*Tenants, error) {
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, err
+	}
+	return NewTenants(defaultBucket, tenants...)
+}
+
+// Get returns Tenant by bucket, fallback to default bucket if empty
+func (t *Tenants) Get(bucket string) (Tenant, bool) {
+	if bucket == "" {
+		bucket = t.Default
+	}
+	tenant, ok := t.tenants[bucket]
+	return tenant, ok
+}